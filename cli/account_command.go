@@ -78,6 +78,7 @@ func configureActCommand(app commandHost) {
 	restore.Flag("tag", "Place the stream on servers that has specific tags (pass multiple times)").StringsVar(&c.placementTags)
 
 	configureAccountTLSCommand(act)
+	configureAccountExportCommand(act)
 }
 
 func init() {
@@ -0,0 +1,165 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/choria-io/fisk"
+	"github.com/ghodss/yaml"
+	"github.com/nats-io/jsm.go"
+)
+
+type ActExportCmd struct {
+	directory string
+	yaml      bool
+	consumers bool
+	force     bool
+}
+
+func configureAccountExportCommand(act *fisk.CmdClause) {
+	c := &ActExportCmd{}
+
+	export := act.Command("export-config", "Exports the configuration of all JetStream assets").Action(c.exportAction)
+	export.HelpLong(`Writes the configuration of every Stream, Consumer, KV bucket and Object Store
+bucket in the account to a directory, one file per asset.
+
+The files hold no runtime state and can be used with 'nats apply'. JSON files,
+but not YAML files, can also be used with 'nats stream add --config' and
+'nats consumer add --config'.
+`)
+	export.Arg("directory", "Directory to write the configuration to").Required().StringVar(&c.directory)
+	export.Flag("yaml", "Write YAML rather than JSON files").UnNegatableBoolVar(&c.yaml)
+	export.Flag("consumers", "Include durable Consumers").Default("true").BoolVar(&c.consumers)
+	export.Flag("force", "Overwrite existing files without prompting").Short('f').UnNegatableBoolVar(&c.force)
+}
+
+func (c *ActExportCmd) exportAction(_ *fisk.ParseContext) error {
+	_, mgr, err := prepareHelper("", natsOpts()...)
+	fisk.FatalIfError(err, "setup failed")
+
+	streams, missing, err := mgr.Streams(nil)
+	if err != nil {
+		return err
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("could not obtain stream information for %d streams", len(missing))
+	}
+
+	if len(streams) == 0 {
+		return fmt.Errorf("no streams found")
+	}
+
+	if !c.force {
+		entries, err := os.ReadDir(c.directory)
+		if err == nil && len(entries) > 0 {
+			ok, err := askConfirmation(fmt.Sprintf("Directory %s is not empty, overwrite existing files", c.directory), false)
+			fisk.FatalIfError(err, "could not obtain confirmation")
+
+			if !ok {
+				return nil
+			}
+		}
+	}
+
+	err = os.MkdirAll(c.directory, 0700)
+	if err != nil {
+		return err
+	}
+
+	var assets, consumers int
+
+	for _, stream := range streams {
+		if jsm.IsMQTTStateStream(stream.Name()) {
+			continue
+		}
+
+		kind := manifestKindStream
+		name := stream.Name()
+		switch {
+		case stream.IsKVBucket():
+			kind = manifestKindKV
+			name = strings.TrimPrefix(name, "KV_")
+		case stream.IsObjectBucket():
+			kind = manifestKindObject
+			name = strings.TrimPrefix(name, "OBJ_")
+		}
+
+		cj, err := json.Marshal(stream.Configuration())
+		if err != nil {
+			return err
+		}
+
+		err = c.writeManifest(&assetManifest{Kind: kind, Config: cj}, fmt.Sprintf("%s_%s", kind, name))
+		if err != nil {
+			return err
+		}
+		assets++
+
+		if !c.consumers || kind != manifestKindStream {
+			continue
+		}
+
+		var cerr error
+		_, err = stream.EachConsumer(func(cons *jsm.Consumer) {
+			if cerr != nil || !cons.IsDurable() {
+				return
+			}
+
+			cj, err := json.Marshal(cons.Configuration())
+			if err != nil {
+				cerr = err
+				return
+			}
+
+			cerr = c.writeManifest(&assetManifest{Kind: manifestKindConsumer, Stream: stream.Name(), Config: cj}, fmt.Sprintf("%s_%s_%s", manifestKindConsumer, stream.Name(), cons.Name()))
+			if cerr == nil {
+				consumers++
+			}
+		})
+		if err != nil {
+			return err
+		}
+		if cerr != nil {
+			return cerr
+		}
+	}
+
+	fmt.Printf("Exported %d Streams and Buckets and %d Consumers to %s\n", assets, consumers, c.directory)
+
+	return nil
+}
+
+func (c *ActExportCmd) writeManifest(m *assetManifest, name string) error {
+	body, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	ext := ".json"
+	if c.yaml {
+		ext = ".yaml"
+		body, err = yaml.JSONToYAML(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	return os.WriteFile(filepath.Join(c.directory, name+ext), body, 0600)
+}
@@ -0,0 +1,63 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"os"
+	"testing"
+
+	"github.com/nats-io/jsm.go"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+func TestAccountExportConfig(t *testing.T) {
+	withJetStream(t, func(_ *server.Server, nc *nats.Conn, mgr *jsm.Manager) {
+		str, err := mgr.NewStreamFromDefault("ORDERS", applyStreamDefaults, jsm.Subjects("ORDERS.*"), jsm.MemoryStorage(), jsm.MaxMessages(10))
+		assertNoError(t, err)
+		_, err = str.NewConsumer(jsm.DurableName("C1"))
+		assertNoError(t, err)
+
+		js, err := nc.JetStream()
+		assertNoError(t, err)
+		_, err = js.CreateKeyValue(&nats.KeyValueConfig{Bucket: "CONFIG", Storage: nats.MemoryStorage})
+		assertNoError(t, err)
+
+		for _, yaml := range []bool{false, true} {
+			dir := t.TempDir()
+			cmd := &ActExportCmd{directory: dir, yaml: yaml, consumers: true, force: true}
+			assertNoError(t, cmd.exportAction(nil))
+
+			entries, err := os.ReadDir(dir)
+			assertNoError(t, err)
+
+			var files []string
+			for _, e := range entries {
+				files = append(files, e.Name())
+			}
+
+			ext := ".json"
+			if yaml {
+				ext = ".yaml"
+			}
+			assertListEquals(t, files, "consumer_ORDERS_C1"+ext, "kv_CONFIG"+ext, "stream_ORDERS"+ext)
+
+			changes, err := (&applyCmd{paths: []string{dir}, prune: true}).plan()
+			assertNoError(t, err)
+			if len(changes) != 0 {
+				t.Fatalf("expected exported configuration to match the live assets, got %d changes", len(changes))
+			}
+		}
+	})
+}
@@ -0,0 +1,744 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/choria-io/fisk"
+	"github.com/fatih/color"
+	"github.com/ghodss/yaml"
+	"github.com/nats-io/jsm.go"
+	"github.com/nats-io/jsm.go/api"
+)
+
+type applyCmd struct {
+	paths []string
+	prune bool
+	force bool
+
+	mgr *jsm.Manager
+}
+
+const (
+	manifestKindStream   = "stream"
+	manifestKindConsumer = "consumer"
+	manifestKindKV       = "kv"
+	manifestKindObject   = "object"
+)
+
+// assetManifest is a single JetStream asset as stored in a manifest file, it is compatible
+// with the output of stream info --json and consumer info --json which can both be used as
+// manifests
+type assetManifest struct {
+	Kind   string          `json:"kind,omitempty"`
+	Stream string          `json:"stream_name,omitempty"`
+	Config json.RawMessage `json:"config"`
+
+	file string
+}
+
+// applyStreamDefaults is the basis for streams created from manifests, matching the server defaults
+var applyStreamDefaults = api.StreamConfig{
+	Retention:    api.LimitsPolicy,
+	Discard:      api.DiscardOld,
+	Storage:      api.FileStorage,
+	MaxConsumers: -1,
+	MaxMsgs:      -1,
+	MaxMsgsPer:   -1,
+	MaxBytes:     -1,
+	MaxMsgSize:   -1,
+	Replicas:     1,
+}
+
+// applyKVDefaults is the basis for KV buckets created from manifests, matching the stream nats.go creates for a bucket
+func applyKVDefaults(stream string) api.StreamConfig {
+	bucket := strings.TrimPrefix(stream, "KV_")
+
+	return api.StreamConfig{
+		Name:          stream,
+		Subjects:      []string{fmt.Sprintf("$KV.%s.>", bucket)},
+		Retention:     api.LimitsPolicy,
+		Discard:       api.DiscardNew,
+		Storage:       api.FileStorage,
+		MaxConsumers:  -1,
+		MaxMsgs:       -1,
+		MaxMsgsPer:    1,
+		MaxBytes:      -1,
+		MaxMsgSize:    -1,
+		Replicas:      1,
+		Duplicates:    2 * time.Minute,
+		RollupAllowed: true,
+		DenyDelete:    true,
+		AllowDirect:   true,
+	}
+}
+
+// applyObjectDefaults is the basis for object stores created from manifests, matching the stream nats.go creates for a bucket
+func applyObjectDefaults(stream string) api.StreamConfig {
+	bucket := strings.TrimPrefix(stream, "OBJ_")
+
+	return api.StreamConfig{
+		Name:          stream,
+		Subjects:      []string{fmt.Sprintf("$O.%s.C.>", bucket), fmt.Sprintf("$O.%s.M.>", bucket)},
+		Retention:     api.LimitsPolicy,
+		Discard:       api.DiscardNew,
+		Storage:       api.FileStorage,
+		MaxConsumers:  -1,
+		MaxMsgs:       -1,
+		MaxMsgsPer:    -1,
+		MaxBytes:      -1,
+		MaxMsgSize:    -1,
+		Replicas:      1,
+		RollupAllowed: true,
+		AllowDirect:   true,
+	}
+}
+
+// manifestStreamDefaults is the configuration a manifest of the given kind is overlaid on when creating it
+func manifestStreamDefaults(kind string, stream string) api.StreamConfig {
+	switch kind {
+	case manifestKindKV:
+		return applyKVDefaults(stream)
+	case manifestKindObject:
+		return applyObjectDefaults(stream)
+	default:
+		return applyStreamDefaults
+	}
+}
+
+type applyChange struct {
+	action   string
+	kind     string
+	stream   string
+	consumer string
+	diff     string
+
+	streamCfg   *api.StreamConfig
+	consumerCfg *api.ConsumerConfig
+}
+
+func (a *applyChange) String() string {
+	if a.kind == manifestKindConsumer {
+		return fmt.Sprintf("consumer %s > %s", a.stream, a.consumer)
+	}
+
+	return fmt.Sprintf("%s %s", a.kind, a.stream)
+}
+
+func configureApplyCommand(app commandHost) {
+	c := &applyCmd{}
+
+	help := `Reconciles JetStream assets against a set of manifests
+
+Manifests are JSON or YAML files each holding a single Stream, Consumer,
+KV bucket or Object Store bucket. The output of 'nats stream info --json',
+'nats consumer info --json' and 'nats account export-config' can be used
+as manifests.
+
+Streams are created before Consumers, and Streams that are the origin of
+Mirrors or Sources are created before the Streams that copy from them.
+
+Only the configuration keys present in a manifest are managed, other
+settings are left as they are on the server. KV and Object Store buckets
+that do not exist yet are created with the same defaults as 'nats kv add'
+and 'nats object add'.
+
+When pruning, durable Consumers on managed Streams and assets of the kinds
+found in the manifests are removed, for example KV buckets are only deleted
+when at least one KV bucket manifest is given.
+`
+
+	addFlags := func(cmd *fisk.CmdClause) {
+		cmd.HelpLong(help)
+		cmd.Flag("file", "Manifest file or directory of manifests to apply (pass multiple times)").Short('f').Required().StringsVar(&c.paths)
+		cmd.Flag("prune", "Removes Streams, KV buckets, Object Stores and Consumers of the kinds in the manifests that are not in the manifests").UnNegatableBoolVar(&c.prune)
+	}
+
+	apply := app.Command("apply", "Creates or updates JetStream assets to match a set of manifests").Action(c.applyAction)
+	addFlags(apply)
+	apply.Flag("force", "Apply changes without prompting").UnNegatableBoolVar(&c.force)
+
+	plan := app.Command("plan", "Shows changes needed to match a set of manifests, exits 1 on drift").Action(c.planAction)
+	addFlags(plan)
+}
+
+func init() {
+	registerCommand("apply", 1, configureApplyCommand)
+}
+
+func (c *applyCmd) planAction(_ *fisk.ParseContext) error {
+	changes, err := c.plan()
+	if err != nil {
+		return err
+	}
+
+	c.renderPlan(changes)
+
+	if len(changes) > 0 {
+		os.Exit(1)
+	}
+
+	return nil
+}
+
+func (c *applyCmd) applyAction(_ *fisk.ParseContext) error {
+	changes, err := c.plan()
+	if err != nil {
+		return err
+	}
+
+	c.renderPlan(changes)
+
+	if len(changes) == 0 {
+		return nil
+	}
+
+	if !c.force {
+		fmt.Println()
+		ok, err := askConfirmation(fmt.Sprintf("Really apply %d changes", len(changes)), false)
+		fisk.FatalIfError(err, "could not obtain confirmation")
+
+		if !ok {
+			return nil
+		}
+	}
+
+	fmt.Println()
+
+	for _, change := range changes {
+		err = c.applyChange(change)
+		if err != nil {
+			return fmt.Errorf("could not %s %s: %w", change.action, change, err)
+		}
+
+		fmt.Printf("%s %s\n", c.actionPastTense(change.action), change)
+	}
+
+	return nil
+}
+
+func (c *applyCmd) actionPastTense(action string) string {
+	switch action {
+	case "create":
+		return color.GreenString("Created")
+	case "update":
+		return color.YellowString("Updated")
+	default:
+		return color.RedString("Deleted")
+	}
+}
+
+func (c *applyCmd) applyChange(change *applyChange) error {
+	switch {
+	case change.kind == manifestKindConsumer && change.action == "delete":
+		return c.mgr.DeleteConsumer(change.stream, change.consumer)
+
+	case change.kind == manifestKindConsumer:
+		_, err := c.mgr.NewConsumerFromDefault(change.stream, *change.consumerCfg)
+		return err
+
+	case change.action == "delete":
+		return c.mgr.DeleteStream(change.stream)
+
+	case change.action == "create":
+		_, err := c.mgr.NewStreamFromDefault(change.stream, *change.streamCfg)
+		return err
+
+	default:
+		str, err := c.mgr.LoadStream(change.stream)
+		if err != nil {
+			return err
+		}
+
+		return str.UpdateConfiguration(*change.streamCfg)
+	}
+}
+
+func (c *applyCmd) renderPlan(changes []*applyChange) {
+	if len(changes) == 0 {
+		fmt.Println("No changes, JetStream assets match the manifests")
+		return
+	}
+
+	var create, update, del int
+
+	fmt.Println("JetStream asset changes:")
+	fmt.Println()
+
+	for _, change := range changes {
+		switch change.action {
+		case "create":
+			create++
+			fmt.Printf("  %s %s\n", color.GreenString("+ create"), change)
+		case "update":
+			update++
+			fmt.Printf("  %s %s\n", color.YellowString("~ update"), change)
+			fmt.Println()
+			fmt.Println(leftPad(strings.TrimRight(change.diff, "\n"), 6))
+			fmt.Println()
+		case "delete":
+			del++
+			fmt.Printf("  %s %s\n", color.RedString("- delete"), change)
+		}
+	}
+
+	fmt.Println()
+	fmt.Printf("Plan: %d to create, %d to update, %d to delete\n", create, update, del)
+}
+
+func (c *applyCmd) plan() ([]*applyChange, error) {
+	manifests, err := loadAssetManifests(c.paths)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(manifests) == 0 {
+		return nil, fmt.Errorf("no manifests found in %s", strings.Join(c.paths, ", "))
+	}
+
+	_, c.mgr, err = prepareHelper("", natsOpts()...)
+	if err != nil {
+		return nil, fmt.Errorf("setup failed: %v", err)
+	}
+
+	var streams []*assetManifest
+	var consumers []*assetManifest
+	for _, m := range manifests {
+		if m.Kind == manifestKindConsumer {
+			consumers = append(consumers, m)
+		} else {
+			streams = append(streams, m)
+		}
+	}
+
+	var changes []*applyChange
+	var streamCfgs []api.StreamConfig
+	managedKinds := map[string]bool{}
+	streamManifests := map[string]*assetManifest{}
+	managedStreams := map[string]bool{}
+	managedConsumers := map[string]bool{}
+
+	for _, m := range streams {
+		var cfg api.StreamConfig
+		err = json.Unmarshal(m.Config, &cfg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stream configuration in %s: %w", m.file, err)
+		}
+
+		if managedStreams[cfg.Name] {
+			return nil, fmt.Errorf("stream %s is defined in multiple manifests", cfg.Name)
+		}
+
+		managedStreams[cfg.Name] = true
+		managedKinds[m.Kind] = true
+		streamManifests[cfg.Name] = m
+		streamCfgs = append(streamCfgs, cfg)
+	}
+
+	ordered, err := sortStreamsByDependencies(streamCfgs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cfg := range ordered {
+		m := streamManifests[cfg.Name]
+
+		known, err := c.mgr.IsKnownStream(cfg.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		if !known {
+			var desired api.StreamConfig
+			err = overlayConfig(manifestStreamDefaults(m.Kind, cfg.Name), m.Config, &desired)
+			if err != nil {
+				return nil, err
+			}
+
+			// like nats.go the duplicate window of a bucket can not exceed its ttl
+			if m.Kind == manifestKindKV && desired.MaxAge > 0 && desired.MaxAge < desired.Duplicates {
+				desired.Duplicates = desired.MaxAge
+			}
+
+			changes = append(changes, &applyChange{action: "create", kind: m.Kind, stream: cfg.Name, streamCfg: &desired})
+			continue
+		}
+
+		str, err := c.mgr.LoadStream(cfg.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		var desired api.StreamConfig
+		err = overlayConfig(str.Configuration(), m.Config, &desired)
+		if err != nil {
+			return nil, err
+		}
+
+		diff := configDiff(str.Configuration(), desired)
+		if diff != "" {
+			changes = append(changes, &applyChange{action: "update", kind: m.Kind, stream: cfg.Name, streamCfg: &desired, diff: diff})
+		}
+	}
+
+	for _, m := range consumers {
+		var cfg api.ConsumerConfig
+		err = json.Unmarshal(m.Config, &cfg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid consumer configuration in %s: %w", m.file, err)
+		}
+
+		name := cfg.Durable
+		if name == "" {
+			name = cfg.Name
+		}
+		if name == "" {
+			return nil, fmt.Errorf("consumer in %s is not durable", m.file)
+		}
+
+		id := m.Stream + " > " + name
+		if managedConsumers[id] {
+			return nil, fmt.Errorf("consumer %s is defined in multiple manifests", id)
+		}
+		managedConsumers[id] = true
+
+		known := false
+		if !c.isCreating(changes, m.Stream) {
+			known, err = c.mgr.IsKnownConsumer(m.Stream, name)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if !known {
+			var desired api.ConsumerConfig
+			err = overlayConfig(jsm.DefaultConsumer, m.Config, &desired)
+			if err != nil {
+				return nil, err
+			}
+
+			changes = append(changes, &applyChange{action: "create", kind: manifestKindConsumer, stream: m.Stream, consumer: name, consumerCfg: &desired})
+			continue
+		}
+
+		cons, err := c.mgr.LoadConsumer(m.Stream, name)
+		if err != nil {
+			return nil, err
+		}
+
+		var desired api.ConsumerConfig
+		err = overlayConfig(cons.Configuration(), m.Config, &desired)
+		if err != nil {
+			return nil, err
+		}
+
+		diff := configDiff(cons.Configuration(), desired)
+		if diff != "" {
+			changes = append(changes, &applyChange{action: "update", kind: manifestKindConsumer, stream: m.Stream, consumer: name, consumerCfg: &desired, diff: diff})
+		}
+	}
+
+	if !c.prune {
+		return changes, nil
+	}
+
+	pruned, err := c.pruneChanges(managedKinds, managedStreams, managedConsumers)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(changes, pruned...), nil
+}
+
+func (c *applyCmd) isCreating(changes []*applyChange, stream string) bool {
+	for _, change := range changes {
+		if change.kind != manifestKindConsumer && change.stream == stream && change.action == "create" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pruneChanges finds durable consumers on managed streams and streams of the managed kinds that are not in
+// the manifests, consumers are removed before streams and streams that are copied from are removed last
+func (c *applyCmd) pruneChanges(managedKinds map[string]bool, managedStreams map[string]bool, managedConsumers map[string]bool) ([]*applyChange, error) {
+	var changes []*applyChange
+	var unmanaged []api.StreamConfig
+
+	streams, missing, err := c.mgr.Streams(nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("could not obtain stream information for %d streams", len(missing))
+	}
+
+	for _, str := range streams {
+		if jsm.IsMQTTStateStream(str.Name()) {
+			continue
+		}
+
+		if !managedStreams[str.Name()] {
+			if managedKinds[streamKind(str.Name())] {
+				unmanaged = append(unmanaged, str.Configuration())
+			}
+			continue
+		}
+
+		_, err = str.EachConsumer(func(cons *jsm.Consumer) {
+			if !cons.IsDurable() || managedConsumers[str.Name()+" > "+cons.Name()] {
+				return
+			}
+
+			changes = append(changes, &applyChange{action: "delete", kind: manifestKindConsumer, stream: str.Name(), consumer: cons.Name()})
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ordered, err := sortStreamsByDependencies(unmanaged)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(ordered) - 1; i >= 0; i-- {
+		changes = append(changes, &applyChange{action: "delete", kind: streamKind(ordered[i].Name), stream: ordered[i].Name})
+	}
+
+	return changes, nil
+}
+
+// streamKind is the manifest kind of the stream called name
+func streamKind(name string) string {
+	switch {
+	case jsm.IsKVBucketStream(name):
+		return manifestKindKV
+	case jsm.IsObjectBucketStream(name):
+		return manifestKindObject
+	default:
+		return manifestKindStream
+	}
+}
+
+// overlayConfig replaces the top level keys found in manifest in the current configuration and stores the result in target
+func overlayConfig(current any, manifest json.RawMessage, target any) error {
+	cj, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+
+	var merged map[string]json.RawMessage
+	err = json.Unmarshal(cj, &merged)
+	if err != nil {
+		return err
+	}
+
+	var overlay map[string]json.RawMessage
+	err = json.Unmarshal(manifest, &overlay)
+	if err != nil {
+		return err
+	}
+
+	for k, v := range overlay {
+		merged[k] = v
+	}
+
+	mj, err := json.Marshal(merged)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(mj, target)
+}
+
+// sortStreamsByDependencies orders streams so that the origins of mirrors and sources come before the streams that copy from them
+func sortStreamsByDependencies(streams []api.StreamConfig) ([]api.StreamConfig, error) {
+	known := map[string]api.StreamConfig{}
+	var names []string
+	for _, s := range streams {
+		known[s.Name] = s
+		names = append(names, s.Name)
+	}
+	sort.Strings(names)
+
+	deps := func(s api.StreamConfig) []string {
+		var res []string
+		if s.Mirror != nil {
+			res = append(res, s.Mirror.Name)
+		}
+		for _, source := range s.Sources {
+			res = append(res, source.Name)
+		}
+
+		return res
+	}
+
+	var ordered []api.StreamConfig
+	done := map[string]bool{}
+	visiting := map[string]bool{}
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		if done[name] {
+			return nil
+		}
+		if visiting[name] {
+			return fmt.Errorf("stream %s is part of a mirror or source loop", name)
+		}
+
+		visiting[name] = true
+		for _, dep := range deps(known[name]) {
+			if _, ok := known[dep]; !ok {
+				continue
+			}
+
+			err := visit(dep)
+			if err != nil {
+				return err
+			}
+		}
+		visiting[name] = false
+		done[name] = true
+		ordered = append(ordered, known[name])
+
+		return nil
+	}
+
+	for _, name := range names {
+		err := visit(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ordered, nil
+}
+
+// loadAssetManifests loads all JSON and YAML manifests found in paths, directories are searched recursively
+func loadAssetManifests(paths []string) ([]*assetManifest, error) {
+	var manifests []*assetManifest
+
+	for _, path := range paths {
+		err := filepath.WalkDir(path, func(file string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if d.IsDir() {
+				return nil
+			}
+
+			switch strings.ToLower(filepath.Ext(file)) {
+			case ".json", ".yaml", ".yml":
+			default:
+				return nil
+			}
+
+			m, err := loadAssetManifest(file)
+			if err != nil {
+				return fmt.Errorf("could not load manifest %s: %w", file, err)
+			}
+
+			manifests = append(manifests, m)
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return manifests, nil
+}
+
+func loadAssetManifest(file string) (*assetManifest, error) {
+	body, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if ext := strings.ToLower(filepath.Ext(file)); ext == ".yaml" || ext == ".yml" {
+		body, err = yaml.YAMLToJSON(body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var keys map[string]json.RawMessage
+	err = json.Unmarshal(body, &keys)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &assetManifest{file: file}
+
+	// bare stream configurations are supported like in stream add --config
+	if _, ok := keys["config"]; ok {
+		err = json.Unmarshal(body, m)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		m.Config = body
+	}
+
+	var cfg struct {
+		Name string `json:"name"`
+	}
+	err = json.Unmarshal(m.Config, &cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.Kind == "" {
+		if m.Stream != "" {
+			m.Kind = manifestKindConsumer
+		} else {
+			m.Kind = streamKind(cfg.Name)
+		}
+	}
+
+	switch m.Kind {
+	case manifestKindConsumer:
+		if m.Stream == "" {
+			return nil, fmt.Errorf("consumer manifests require a stream_name")
+		}
+	case manifestKindStream:
+	case manifestKindKV:
+		if !jsm.IsKVBucketStream(cfg.Name) {
+			return nil, fmt.Errorf("KV bucket stream names must start with KV_")
+		}
+	case manifestKindObject:
+		if !jsm.IsObjectBucketStream(cfg.Name) {
+			return nil, fmt.Errorf("object store bucket stream names must start with OBJ_")
+		}
+	default:
+		return nil, fmt.Errorf("unknown kind %q", m.Kind)
+	}
+
+	if m.Kind != manifestKindConsumer && cfg.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+
+	return m, nil
+}
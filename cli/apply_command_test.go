@@ -0,0 +1,150 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nats-io/jsm.go"
+	"github.com/nats-io/jsm.go/api"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+func TestSortStreamsByDependencies(t *testing.T) {
+	ordered, err := sortStreamsByDependencies([]api.StreamConfig{
+		{Name: "AGGREGATE", Sources: []*api.StreamSource{{Name: "ORDERS"}, {Name: "REMOTE"}}},
+		{Name: "BACKUP", Mirror: &api.StreamSource{Name: "AGGREGATE"}},
+		{Name: "ORDERS"},
+	})
+	assertNoError(t, err)
+
+	var names []string
+	for _, s := range ordered {
+		names = append(names, s.Name)
+	}
+
+	if len(names) != 3 || names[0] != "ORDERS" || names[1] != "AGGREGATE" || names[2] != "BACKUP" {
+		t.Fatalf("invalid order: %v", names)
+	}
+
+	_, err = sortStreamsByDependencies([]api.StreamConfig{
+		{Name: "A", Sources: []*api.StreamSource{{Name: "B"}}},
+		{Name: "B", Sources: []*api.StreamSource{{Name: "A"}}},
+	})
+	if err == nil {
+		t.Fatalf("expected loop error")
+	}
+}
+
+func TestOverlayConfig(t *testing.T) {
+	current := api.StreamConfig{Name: "ORDERS", Subjects: []string{"ORDERS.*"}, MaxMsgs: 100, Metadata: map[string]string{"a": "1", "b": "2"}}
+
+	var desired api.StreamConfig
+	err := overlayConfig(current, []byte(`{"max_msgs": 200, "metadata": {"a": "1"}}`), &desired)
+	assertNoError(t, err)
+
+	if desired.MaxMsgs != 200 {
+		t.Fatalf("max msgs was not updated: %d", desired.MaxMsgs)
+	}
+	if desired.Name != "ORDERS" || len(desired.Subjects) != 1 {
+		t.Fatalf("unmanaged keys were not kept: %#v", desired)
+	}
+	if len(desired.Metadata) != 1 {
+		t.Fatalf("metadata was not replaced: %v", desired.Metadata)
+	}
+}
+
+func TestApplyPlan(t *testing.T) {
+	withJetStream(t, func(_ *server.Server, nc *nats.Conn, mgr *jsm.Manager) {
+		js, err := nc.JetStream()
+		assertNoError(t, err)
+		_, err = js.CreateKeyValue(&nats.KeyValueConfig{Bucket: "OTHER"})
+		assertNoError(t, err)
+
+		_, err = mgr.NewStreamFromDefault("ORDERS", applyStreamDefaults, jsm.Subjects("ORDERS.*"), jsm.MemoryStorage(), jsm.MaxMessages(10))
+		assertNoError(t, err)
+		_, err = mgr.NewStreamFromDefault("OLD", applyStreamDefaults, jsm.Subjects("OLD.*"), jsm.MemoryStorage())
+		assertNoError(t, err)
+
+		dir := t.TempDir()
+		manifests := map[string]string{
+			"orders.yaml":   "config:\n  name: ORDERS\n  max_msgs: 100\n",
+			"archive.json":  `{"name":"ARCHIVE","storage":"memory","sources":[{"name":"ORDERS"}]}`,
+			"consumer.json": `{"stream_name":"ARCHIVE","config":{"durable_name":"C1","ack_policy":"explicit"}}`,
+			"README.md":     "ignored",
+		}
+		for f, body := range manifests {
+			assertNoError(t, os.WriteFile(filepath.Join(dir, f), []byte(body), 0600))
+		}
+
+		cmd := &applyCmd{paths: []string{dir}, prune: true}
+		changes, err := cmd.plan()
+		assertNoError(t, err)
+
+		var actions []string
+		for _, change := range changes {
+			actions = append(actions, change.action+" "+change.String())
+		}
+
+		expected := []string{"update stream ORDERS", "create stream ARCHIVE", "create consumer ARCHIVE > C1", "delete stream OLD"}
+		if len(actions) != len(expected) {
+			t.Fatalf("invalid plan: %v", actions)
+		}
+		for i := range expected {
+			if actions[i] != expected[i] {
+				t.Fatalf("invalid plan: %v", actions)
+			}
+		}
+
+		for _, change := range changes {
+			assertNoError(t, cmd.applyChange(change))
+		}
+
+		changes, err = cmd.plan()
+		assertNoError(t, err)
+		if len(changes) != 0 {
+			t.Fatalf("expected no changes after apply, got %d", len(changes))
+		}
+
+		// buckets are only pruned once kv manifests are managed and are created like kv add would
+		assertNoError(t, os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"name":"KV_CONFIG","max_msgs_per_subject":5}`), 0600))
+		changes, err = cmd.plan()
+		assertNoError(t, err)
+		if len(changes) != 2 || changes[0].action+" "+changes[0].String() != "create kv KV_CONFIG" || changes[1].action+" "+changes[1].String() != "delete kv KV_OTHER" {
+			t.Fatalf("invalid plan: %v", changes)
+		}
+
+		for _, change := range changes {
+			assertNoError(t, cmd.applyChange(change))
+		}
+
+		kv, err := js.KeyValue("CONFIG")
+		assertNoError(t, err)
+		_, err = kv.PutString("x", "y")
+		assertNoError(t, err)
+		status, err := kv.Status()
+		assertNoError(t, err)
+		if status.History() != 5 {
+			t.Fatalf("expected history 5 got %d", status.History())
+		}
+		str, err := mgr.LoadStream("KV_CONFIG")
+		assertNoError(t, err)
+		if str.DiscardPolicy() != api.DiscardNew || !str.DirectAllowed() || !str.Configuration().DenyDelete {
+			t.Fatalf("bucket created with stream defaults: %+v", str.Configuration())
+		}
+	})
+}
@@ -0,0 +1,522 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/choria-io/fisk"
+	"github.com/nats-io/nats.go"
+)
+
+type BucketMountCmd struct {
+	bucket     string
+	mountPoint string
+	separator  string
+	allowOther bool
+}
+
+// bucketFile is a key or object exposed as a file in a mounted bucket
+type bucketFile struct {
+	name     string
+	size     uint64
+	modified time.Time
+}
+
+// bucketValueFile is the file in a directory exposing the name that is also the prefix of the names in the directory
+const bucketValueFile = ".value"
+
+// bucketTreeNode is a directory, a file or both when a name is also the prefix of other names
+type bucketTreeNode struct {
+	children map[string]*bucketTreeNode
+	file     *bucketFile
+}
+
+// bucketTree maps the names in a bucket to directories using a separator
+type bucketTree struct {
+	mu   sync.RWMutex
+	sep  string
+	root *bucketTreeNode
+}
+
+// bucketDirEntry is a single entry in a directory of a bucketTree
+type bucketDirEntry struct {
+	name string
+	dir  bool
+	file *bucketFile
+}
+
+// bucketSource provides the content of a mounted bucket
+type bucketSource interface {
+	// watch populates tree with the current content and keeps it updated until ctx is done
+	watch(ctx context.Context, tree *bucketTree) error
+	// open opens the key or object name for reading returning its size at the time it was opened
+	open(name string) (io.ReadCloser, uint64, error)
+}
+
+func configureKVMountCommand(kv *fisk.CmdClause) {
+	c := &BucketMountCmd{}
+
+	mount := kv.Command("mount", "Mounts a bucket as a read only file system").Action(c.kvMountAction)
+	mount.HelpLong(`Mounts a bucket using FUSE making every key a file, keys are split into
+directories using the separator. When a key is also the prefix of other keys,
+like app when app.port exists, its value is the file .value in the directory.
+
+The file system reflects changes to the bucket while mounted and is unmounted
+on interrupt. FUSE support is required, mounting is tested on Linux only.
+`)
+	mount.Arg("bucket", "The bucket to mount").Required().StringVar(&c.bucket)
+	mount.Arg("directory", "The directory to mount the bucket on").Required().ExistingDirVar(&c.mountPoint)
+	mount.Flag("separator", "The separator used to split keys into directories").Default(".").StringVar(&c.separator)
+	mount.Flag("allow-other", "Allows other users to access the file system").UnNegatableBoolVar(&c.allowOther)
+}
+
+func configureObjectMountCommand(obj *fisk.CmdClause) {
+	c := &BucketMountCmd{}
+
+	mount := obj.Command("mount", "Mounts a bucket as a read only file system").Action(c.objectMountAction)
+	mount.HelpLong(`Mounts a bucket using FUSE making every object a file, object names are
+split into directories using the separator. Links to objects are followed,
+links to buckets are not shown. When a name is also the prefix of other names
+the object is the file .value in the directory.
+
+The file system reflects changes to the bucket while mounted and is unmounted
+on interrupt. FUSE support is required, mounting is tested on Linux only.
+`)
+	mount.Arg("bucket", "The bucket to mount").Required().StringVar(&c.bucket)
+	mount.Arg("directory", "The directory to mount the bucket on").Required().ExistingDirVar(&c.mountPoint)
+	mount.Flag("separator", "The separator used to split object names into directories").Default("/").StringVar(&c.separator)
+	mount.Flag("allow-other", "Allows other users to access the file system").UnNegatableBoolVar(&c.allowOther)
+}
+
+func (c *BucketMountCmd) kvMountAction(_ *fisk.ParseContext) error {
+	_, js, err := prepareJSHelper()
+	fisk.FatalIfError(err, "setup failed")
+
+	store, err := js.KeyValue(c.bucket)
+	if err != nil {
+		return err
+	}
+
+	return c.mount(&kvBucketSource{store: store})
+}
+
+func (c *BucketMountCmd) objectMountAction(_ *fisk.ParseContext) error {
+	_, js, err := prepareJSHelper()
+	fisk.FatalIfError(err, "setup failed")
+
+	store, err := js.ObjectStore(c.bucket)
+	if err != nil {
+		return err
+	}
+
+	return c.mount(&objectBucketSource{js: js, store: store})
+}
+
+func (c *BucketMountCmd) mount(source bucketSource) error {
+	ctx, cancel := signal.NotifyContext(ctx, syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	tree := newBucketTree(c.separator)
+
+	err := source.watch(ctx, tree)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Mounting bucket %s on %s, press ^C to unmount", c.bucket, c.mountPoint)
+
+	return mountBucketTree(ctx, c.mountPoint, c.bucket, tree, source, c.allowOther)
+}
+
+func newBucketTree(sep string) *bucketTree {
+	return &bucketTree{sep: sep, root: &bucketTreeNode{}}
+}
+
+// components splits name into path components, empty components are skipped and / is escaped when not the separator
+func (t *bucketTree) components(name string) []string {
+	var parts []string
+	for _, p := range strings.Split(name, t.sep) {
+		if p != "" {
+			parts = append(parts, strings.ReplaceAll(p, "/", "%2F"))
+		}
+	}
+
+	return parts
+}
+
+// put adds or updates a file
+func (t *bucketTree) put(file *bucketFile) {
+	parts := t.components(file.name)
+	if len(parts) == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	node := t.root
+	for _, p := range parts {
+		if node.children == nil {
+			node.children = map[string]*bucketTreeNode{}
+		}
+
+		child, ok := node.children[p]
+		if !ok {
+			child = &bucketTreeNode{}
+			node.children[p] = child
+		}
+		node = child
+	}
+
+	node.file = file
+}
+
+// remove removes a file and any directories left empty
+func (t *bucketTree) remove(name string) {
+	parts := t.components(name)
+	if len(parts) == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	nodes := []*bucketTreeNode{t.root}
+	node := t.root
+	for _, p := range parts {
+		child, ok := node.children[p]
+		if !ok {
+			return
+		}
+		nodes = append(nodes, child)
+		node = child
+	}
+
+	node.file = nil
+
+	for i := len(parts) - 1; i >= 0; i-- {
+		n := nodes[i+1]
+		if n.file != nil || len(n.children) > 0 {
+			return
+		}
+		delete(nodes[i].children, parts[i])
+	}
+}
+
+// find finds the node at path, a path made of components separated by /, the lock must be held
+func (t *bucketTree) find(path string) (*bucketTreeNode, string) {
+	node := t.root
+	var name string
+	for _, p := range strings.Split(path, "/") {
+		if p == "" {
+			continue
+		}
+
+		child, ok := node.children[p]
+		if !ok {
+			return nil, ""
+		}
+		node = child
+		name = p
+	}
+
+	return node, name
+}
+
+// lookup finds the entry at path, a bucketValueFile in a directory is the file of the directory itself
+func (t *bucketTree) lookup(path string) (*bucketDirEntry, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	node, name := t.find(path)
+	if node != nil {
+		return node.entry(name), true
+	}
+
+	dir, base := "", path
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		dir, base = path[:i], path[i+1:]
+	}
+	if base != bucketValueFile {
+		return nil, false
+	}
+
+	node, _ = t.find(dir)
+	if node == nil || node.file == nil || len(node.children) == 0 {
+		return nil, false
+	}
+
+	return &bucketDirEntry{name: bucketValueFile, file: node.file}, true
+}
+
+// list lists the entries in the directory at path sorted by name
+func (t *bucketTree) list(path string) ([]*bucketDirEntry, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	node, name := t.find(path)
+	if node == nil || !node.entry(name).dir {
+		return nil, false
+	}
+
+	var entries []*bucketDirEntry
+	for name, child := range node.children {
+		entries = append(entries, child.entry(name))
+	}
+	if _, ok := node.children[bucketValueFile]; !ok && node.file != nil {
+		entries = append(entries, &bucketDirEntry{name: bucketValueFile, file: node.file})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+
+	return entries, true
+}
+
+func (n *bucketTreeNode) entry(name string) *bucketDirEntry {
+	if n.file != nil && len(n.children) == 0 {
+		return &bucketDirEntry{name: name, file: n.file}
+	}
+
+	return &bucketDirEntry{name: name, dir: true}
+}
+
+// kvBucketSource exposes the keys in a KV bucket
+type kvBucketSource struct {
+	store nats.KeyValue
+}
+
+func (s *kvBucketSource) watch(ctx context.Context, tree *bucketTree) error {
+	watch, err := s.store.WatchAll(nats.Context(ctx))
+	if err != nil {
+		return err
+	}
+
+	update := func(entry nats.KeyValueEntry) {
+		if entry.Operation() == nats.KeyValuePut {
+			tree.put(&bucketFile{name: entry.Key(), size: uint64(len(entry.Value())), modified: entry.Created()})
+		} else {
+			tree.remove(entry.Key())
+		}
+	}
+
+	for entry := range watch.Updates() {
+		if entry == nil {
+			break
+		}
+		update(entry)
+	}
+
+	go func() {
+		defer watch.Stop()
+
+		for entry := range watch.Updates() {
+			if entry != nil {
+				update(entry)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (s *kvBucketSource) open(name string) (io.ReadCloser, uint64, error) {
+	entry, err := s.store.Get(name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return io.NopCloser(bytes.NewReader(entry.Value())), uint64(len(entry.Value())), nil
+}
+
+// objectBucketSource exposes the objects in an object store bucket
+type objectBucketSource struct {
+	js    nats.JetStreamContext
+	store nats.ObjectStore
+}
+
+func (s *objectBucketSource) watch(ctx context.Context, tree *bucketTree) error {
+	watch, err := s.store.Watch(nats.Context(ctx))
+	if err != nil {
+		return err
+	}
+
+	update := func(nfo *nats.ObjectInfo) {
+		if nfo.Deleted || isObjectBucketLink(nfo) {
+			tree.remove(nfo.Name)
+			return
+		}
+
+		size := nfo.Size
+		if isObjectLink(nfo) {
+			_, target, err := resolveObject(s.js, s.store, nfo.Name)
+			if err != nil {
+				tree.remove(nfo.Name)
+				return
+			}
+			size = target.Size
+		}
+
+		tree.put(&bucketFile{name: nfo.Name, size: size, modified: nfo.ModTime})
+	}
+
+	for nfo := range watch.Updates() {
+		if nfo == nil {
+			break
+		}
+		update(nfo)
+	}
+
+	go func() {
+		defer watch.Stop()
+
+		for nfo := range watch.Updates() {
+			if nfo != nil {
+				update(nfo)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (s *objectBucketSource) open(name string) (io.ReadCloser, uint64, error) {
+	store, target, err := resolveObject(s.js, s.store, name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	res, err := store.Get(target.Name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	nfo, err := res.Info()
+	if err != nil {
+		res.Close()
+		return nil, 0, err
+	}
+
+	return res, nfo.Size, nil
+}
+
+// bucketFileReader reads a file from a bucketSource at arbitrary offsets. The file is opened once and what was
+// read is kept in a temporary file so out of order reads, like those made by the kernel when reading ahead, do not
+// read the file from the bucket again
+type bucketFileReader struct {
+	mu      sync.Mutex
+	source  bucketSource
+	name    string
+	r       io.ReadCloser
+	size    uint64
+	spool   *os.File
+	spooled int64
+}
+
+// open opens the file unless already open and returns its size
+func (b *bucketFileReader) open() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.size, b.openLocked()
+}
+
+func (b *bucketFileReader) openLocked() error {
+	if b.r != nil {
+		return nil
+	}
+
+	r, size, err := b.source.open(b.name)
+	if err != nil {
+		return err
+	}
+
+	spool, err := os.CreateTemp("", "nats-mount-*")
+	if err != nil {
+		r.Close()
+		return err
+	}
+
+	b.r = r
+	b.size = size
+	b.spool = spool
+
+	return nil
+}
+
+func (b *bucketFileReader) ReadAt(p []byte, off int64) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	err := b.openLocked()
+	if err != nil {
+		return 0, err
+	}
+
+	end := off + int64(len(p))
+	if end > int64(b.size) {
+		end = int64(b.size)
+	}
+
+	if end > b.spooled {
+		n, err := io.CopyN(b.spool, b.r, end-b.spooled)
+		b.spooled += n
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+	}
+
+	if off >= b.spooled {
+		return 0, io.EOF
+	}
+
+	want := len(p)
+	if int64(want) > b.spooled-off {
+		p = p[:b.spooled-off]
+	}
+
+	n, err := b.spool.ReadAt(p, off)
+	if err == nil && n < want {
+		err = io.EOF
+	}
+
+	return n, err
+}
+
+func (b *bucketFileReader) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.r == nil {
+		return nil
+	}
+
+	err := b.r.Close()
+	b.spool.Close()
+	os.Remove(b.spool.Name())
+	b.r = nil
+	b.spool = nil
+	b.spooled = 0
+
+	return err
+}
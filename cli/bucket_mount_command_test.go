@@ -0,0 +1,176 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+)
+
+type testBucketSource struct {
+	content map[string][]byte
+	opened  int
+}
+
+func (s *testBucketSource) watch(_ context.Context, _ *bucketTree) error { return nil }
+
+func (s *testBucketSource) open(name string) (io.ReadCloser, uint64, error) {
+	s.opened++
+	return io.NopCloser(bytes.NewReader(s.content[name])), uint64(len(s.content[name])), nil
+}
+
+func TestBucketTree(t *testing.T) {
+	tree := newBucketTree(".")
+	for _, name := range []string{"app.port", "app.host", "app.tls.cert", "db", "weird..name", "path/like"} {
+		tree.put(&bucketFile{name: name, size: uint64(len(name))})
+	}
+
+	names := func(path string) []string {
+		entries, ok := tree.list(path)
+		if !ok {
+			t.Fatalf("could not list %q", path)
+		}
+
+		var res []string
+		for _, e := range entries {
+			if e.dir {
+				res = append(res, e.name+"/")
+			} else {
+				res = append(res, e.name)
+			}
+		}
+		return res
+	}
+
+	checkList := func(path string, expect ...string) {
+		t.Helper()
+		got := names(path)
+		if len(got) != len(expect) {
+			t.Fatalf("expected %v in %q got %v", expect, path, got)
+		}
+		for i := range got {
+			if got[i] != expect[i] {
+				t.Fatalf("expected %v in %q got %v", expect, path, got)
+			}
+		}
+	}
+
+	checkList("", "app/", "db", "path%2Flike", "weird/")
+	checkList("app", "host", "port", "tls/")
+	checkList("weird", "name")
+
+	entry, ok := tree.lookup("app/tls/cert")
+	if !ok || entry.dir || entry.file.name != "app.tls.cert" {
+		t.Fatalf("invalid entry %+v", entry)
+	}
+
+	_, ok = tree.list("db")
+	if ok {
+		t.Fatalf("expected files to not be listable")
+	}
+
+	// a key that is also a prefix is shown as a directory holding its value
+	tree.put(&bucketFile{name: "app"})
+	entry, _ = tree.lookup("app")
+	if !entry.dir {
+		t.Fatalf("expected app to be a directory")
+	}
+	checkList("app", ".value", "host", "port", "tls/")
+	entry, ok = tree.lookup("app/.value")
+	if !ok || entry.dir || entry.file.name != "app" {
+		t.Fatalf("invalid value entry %+v", entry)
+	}
+	_, ok = tree.lookup("app/tls/.value")
+	if ok {
+		t.Fatalf("expected no value for a directory without a key")
+	}
+
+	tree.remove("app.tls.cert")
+	checkList("app", ".value", "host", "port")
+	_, ok = tree.lookup("app/tls")
+	if ok {
+		t.Fatalf("expected empty directory to be removed")
+	}
+
+	tree.remove("app.host")
+	tree.remove("app.port")
+	entry, _ = tree.lookup("app")
+	if entry.dir || entry.file.name != "app" {
+		t.Fatalf("expected app to be a file once its children were removed: %+v", entry)
+	}
+
+	tree.remove("app")
+	tree.remove("missing.key")
+	checkList("", "db", "path%2Flike", "weird/")
+}
+
+func TestBucketFileReader(t *testing.T) {
+	source := &testBucketSource{content: map[string][]byte{"file": []byte("0123456789")}}
+	r := &bucketFileReader{source: source, name: "file"}
+	defer r.Close()
+
+	read := func(size int, off int64) string {
+		t.Helper()
+		buf := make([]byte, size)
+		n, err := r.ReadAt(buf, off)
+		if err != nil && err != io.EOF {
+			t.Fatalf("read failed: %v", err)
+		}
+		return string(buf[:n])
+	}
+
+	if v := read(4, 0); v != "0123" {
+		t.Fatalf("invalid read %q", v)
+	}
+	if v := read(4, 4); v != "4567" {
+		t.Fatalf("invalid read %q", v)
+	}
+	if v := read(4, 8); v != "89" {
+		t.Fatalf("invalid read %q", v)
+	}
+	if source.opened != 1 {
+		t.Fatalf("expected sequential reads to use one reader, opened %d times", source.opened)
+	}
+
+	if v := read(3, 2); v != "234" {
+		t.Fatalf("invalid read %q", v)
+	}
+	if v := read(2, 7); v != "78" {
+		t.Fatalf("invalid read %q", v)
+	}
+	if v := read(2, 12); v != "" {
+		t.Fatalf("invalid read past the end %q", v)
+	}
+	if source.opened != 1 {
+		t.Fatalf("expected out of order reads to use the read data, opened %d times", source.opened)
+	}
+
+	// the size is that of the value that was opened even when it changed since
+	source.content["file"] = []byte("0123456789abc")
+	r = &bucketFileReader{source: source, name: "file"}
+	defer r.Close()
+	size, err := r.open()
+	assertNoError(t, err)
+	if size != 13 {
+		t.Fatalf("expected size 13 got %d", size)
+	}
+	if v := read(4, 8); v != "89ab" {
+		t.Fatalf("invalid read %q", v)
+	}
+	if v := read(8, 0); v != "01234567" {
+		t.Fatalf("invalid read %q", v)
+	}
+}
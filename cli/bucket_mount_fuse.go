@@ -0,0 +1,186 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || darwin
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"syscall"
+	"time"
+
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// bucketFSNode is a file or directory in a mounted bucket, content is looked up in the tree on every access
+type bucketFSNode struct {
+	fusefs.Inode
+
+	tree   *bucketTree
+	source bucketSource
+	path   string
+}
+
+var (
+	_ = (fusefs.NodeLookuper)((*bucketFSNode)(nil))
+	_ = (fusefs.NodeReaddirer)((*bucketFSNode)(nil))
+	_ = (fusefs.NodeGetattrer)((*bucketFSNode)(nil))
+	_ = (fusefs.NodeOpener)((*bucketFSNode)(nil))
+	_ = (fusefs.FileReader)((*bucketFSHandle)(nil))
+	_ = (fusefs.FileReleaser)((*bucketFSHandle)(nil))
+)
+
+// bucketFSHandle is an open file in a mounted bucket
+type bucketFSHandle struct {
+	reader *bucketFileReader
+	size   uint64
+}
+
+func mountBucketTree(ctx context.Context, dir string, bucket string, tree *bucketTree, source bucketSource, allowOther bool) error {
+	timeout := time.Second
+	root := &bucketFSNode{tree: tree, source: source}
+
+	server, err := fusefs.Mount(dir, root, &fusefs.Options{
+		EntryTimeout:    &timeout,
+		AttrTimeout:     &timeout,
+		NegativeTimeout: &timeout,
+		MountOptions: fuse.MountOptions{
+			FsName:      bucket,
+			Name:        "nats",
+			AllowOther:  allowOther,
+			DirectMount: true,
+			Debug:       opts.Trace,
+			Options:     []string{"ro"},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		err := server.Unmount()
+		if err != nil {
+			log.Printf("Could not unmount %s: %s", dir, err)
+		}
+	}()
+
+	server.Wait()
+
+	return nil
+}
+
+func (n *bucketFSNode) setAttr(entry *bucketDirEntry, out *fuse.Attr) {
+	if entry.dir {
+		out.Mode = fuse.S_IFDIR | 0555
+		return
+	}
+
+	out.Mode = fuse.S_IFREG | 0444
+	out.Size = entry.file.size
+	out.SetTimes(nil, &entry.file.modified, &entry.file.modified)
+}
+
+func (n *bucketFSNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fusefs.Inode, syscall.Errno) {
+	p := path.Join(n.path, name)
+
+	entry, ok := n.tree.lookup(p)
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+
+	n.setAttr(entry, &out.Attr)
+
+	mode := uint32(fuse.S_IFREG)
+	if entry.dir {
+		mode = fuse.S_IFDIR
+	}
+
+	return n.NewInode(ctx, &bucketFSNode{tree: n.tree, source: n.source, path: p}, fusefs.StableAttr{Mode: mode}), 0
+}
+
+func (n *bucketFSNode) Readdir(_ context.Context) (fusefs.DirStream, syscall.Errno) {
+	entries, ok := n.tree.list(n.path)
+	if !ok {
+		return nil, syscall.ENOTDIR
+	}
+
+	list := make([]fuse.DirEntry, len(entries))
+	for i, entry := range entries {
+		list[i] = fuse.DirEntry{Name: entry.name, Mode: fuse.S_IFREG}
+		if entry.dir {
+			list[i].Mode = fuse.S_IFDIR
+		}
+	}
+
+	return fusefs.NewListDirStream(list), 0
+}
+
+func (n *bucketFSNode) Getattr(_ context.Context, fh fusefs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	entry, ok := n.tree.lookup(n.path)
+	if !ok {
+		return syscall.ENOENT
+	}
+
+	n.setAttr(entry, &out.Attr)
+
+	// open files have the size of the value or object that was opened, which might be newer than the tree
+	if h, ok := fh.(*bucketFSHandle); ok {
+		out.Size = h.size
+	}
+
+	return 0
+}
+
+func (n *bucketFSNode) Open(_ context.Context, flags uint32) (fusefs.FileHandle, uint32, syscall.Errno) {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR|syscall.O_APPEND|syscall.O_TRUNC) != 0 {
+		return nil, 0, syscall.EROFS
+	}
+
+	entry, ok := n.tree.lookup(n.path)
+	if !ok {
+		return nil, 0, syscall.ENOENT
+	}
+	if entry.dir {
+		return nil, 0, syscall.EISDIR
+	}
+
+	reader := &bucketFileReader{source: n.source, name: entry.file.name}
+	size, err := reader.open()
+	if err != nil {
+		log.Printf("Could not open %s: %s", entry.file.name, err)
+		return nil, 0, syscall.EIO
+	}
+
+	return &bucketFSHandle{reader: reader, size: size}, 0, 0
+}
+
+func (h *bucketFSHandle) Read(_ context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	n, err := h.reader.ReadAt(dest, off)
+	if err != nil && !errors.Is(err, io.EOF) {
+		log.Printf("Could not read %s: %s", h.reader.name, err)
+		return nil, syscall.EIO
+	}
+
+	return fuse.ReadResultData(dest[:n]), 0
+}
+
+func (h *bucketFSHandle) Release(_ context.Context) syscall.Errno {
+	h.reader.Close()
+	return 0
+}
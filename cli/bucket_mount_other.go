@@ -0,0 +1,26 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux && !darwin
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+)
+
+func mountBucketTree(_ context.Context, _ string, _ string, _ *bucketTree, _ bucketSource, _ bool) error {
+	return fmt.Errorf("mounting buckets is not supported on %s", runtime.GOOS)
+}
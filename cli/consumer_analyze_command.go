@@ -0,0 +1,366 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/choria-io/fisk"
+	"github.com/nats-io/jsm.go"
+	"github.com/nats-io/jsm.go/api"
+	"github.com/nats-io/jsm.go/api/jetstream/metric"
+	"github.com/nats-io/nats.go"
+)
+
+type ConsumerAnalyzeCmd struct {
+	stream   string
+	consumer string
+	window   time.Duration
+	interval time.Duration
+	json     bool
+
+	mu      sync.Mutex
+	samples []time.Duration
+	redeliv int
+}
+
+// consumerAnalysis is the result of observing a consumer over a period of time
+type consumerAnalysis struct {
+	Stream            string                   `json:"stream"`
+	Consumer          string                   `json:"consumer"`
+	Window            time.Duration            `json:"window"`
+	Polls             int                      `json:"polls"`
+	DeliveryRate      *float64                 `json:"delivery_rate"`
+	AckRate           *float64                 `json:"ack_rate"`
+	DrainRate         float64                  `json:"drain_rate"`
+	Pending           uint64                   `json:"pending"`
+	AckPending        int                      `json:"ack_pending"`
+	DrainETA          time.Duration            `json:"drain_eta,omitempty"`
+	Draining          bool                     `json:"draining"`
+	RedeliveryRatio   float64                  `json:"redelivery_ratio"`
+	SamplingRate      string                   `json:"sampling_rate,omitempty"`
+	AckSamples        int                      `json:"ack_samples"`
+	SampledRedelivery float64                  `json:"sampled_redelivery_ratio"`
+	AckLatency        *latencyStats            `json:"ack_latency,omitempty"`
+	AckHistogram      []*latencyHistogramEntry `json:"ack_latency_histogram,omitempty"`
+}
+
+type latencyStats struct {
+	Min time.Duration `json:"min"`
+	Avg time.Duration `json:"avg"`
+	P50 time.Duration `json:"p50"`
+	P90 time.Duration `json:"p90"`
+	P99 time.Duration `json:"p99"`
+	Max time.Duration `json:"max"`
+}
+
+type latencyHistogramEntry struct {
+	Below time.Duration `json:"below,omitempty"`
+	Count int           `json:"count"`
+}
+
+var latencyHistogramBuckets = []time.Duration{time.Millisecond, 10 * time.Millisecond, 100 * time.Millisecond, time.Second, 10 * time.Second, time.Minute}
+
+func configureConsumerAnalyzeCommand(cons *fisk.CmdClause) {
+	c := &ConsumerAnalyzeCmd{}
+
+	analyze := cons.Command("analyze", "Analyze Consumer progress and acknowledgement latency over time").Action(c.analyzeAction)
+	analyze.HelpLong(`Observes a Consumer for a period of time and reports on its delivery and
+acknowledgement rates, how long it will take to process the backlog and how
+often messages are redelivered.
+
+When the Consumer has acknowledgement sampling enabled, using 'nats consumer
+edit --sample 100', the samples are used to report acknowledgement latency.
+`)
+	analyze.Arg("stream", "Stream name").Required().StringVar(&c.stream)
+	analyze.Arg("consumer", "Consumer name").Required().StringVar(&c.consumer)
+	analyze.Flag("window", "How long to observe the Consumer for").Default("1m").DurationVar(&c.window)
+	analyze.Flag("interval", "How often to gather Consumer state").Default("5s").DurationVar(&c.interval)
+	analyze.Flag("json", "Produce JSON output").Short('j').UnNegatableBoolVar(&c.json)
+}
+
+func (c *ConsumerAnalyzeCmd) analyzeAction(_ *fisk.ParseContext) error {
+	nc, mgr, err := prepareHelper("", natsOpts()...)
+	fisk.FatalIfError(err, "setup failed")
+
+	cons, err := mgr.LoadConsumer(c.stream, c.consumer)
+	if err != nil {
+		return err
+	}
+
+	subj := fmt.Sprintf("%s.%s.%s", jsm.EventSubject(api.JSMetricConsumerAckPre, opts.Config.JSEventPrefix()), c.stream, c.consumer)
+	sub, err := nc.Subscribe(subj, c.handleAckMetric)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	if !c.json {
+		if cons.SampleFrequency() == "" {
+			fmt.Printf("Acknowledgement sampling is not enabled for this Consumer, latency will not be reported\n\n")
+		}
+		fmt.Printf("Observing Consumer %s > %s for %v, press ^C to stop early\n\n", c.stream, c.consumer, c.window)
+	}
+
+	ctx, cancel := signal.NotifyContext(ctx, syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	var polls []*api.ConsumerInfo
+	poll := func() error {
+		nfo, err := cons.State()
+		if err != nil {
+			return err
+		}
+		// older servers do not report the time the state was taken
+		if nfo.TimeStamp.IsZero() {
+			nfo.TimeStamp = time.Now()
+		}
+		polls = append(polls, &nfo)
+		return nil
+	}
+
+	err = poll()
+	if err != nil {
+		return err
+	}
+
+	tick := time.NewTicker(c.interval)
+	defer tick.Stop()
+	timeout := time.NewTimer(c.window)
+	defer timeout.Stop()
+
+	for done := false; !done; {
+		select {
+		case <-tick.C:
+		case <-timeout.C:
+			done = true
+		case <-ctx.Done():
+			done = true
+		}
+
+		err = poll()
+		if err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	analysis := analyzeConsumerPolls(polls, c.samples, c.redeliv)
+	c.mu.Unlock()
+
+	analysis.SamplingRate = cons.SampleFrequency()
+
+	if c.json {
+		return printJSON(analysis)
+	}
+
+	c.render(analysis)
+
+	return nil
+}
+
+func (c *ConsumerAnalyzeCmd) handleAckMetric(m *nats.Msg) {
+	var ack metric.ConsumerAckMetricV1
+	err := json.Unmarshal(m.Data, &ack)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.samples = append(c.samples, time.Duration(ack.Delay))
+	if ack.Deliveries > 1 {
+		c.redeliv++
+	}
+	c.mu.Unlock()
+}
+
+func (c *ConsumerAnalyzeCmd) render(a *consumerAnalysis) {
+	cols := newColumns(fmt.Sprintf("Analysis of Consumer %s > %s over %v", a.Stream, a.Consumer, a.Window.Round(time.Second)))
+	cols.AddRow("Delivery Rate", consumerAnalysisRate(a.DeliveryRate))
+	cols.AddRow("Acknowledgement Rate", consumerAnalysisRate(a.AckRate))
+	if a.DeliveryRate == nil {
+		cols.AddRow("Redelivery Ratio", "unknown")
+	} else {
+		cols.AddRowf("Redelivery Ratio", "%s%%", f(a.RedeliveryRatio*100))
+	}
+	cols.AddSectionTitle("Backlog")
+	cols.AddRow("Unprocessed Messages", a.Pending)
+	cols.AddRow("Outstanding Acks", a.AckPending)
+	cols.AddRowf("Drain Rate", "%s / s", f(a.DrainRate))
+
+	switch {
+	case a.Pending == 0:
+		cols.AddRow("Drain ETA", "drained")
+	case a.Draining:
+		cols.AddRow("Drain ETA", a.DrainETA)
+	default:
+		cols.AddRow("Drain ETA", "never, the backlog is not shrinking")
+	}
+
+	cols.AddSectionTitle("Acknowledgement Samples")
+	cols.AddRowIfNotEmpty("Sampling Rate", a.SamplingRate)
+	cols.AddRow("Samples", a.AckSamples)
+
+	if a.AckLatency != nil {
+		cols.AddRowf("Sampled Redelivery Ratio", "%s%%", f(a.SampledRedelivery*100))
+		cols.AddRow("Minimum Latency", a.AckLatency.Min)
+		cols.AddRow("Average Latency", a.AckLatency.Avg)
+		cols.AddRow("50th Percentile", a.AckLatency.P50)
+		cols.AddRow("90th Percentile", a.AckLatency.P90)
+		cols.AddRow("99th Percentile", a.AckLatency.P99)
+		cols.AddRow("Maximum Latency", a.AckLatency.Max)
+	}
+
+	cols.Println()
+	cols.Frender(os.Stdout)
+
+	if len(a.AckHistogram) == 0 {
+		return
+	}
+
+	table := newTableWriter("Acknowledgement Latency Distribution")
+	table.AddHeaders("Latency", "Samples", "%")
+	for i, bucket := range a.AckHistogram {
+		label := fmt.Sprintf("< %v", bucket.Below)
+		if bucket.Below == 0 {
+			label = fmt.Sprintf(">= %v", latencyHistogramBuckets[i-1])
+		}
+
+		table.AddRow(label, f(bucket.Count), f(float64(bucket.Count)/float64(a.AckSamples)*100))
+	}
+	fmt.Println(table.Render())
+}
+
+// consumerAnalysisRate formats a per second rate that might be unknown
+func consumerAnalysisRate(rate *float64) string {
+	if rate == nil {
+		return "unknown"
+	}
+
+	return fmt.Sprintf("%s / s", f(*rate))
+}
+
+// analyzeConsumerPolls calculates rates from the first and last poll and latency statistics from the ack samples
+func analyzeConsumerPolls(polls []*api.ConsumerInfo, samples []time.Duration, redelivered int) *consumerAnalysis {
+	first := polls[0]
+	last := polls[len(polls)-1]
+
+	a := &consumerAnalysis{
+		Stream:     last.Stream,
+		Consumer:   last.Name,
+		Polls:      len(polls),
+		Window:     last.TimeStamp.Sub(first.TimeStamp),
+		Pending:    last.NumPending,
+		AckPending: last.NumAckPending,
+		AckSamples: len(samples),
+	}
+
+	if a.Window > 0 {
+		secs := a.Window.Seconds()
+
+		// sequences go backwards when the consumer was recreated or reset while sampling, rates are then unknown
+		if last.Delivered.Consumer >= first.Delivered.Consumer && last.Delivered.Stream >= first.Delivered.Stream {
+			deliveries := float64(last.Delivered.Consumer - first.Delivered.Consumer)
+			rate := deliveries / secs
+			a.DeliveryRate = &rate
+
+			// consumer sequences increase for every delivery while stream sequences only for new messages
+			if deliveries > 0 {
+				a.RedeliveryRatio = math.Max(0, (deliveries-float64(last.Delivered.Stream-first.Delivered.Stream))/deliveries)
+			}
+		}
+
+		if last.AckFloor.Consumer >= first.AckFloor.Consumer {
+			rate := float64(last.AckFloor.Consumer-first.AckFloor.Consumer) / secs
+			a.AckRate = &rate
+		}
+
+		// unprocessed messages include ones being worked on
+		before := float64(first.NumPending) + float64(first.NumAckPending)
+		after := float64(last.NumPending) + float64(last.NumAckPending)
+		a.DrainRate = (before - after) / secs
+		if a.DrainRate > 0 {
+			a.Draining = true
+			a.DrainETA = time.Duration(after / a.DrainRate * float64(time.Second)).Round(time.Second)
+		}
+	}
+
+	if len(samples) == 0 {
+		return a
+	}
+
+	a.SampledRedelivery = float64(redelivered) / float64(len(samples))
+	a.AckLatency, a.AckHistogram = calculateLatencyStats(samples)
+
+	return a
+}
+
+// calculateLatencyStats calculates percentiles and a histogram using latencyHistogramBuckets for durations
+func calculateLatencyStats(durations []time.Duration) (*latencyStats, []*latencyHistogramEntry) {
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+
+	stats := &latencyStats{
+		Min: sorted[0],
+		Max: sorted[len(sorted)-1],
+		Avg: total / time.Duration(len(sorted)),
+		P50: durationPercentile(sorted, 50),
+		P90: durationPercentile(sorted, 90),
+		P99: durationPercentile(sorted, 99),
+	}
+
+	var histogram []*latencyHistogramEntry
+	for _, b := range latencyHistogramBuckets {
+		histogram = append(histogram, &latencyHistogramEntry{Below: b})
+	}
+	histogram = append(histogram, &latencyHistogramEntry{})
+
+	for _, d := range sorted {
+		for _, bucket := range histogram {
+			if bucket.Below == 0 || d < bucket.Below {
+				bucket.Count++
+				break
+			}
+		}
+	}
+
+	return stats, histogram
+}
+
+// durationPercentile returns the p-th percentile using the nearest rank method, sorted must be in ascending order
+func durationPercentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+
+	return sorted[rank]
+}
@@ -0,0 +1,71 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/jsm.go/api"
+)
+
+func TestAnalyzeConsumerPolls(t *testing.T) {
+	start := time.Now()
+	polls := []*api.ConsumerInfo{
+		{Stream: "ORDERS", Name: "C", TimeStamp: start, NumPending: 1000, Delivered: api.SequenceInfo{Consumer: 100, Stream: 100}, AckFloor: api.SequenceInfo{Consumer: 90}},
+		{Stream: "ORDERS", Name: "C", TimeStamp: start.Add(10 * time.Second), NumPending: 500, Delivered: api.SequenceInfo{Consumer: 700, Stream: 600}, AckFloor: api.SequenceInfo{Consumer: 690}},
+	}
+
+	samples := []time.Duration{500 * time.Microsecond, 5 * time.Millisecond, 50 * time.Millisecond, 2 * time.Minute}
+	a := analyzeConsumerPolls(polls, samples, 1)
+
+	if a.DeliveryRate == nil || a.AckRate == nil || *a.DeliveryRate != 60 || *a.AckRate != 60 {
+		t.Fatalf("invalid rates: %v %v", a.DeliveryRate, a.AckRate)
+	}
+	if a.DrainRate != 50 || !a.Draining || a.DrainETA != 10*time.Second {
+		t.Fatalf("invalid drain: %v %v %v", a.DrainRate, a.Draining, a.DrainETA)
+	}
+	if a.RedeliveryRatio < 0.16 || a.RedeliveryRatio > 0.17 {
+		t.Fatalf("invalid redelivery ratio: %v", a.RedeliveryRatio)
+	}
+	if a.SampledRedelivery != 0.25 {
+		t.Fatalf("invalid sampled redelivery: %v", a.SampledRedelivery)
+	}
+	if a.AckLatency.Min != 500*time.Microsecond || a.AckLatency.Max != 2*time.Minute || a.AckLatency.P50 != 5*time.Millisecond {
+		t.Fatalf("invalid latency: %+v", a.AckLatency)
+	}
+
+	counts := []int{1, 1, 1, 0, 0, 0, 1}
+	for i, bucket := range a.AckHistogram {
+		if bucket.Count != counts[i] {
+			t.Fatalf("invalid histogram bucket %d: %d", i, bucket.Count)
+		}
+	}
+}
+
+func TestAnalyzeConsumerPollsReset(t *testing.T) {
+	start := time.Now()
+	polls := []*api.ConsumerInfo{
+		{Stream: "ORDERS", Name: "C", TimeStamp: start, Delivered: api.SequenceInfo{Consumer: 700, Stream: 600}, AckFloor: api.SequenceInfo{Consumer: 690}},
+		{Stream: "ORDERS", Name: "C", TimeStamp: start.Add(10 * time.Second), Delivered: api.SequenceInfo{Consumer: 10, Stream: 610}, AckFloor: api.SequenceInfo{Consumer: 5}},
+	}
+
+	a := analyzeConsumerPolls(polls, nil, 0)
+	if a.DeliveryRate != nil || a.AckRate != nil {
+		t.Fatalf("expected unknown rates after a reset: %v %v", a.DeliveryRate, a.AckRate)
+	}
+	if a.RedeliveryRatio != 0 {
+		t.Fatalf("invalid redelivery ratio: %v", a.RedeliveryRatio)
+	}
+}
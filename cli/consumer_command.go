@@ -30,7 +30,6 @@ import (
 	"github.com/AlecAivazis/survey/v2"
 	"github.com/choria-io/fisk"
 	"github.com/dustin/go-humanize"
-	"github.com/google/go-cmp/cmp"
 	"github.com/nats-io/jsm.go/api"
 	"github.com/nats-io/nats.go"
 
@@ -47,6 +46,8 @@ type consumerCmd struct {
 	ackSetByUser   bool
 	term           bool
 	raw            bool
+	decode         string
+	decoder        msgDecoder
 	destination    string
 	inputFile      string
 	outFile        string
@@ -203,6 +204,7 @@ func configureConsumerCommand(app commandHost) {
 	consNext.Flag("raw", "Show only the message").Short('r').UnNegatableBoolVar(&c.raw)
 	consNext.Flag("wait", "Wait up to this period to acknowledge messages").DurationVar(&c.ackWait)
 	consNext.Flag("count", "Number of messages to try to fetch from the pull consumer").Default("1").IntVar(&c.pullCount)
+	consNext.Flag("decode", msgDecoderHelp).PlaceHolder("DECODER").StringVar(&c.decode)
 
 	consSub := cons.Command("sub", "Retrieves messages from Consumers").Action(c.subAction)
 	consSub.Arg("stream", "Stream name").StringVar(&c.stream)
@@ -222,6 +224,9 @@ func configureConsumerCommand(app commandHost) {
 	conResume.Arg("consumer", "Consumer name").StringVar(&c.consumer)
 	conResume.Flag("force", "Force resume without prompting").Short('f').UnNegatableBoolVar(&c.force)
 
+	configureConsumerAnalyzeCommand(cons)
+	configureConsumerDLQCommand(cons)
+
 	conReport := cons.Command("report", "Reports on Consumer statistics").Action(c.reportAction)
 	conReport.Arg("stream", "Stream name").StringVar(&c.stream)
 	conReport.Flag("raw", "Show un-formatted numbers").Short('r').UnNegatableBoolVar(&c.raw)
@@ -410,14 +415,7 @@ func (c *consumerCmd) editAction(pc *fisk.ParseContext) error {
 		return fmt.Errorf("consumers with backoff policies do not support editing Ack Wait")
 	}
 
-	// sort strings to subject lists that only differ in ordering is considered equal
-	sorter := cmp.Transformer("Sort", func(in []string) []string {
-		out := append([]string(nil), in...)
-		sort.Strings(out)
-		return out
-	})
-
-	diff := cmp.Diff(c.selectedConsumer.Configuration(), ncfg, sorter)
+	diff := configDiff(c.selectedConsumer.Configuration(), ncfg)
 	if diff == "" {
 		if !c.dryRun {
 			fmt.Println("No difference in configuration")
@@ -1580,9 +1578,9 @@ func (c *consumerCmd) getNextMsgDirect(stream string, consumer string) error {
 		}
 
 		fmt.Println()
-		fmt.Println(string(msg.Data))
+		fmt.Println(string(decodeMsgBody(c.decoder, msg.Header, msg.Data)))
 	} else {
-		fmt.Println(string(msg.Data))
+		fmt.Println(string(decodeMsgBody(c.decoder, msg.Header, msg.Data)))
 	}
 
 	if c.term {
@@ -1744,9 +1742,13 @@ func (c *consumerCmd) subAction(_ *fisk.ParseContext) error {
 }
 
 func (c *consumerCmd) nextAction(_ *fisk.ParseContext) error {
-	c.connectAndSetup(false, false, nats.UseOldRequestStyle())
-
 	var err error
+	c.decoder, err = newMsgDecoder(c.decode)
+	if err != nil {
+		return err
+	}
+
+	c.connectAndSetup(false, false, nats.UseOldRequestStyle())
 
 	for i := 0; i < c.pullCount; i++ {
 		err = c.getNextMsgDirect(c.stream, c.consumer)
@@ -0,0 +1,401 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/choria-io/fisk"
+	"github.com/nats-io/jsm.go"
+	"github.com/nats-io/jsm.go/api"
+	"github.com/nats-io/jsm.go/api/jetstream/advisory"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	dlqKindMaxDeliveries = "max deliveries"
+	dlqKindTerminated    = "terminated"
+
+	jsAdvisoryConsumerMsgTerminatedPre = api.JSAdvisoryPrefix + ".CONSUMER.MSG_TERMINATED"
+)
+
+type ConsumerDLQCmd struct {
+	stream    string
+	consumer  string
+	capture   string
+	listen    time.Duration
+	sequences []uint64
+	subject   string
+	translate string
+	force     bool
+	json      bool
+
+	js nats.JetStreamContext
+	nc *nats.Conn
+}
+
+// dlqEntry is a message that a consumer gave up on, built from a max deliveries or terminated advisory
+type dlqEntry struct {
+	Kind       string    `json:"kind"`
+	Stream     string    `json:"stream"`
+	Consumer   string    `json:"consumer"`
+	StreamSeq  uint64    `json:"stream_seq"`
+	Deliveries uint64    `json:"deliveries"`
+	Reason     string    `json:"reason,omitempty"`
+	Time       time.Time `json:"time"`
+	Subject    string    `json:"subject,omitempty"`
+	Size       int       `json:"size"`
+	Missing    bool      `json:"missing,omitempty"`
+	msg        *nats.RawStreamMsg
+}
+
+func configureConsumerDLQCommand(cons *fisk.CmdClause) {
+	c := &ConsumerDLQCmd{}
+
+	dlq := cons.Command("dlq", "Browse and replay messages Consumers gave up on")
+	dlq.HelpLong(`Messages that exceed the maximum deliveries of a Consumer or that are
+terminated by a client are reported using advisories.
+
+By default these commands listen for new advisories, to handle messages
+that failed in the past store the advisories in a Stream and pass its name
+using --capture:
+
+   nats stream add DLQ --subjects '$JS.EVENT.ADVISORY.CONSUMER.MAX_DELIVERIES.ORDERS.*' \
+     --subjects '$JS.EVENT.ADVISORY.CONSUMER.MSG_TERMINATED.ORDERS.*' --defaults
+
+The messages are loaded from the Stream using their sequence, messages that
+were since removed from the Stream are shown as missing.
+`)
+
+	addCommonFlags := func(cmd *fisk.CmdClause) {
+		cmd.Arg("stream", "Stream name").Required().StringVar(&c.stream)
+		cmd.Arg("consumer", "Consumer name").Required().StringVar(&c.consumer)
+		cmd.Flag("capture", "Reads advisories from a Stream rather than listening for new ones").PlaceHolder("STREAM").StringVar(&c.capture)
+		cmd.Flag("listen", "How long to listen for new advisories").Default("1m").DurationVar(&c.listen)
+		cmd.Flag("seq", "Only handle messages with specific Stream sequences (pass multiple times)").PlaceHolder("SEQ").Uint64ListVar(&c.sequences)
+	}
+
+	ls := dlq.Command("ls", "List messages Consumers gave up on").Alias("list").Action(c.lsAction)
+	addCommonFlags(ls)
+	ls.Flag("json", "Produce JSON output").Short('j').UnNegatableBoolVar(&c.json)
+
+	view := dlq.Command("view", "View messages Consumers gave up on").Action(c.viewAction)
+	addCommonFlags(view)
+	view.Flag("translate", "Translate the message data by running it through the given command before output").StringVar(&c.translate)
+
+	replay := dlq.Command("replay", "Republish messages Consumers gave up on").Action(c.replayAction)
+	addCommonFlags(replay)
+	replay.Flag("subject", "Publish to an alternate subject rather than the original one").PlaceHolder("SUBJECT").StringVar(&c.subject)
+	replay.Flag("force", "Replay messages without prompting").Short('f').UnNegatableBoolVar(&c.force)
+}
+
+func (c *ConsumerDLQCmd) lsAction(_ *fisk.ParseContext) error {
+	var entries []*dlqEntry
+
+	err := c.eachEntry(func(entry *dlqEntry) error {
+		if c.capture == "" && !c.json {
+			c.showEntryLine(entry)
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if c.json {
+		return printJSON(entries)
+	}
+
+	if c.capture == "" {
+		return nil
+	}
+
+	if len(entries) == 0 {
+		fmt.Printf("No messages found for Consumer %s > %s\n", c.stream, c.consumer)
+		return nil
+	}
+
+	table := newTableWriter(fmt.Sprintf("%d messages Consumer %s > %s gave up on", len(entries), c.stream, c.consumer))
+	table.AddHeaders("Sequence", "Time", "Subject", "Size", "Deliveries", "Reason")
+	for _, entry := range entries {
+		subject := entry.Subject
+		if entry.Missing {
+			subject = "missing"
+		}
+
+		table.AddRow(entry.StreamSeq, f(entry.Time), subject, fiBytes(uint64(entry.Size)), entry.Deliveries, c.reason(entry))
+	}
+	fmt.Println(table.Render())
+
+	return nil
+}
+
+func (c *ConsumerDLQCmd) viewAction(_ *fisk.ParseContext) error {
+	return c.eachEntry(func(entry *dlqEntry) error {
+		c.showEntryLine(entry)
+
+		if entry.Missing {
+			fmt.Println()
+			return nil
+		}
+
+		if len(entry.msg.Header) > 0 {
+			fmt.Println()
+			for k, vs := range entry.msg.Header {
+				for _, v := range vs {
+					fmt.Printf("%s: %s\n", k, v)
+				}
+			}
+		}
+
+		fmt.Println()
+		outPutMSGBody(entry.msg.Data, c.translate, entry.Subject, c.stream)
+
+		return nil
+	})
+}
+
+func (c *ConsumerDLQCmd) replayAction(_ *fisk.ParseContext) error {
+	if !c.force {
+		target := "their original subjects"
+		if c.subject != "" {
+			target = c.subject
+		}
+
+		ok, err := askConfirmation(fmt.Sprintf("Republish messages Consumer %s > %s gave up on to %s", c.stream, c.consumer, target), false)
+		fisk.FatalIfError(err, "could not obtain confirmation")
+
+		if !ok {
+			return nil
+		}
+	}
+
+	replayed := 0
+	err := c.eachEntry(func(entry *dlqEntry) error {
+		if entry.Missing {
+			fmt.Printf("Skipping message %d: no longer in the Stream\n", entry.StreamSeq)
+			return nil
+		}
+
+		err := c.republish(entry)
+		if err != nil {
+			return err
+		}
+
+		replayed++
+		fmt.Printf("Replayed message %d to %s\n", entry.StreamSeq, c.replaySubject(entry))
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\nReplayed %s messages\n", f(replayed))
+
+	return nil
+}
+
+func (c *ConsumerDLQCmd) replaySubject(entry *dlqEntry) string {
+	if c.subject != "" {
+		return c.subject
+	}
+
+	return entry.Subject
+}
+
+// republish sends the message to JetStream, falling back to a core publish when no Stream listens on the subject
+func (c *ConsumerDLQCmd) republish(entry *dlqEntry) error {
+	msg := nats.NewMsg(c.replaySubject(entry))
+	msg.Data = entry.msg.Data
+	for k, vs := range entry.msg.Header {
+		// the original id would be rejected as a duplicate
+		if k == nats.MsgIdHdr {
+			continue
+		}
+		for _, v := range vs {
+			msg.Header.Add(k, v)
+		}
+	}
+
+	_, err := c.js.PublishMsg(msg)
+	if errors.Is(err, nats.ErrNoStreamResponse) || errors.Is(err, nats.ErrNoResponders) {
+		err = c.nc.PublishMsg(msg)
+		if err == nil {
+			err = c.nc.Flush()
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("could not replay message %d: %w", entry.StreamSeq, err)
+	}
+
+	return nil
+}
+
+func (c *ConsumerDLQCmd) reason(entry *dlqEntry) string {
+	if entry.Reason == "" {
+		return entry.Kind
+	}
+
+	return fmt.Sprintf("%s: %s", entry.Kind, entry.Reason)
+}
+
+func (c *ConsumerDLQCmd) showEntryLine(entry *dlqEntry) {
+	if entry.Missing {
+		fmt.Printf("[%d] %s after %d deliveries at %s, message no longer in the Stream\n", entry.StreamSeq, c.reason(entry), entry.Deliveries, f(entry.Time))
+		return
+	}
+
+	fmt.Printf("[%d] Subject: %s %s after %d deliveries at %s\n", entry.StreamSeq, entry.Subject, c.reason(entry), entry.Deliveries, f(entry.Time))
+}
+
+// eachEntry calls cb for every advisory found in the capture stream or received while listening
+func (c *ConsumerDLQCmd) eachEntry(cb func(*dlqEntry) error) error {
+	nc, mgr, err := prepareHelper("", natsOpts()...)
+	fisk.FatalIfError(err, "setup failed")
+
+	c.nc = nc
+	_, c.js, err = prepareJSHelper()
+	if err != nil {
+		return err
+	}
+
+	stream, err := mgr.LoadStream(c.stream)
+	if err != nil {
+		return err
+	}
+
+	subjects := []string{
+		fmt.Sprintf("%s.%s.%s", jsm.EventSubject(api.JSAdvisoryConsumerMaxDeliveryExceedPre, opts.Config.JSEventPrefix()), c.stream, c.consumer),
+		fmt.Sprintf("%s.%s.%s", jsm.EventSubject(jsAdvisoryConsumerMsgTerminatedPre, opts.Config.JSEventPrefix()), c.stream, c.consumer),
+	}
+
+	handle := func(m *nats.Msg) error {
+		entry, err := c.parseAdvisory(m)
+		if err != nil || entry == nil {
+			return err
+		}
+
+		err = c.loadMessage(stream, entry)
+		if err != nil {
+			return err
+		}
+
+		return cb(entry)
+	}
+
+	if c.capture != "" {
+		return eachStreamMessage(c.js, c.capture, streamMessageFilter{subjects: subjects}, func(msg *nats.Msg, _ *nats.MsgMetadata) error {
+			return handle(msg)
+		})
+	}
+
+	msgs := make(chan *nats.Msg, 1000)
+	for _, subj := range subjects {
+		sub, err := nc.ChanSubscribe(subj, msgs)
+		if err != nil {
+			return err
+		}
+		defer sub.Unsubscribe()
+	}
+
+	ctx, cancel := signal.NotifyContext(ctx, syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+	ctx, cancel = context.WithTimeout(ctx, c.listen)
+	defer cancel()
+
+	if !c.json {
+		fmt.Printf("Listening for messages Consumer %s > %s gives up on for %v\n\n", c.stream, c.consumer, c.listen)
+	}
+
+	for {
+		select {
+		case m := <-msgs:
+			err = handle(m)
+			if err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (c *ConsumerDLQCmd) parseAdvisory(m *nats.Msg) (*dlqEntry, error) {
+	// the terminated advisory is a superset of the max deliveries one
+	var adv advisory.JSConsumerDeliveryTerminatedAdvisoryV1
+	err := json.Unmarshal(m.Data, &adv)
+	if err != nil {
+		return nil, fmt.Errorf("invalid advisory on %s: %w", m.Subject, err)
+	}
+
+	if len(c.sequences) > 0 {
+		found := false
+		for _, seq := range c.sequences {
+			if seq == adv.StreamSeq {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, nil
+		}
+	}
+
+	entry := &dlqEntry{
+		Kind:       dlqKindMaxDeliveries,
+		Stream:     adv.Stream,
+		Consumer:   adv.Consumer,
+		StreamSeq:  adv.StreamSeq,
+		Deliveries: adv.Deliveries,
+		Reason:     adv.Reason,
+		Time:       adv.Time,
+	}
+
+	if strings.Contains(m.Subject, ".MSG_TERMINATED.") {
+		entry.Kind = dlqKindTerminated
+	}
+
+	return entry, nil
+}
+
+func (c *ConsumerDLQCmd) loadMessage(stream *jsm.Stream, entry *dlqEntry) error {
+	var gopts []nats.JSOpt
+	if stream.DirectAllowed() {
+		gopts = append(gopts, nats.DirectGet())
+	}
+
+	msg, err := c.js.GetMsg(c.stream, entry.StreamSeq, gopts...)
+	if errors.Is(err, nats.ErrMsgNotFound) {
+		entry.Missing = true
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not load message %d: %w", entry.StreamSeq, err)
+	}
+
+	entry.msg = msg
+	entry.Subject = msg.Subject
+	entry.Size = len(msg.Data)
+
+	return nil
+}
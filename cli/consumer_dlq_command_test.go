@@ -0,0 +1,99 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/jsm.go"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+func TestConsumerDLQ(t *testing.T) {
+	withJetStream(t, func(_ *server.Server, nc *nats.Conn, mgr *jsm.Manager) {
+		orders, err := mgr.NewStreamFromDefault("ORDERS", applyStreamDefaults, jsm.Subjects("ORDERS.*"), jsm.MemoryStorage(), jsm.AllowDirect())
+		assertNoError(t, err)
+		_, err = mgr.NewStreamFromDefault("DLQ", applyStreamDefaults, jsm.Subjects("$JS.EVENT.ADVISORY.CONSUMER.MAX_DELIVERIES.ORDERS.*", "$JS.EVENT.ADVISORY.CONSUMER.MSG_TERMINATED.ORDERS.*"), jsm.MemoryStorage())
+		assertNoError(t, err)
+		_, err = mgr.NewStreamFromDefault("RETRY", applyStreamDefaults, jsm.Subjects("RETRY.>"), jsm.MemoryStorage())
+		assertNoError(t, err)
+		_, err = orders.NewConsumer(jsm.DurableName("PROC"), jsm.AcknowledgeExplicit(), jsm.MaxDeliveryAttempts(1), jsm.AckWait(100*time.Millisecond))
+		assertNoError(t, err)
+
+		js, err := nc.JetStream()
+		assertNoError(t, err)
+		for _, subj := range []string{"ORDERS.new", "ORDERS.bad", "ORDERS.slow"} {
+			_, err = js.Publish(subj, []byte(subj))
+			assertNoError(t, err)
+		}
+
+		sub, err := js.PullSubscribe("", "PROC", nats.Bind("ORDERS", "PROC"))
+		assertNoError(t, err)
+		msgs, err := sub.Fetch(3)
+		assertNoError(t, err)
+		for _, msg := range msgs {
+			switch msg.Subject {
+			case "ORDERS.new":
+				assertNoError(t, msg.Ack())
+			case "ORDERS.bad":
+				assertNoError(t, msg.Respond([]byte("+TERM invalid order")))
+			}
+		}
+
+		// the slow message reaches max deliveries once the ack wait expires
+		dlq, err := mgr.LoadStream("DLQ")
+		assertNoError(t, err)
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			_, _ = sub.Fetch(1, nats.MaxWait(100*time.Millisecond))
+			nfo, err := dlq.State()
+			assertNoError(t, err)
+			if nfo.Msgs == 2 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected 2 advisories got %d", nfo.Msgs)
+			}
+		}
+
+		cmd := &ConsumerDLQCmd{stream: "ORDERS", consumer: "PROC", capture: "DLQ"}
+
+		var entries []*dlqEntry
+		assertNoError(t, cmd.eachEntry(func(entry *dlqEntry) error {
+			entries = append(entries, entry)
+			return nil
+		}))
+
+		if len(entries) != 2 {
+			t.Fatalf("expected 2 entries got %d", len(entries))
+		}
+		if entries[0].Kind != dlqKindTerminated || entries[0].Reason != "invalid order" || entries[0].Subject != "ORDERS.bad" {
+			t.Fatalf("invalid terminated entry: %#v", entries[0])
+		}
+		if entries[1].Kind != dlqKindMaxDeliveries || entries[1].Subject != "ORDERS.slow" || entries[1].StreamSeq != 3 {
+			t.Fatalf("invalid max deliveries entry: %#v", entries[1])
+		}
+
+		cmd = &ConsumerDLQCmd{stream: "ORDERS", consumer: "PROC", capture: "DLQ", subject: "RETRY.orders", force: true, sequences: []uint64{3}}
+		assertNoError(t, cmd.replayAction(nil))
+
+		msg, err := js.GetLastMsg("RETRY", "RETRY.orders")
+		assertNoError(t, err)
+		if string(msg.Data) != "ORDERS.slow" {
+			t.Fatalf("invalid replayed message: %q", msg.Data)
+		}
+	})
+}
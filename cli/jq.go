@@ -0,0 +1,91 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/itchyny/gojq"
+)
+
+// jqExpression is a jq query like '.order.id == "x"' evaluated against JSON documents
+type jqExpression struct {
+	query     string
+	code      *gojq.Code
+	predicate bool
+}
+
+// newJQExpression compiles query, when predicate is true the query must produce a boolean
+func newJQExpression(query string, predicate bool) (*jqExpression, error) {
+	parsed, err := gojq.Parse(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jq query %q: %w", query, err)
+	}
+
+	code, err := gojq.Compile(parsed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jq query %q: %w", query, err)
+	}
+
+	return &jqExpression{query: query, code: code, predicate: predicate}, nil
+}
+
+// Evaluate runs the query against a JSON document, a query producing several values returns them as a list
+func (e *jqExpression) Evaluate(data []byte) (any, error) {
+	var doc any
+	err := json.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []any
+	iter := e.code.Run(doc)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			return nil, err
+		}
+		results = append(results, v)
+	}
+
+	switch {
+	case len(results) == 0:
+		return nil, nil
+	case len(results) == 1:
+		if _, ok := results[0].(bool); e.predicate && !ok {
+			return nil, fmt.Errorf("jq query %q did not produce a boolean", e.query)
+		}
+		return results[0], nil
+	case e.predicate:
+		return nil, fmt.Errorf("jq query %q produced %d values", e.query, len(results))
+	default:
+		return results, nil
+	}
+}
+
+// Matches evaluates a predicate query, documents that are not JSON or that lack the referenced fields do not match
+func (e *jqExpression) Matches(data []byte) bool {
+	res, err := e.Evaluate(data)
+	if err != nil {
+		return false
+	}
+
+	match, ok := res.(bool)
+
+	return ok && match
+}
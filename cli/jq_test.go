@@ -0,0 +1,77 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"testing"
+)
+
+func TestJQExpression(t *testing.T) {
+	expr, err := newJQExpression(`.order.total > 100 and .order.state == "new"`, true)
+	assertNoError(t, err)
+
+	if !expr.Matches([]byte(`{"order":{"total":200,"state":"new"}}`)) {
+		t.Fatalf("expected match")
+	}
+	if expr.Matches([]byte(`{"order":{"total":20,"state":"new"}}`)) {
+		t.Fatalf("unexpected match")
+	}
+	if expr.Matches([]byte(`not json`)) {
+		t.Fatalf("unexpected match on invalid json")
+	}
+
+	_, err = newJQExpression(".order.total +", true)
+	if err == nil {
+		t.Fatalf("expected compile error")
+	}
+
+	expr, err = newJQExpression(".order.state", false)
+	assertNoError(t, err)
+	res, err := expr.Evaluate([]byte(`{"order":{"state":"new"}}`))
+	assertNoError(t, err)
+	if res != "new" {
+		t.Fatalf("expected new got %v", res)
+	}
+
+	expr, err = newJQExpression(`."order id" | startswith("o")`, true)
+	assertNoError(t, err)
+	if !expr.Matches([]byte(`{"order id":"o1"}`)) {
+		t.Fatalf("expected quoted key to match")
+	}
+
+	// predicates must produce a single boolean
+	expr, err = newJQExpression(".order.state", true)
+	assertNoError(t, err)
+	_, err = expr.Evaluate([]byte(`{"order":{"state":"new"}}`))
+	if err == nil {
+		t.Fatalf("expected non boolean predicate to fail")
+	}
+
+	expr, err = newJQExpression(".[].id", false)
+	assertNoError(t, err)
+	res, err = expr.Evaluate([]byte(`[{"id":1},{"id":2}]`))
+	assertNoError(t, err)
+	if vals, ok := res.([]any); !ok || len(vals) != 2 {
+		t.Fatalf("expected 2 values got %v", res)
+	}
+
+	// gathered replies are reduced with the array of replies as the document
+	expr, err = newJQExpression("map(.load) | add", false)
+	assertNoError(t, err)
+	res, err = expr.Evaluate([]byte(`[{"load":1},{"load":2},{"load":3}]`))
+	assertNoError(t, err)
+	if res != float64(6) {
+		t.Fatalf("expected 6 got %v", res)
+	}
+}
@@ -46,23 +46,55 @@ func (v SchemaValidator) ValidateStruct(data any, schemaType string) (ok bool, e
 
 	err = sch.Validate(d)
 	if err != nil {
-		if verr, ok := err.(*jsonschema.ValidationError); ok {
-			for _, e := range verr.BasicOutput().Errors {
-				if e.KeywordLocation == "" || e.Error == "oneOf failed" || e.Error == "allOf failed" {
-					continue
-				}
-
-				if e.InstanceLocation == "" {
-					errs = append(errs, e.Error)
-				} else {
-					errs = append(errs, fmt.Sprintf("%s: %s", e.InstanceLocation, e.Error))
-				}
-			}
-			return false, errs
+		return false, schemaValidationErrors(err)
+	}
+
+	return true, nil
+}
+
+// compileJSONSchema compiles a JSON Schema so it can be used to validate many documents
+func compileJSONSchema(schema []byte) (*jsonschema.Schema, error) {
+	sch, err := jsonschema.CompileString("schema.json", string(schema))
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	return sch, nil
+}
+
+// ValidateJSON validates a JSON document against a compiled JSON Schema
+func (v SchemaValidator) ValidateJSON(data []byte, sch *jsonschema.Schema) (ok bool, errs []string) {
+	var d any
+	err := json.Unmarshal(data, &d)
+	if err != nil {
+		return false, []string{fmt.Sprintf("invalid JSON: %s", err)}
+	}
+
+	err = sch.Validate(d)
+	if err != nil {
+		return false, schemaValidationErrors(err)
+	}
+
+	return true, nil
+}
+
+func schemaValidationErrors(err error) (errs []string) {
+	verr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return []string{fmt.Sprintf("could not validate: %s", err)}
+	}
+
+	for _, e := range verr.BasicOutput().Errors {
+		if e.KeywordLocation == "" || e.Error == "oneOf failed" || e.Error == "allOf failed" {
+			continue
+		}
+
+		if e.InstanceLocation == "" {
+			errs = append(errs, e.Error)
 		} else {
-			return false, []string{fmt.Sprintf("could not validate: %s", err)}
+			errs = append(errs, fmt.Sprintf("%s: %s", e.InstanceLocation, e.Error))
 		}
 	}
 
-	return true, nil
+	return errs
 }
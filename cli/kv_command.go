@@ -38,6 +38,7 @@ type kvCommand struct {
 	key                   string
 	val                   string
 	raw                   bool
+	decode                string
 	history               uint64
 	ttl                   time.Duration
 	replicas              uint
@@ -61,6 +62,12 @@ type kvCommand struct {
 	mirrorDomain          string
 	sources               []string
 	compression           bool
+	schemaFile            string
+	watchCommand          string
+	watchTemplate         string
+	watchOutput           string
+	watchReload           string
+	watchDebounce         time.Duration
 }
 
 func configureKVCommand(app commandHost) {
@@ -93,6 +100,7 @@ for an indefinite period or a per-bucket configured TTL.
 	add.Flag("mirror", "Creates a mirror of a different bucket").StringVar(&c.mirror)
 	add.Flag("mirror-domain", "When mirroring find the bucket in a different domain").StringVar(&c.mirrorDomain)
 	add.Flag("source", "Source from a different bucket").PlaceHolder("BUCKET").StringsVar(&c.sources)
+	add.Flag("schema", "JSON Schema file that values must match").PlaceHolder("FILE").ExistingFileVar(&c.schemaFile)
 
 	add.PreAction(c.parseLimitStrings)
 
@@ -106,6 +114,7 @@ for an indefinite period or a per-bucket configured TTL.
 	get.Arg("key", "The key to act on").Required().StringVar(&c.key)
 	get.Flag("revision", "Gets a specific revision").Uint64Var(&c.revision)
 	get.Flag("raw", "Show only the value string").UnNegatableBoolVar(&c.raw)
+	get.Flag("decode", "Decodes values using msgpack, cbor, proto:FILE#TYPE or avro:FILE, auto and proto without a TYPE are not supported as values have no headers").PlaceHolder("DECODER").StringVar(&c.decode)
 
 	create := kv.Command("create", "Puts a value into a key only if the key is new or it's last operation was a delete").Action(c.createAction)
 	create.Arg("bucket", "The bucket to act on").Required().StringVar(&c.bucket)
@@ -142,8 +151,28 @@ for an indefinite period or a per-bucket configured TTL.
 	status.Arg("bucket", "The bucket to act on").StringVar(&c.bucket)
 
 	watch := kv.Command("watch", "Watch the bucket or a specific key for updated").Action(c.watchAction)
+	watch.HelpLong(`Watches the bucket for changes, printing them or acting on them.
+
+With --command a command is run for every change, including the initial
+values, with the details of the change in the NATS_KV_BUCKET, NATS_KV_KEY,
+NATS_KV_VALUE, NATS_KV_OPERATION and NATS_KV_REVISION environment variables.
+
+With --template a Go template is rendered to the --output file once values
+stopped changing for the --debounce period, the --reload command is run when
+the content of the file changed. Templates can access {{ .Bucket }},
+{{ .Revision }} and the map {{ .Values }} and use these functions:
+
+  {{ Get "key" }}           the value of a key
+  {{ Keys "prefix" }}       the sorted keys starting with a prefix
+  {{ FromJSON "key" }}      the value of a key parsed as JSON
+`)
 	watch.Arg("bucket", "The bucket to act on").Required().StringVar(&c.bucket)
 	watch.Arg("key", "The key to act on").Default(">").StringVar(&c.key)
+	watch.Flag("command", "Runs a command for every change with details in NATS_KV_* environment variables").PlaceHolder("COMMAND").StringVar(&c.watchCommand)
+	watch.Flag("template", "Renders a Go template to --output whenever values change").PlaceHolder("FILE").ExistingFileVar(&c.watchTemplate)
+	watch.Flag("output", "The file to render --template to").PlaceHolder("FILE").StringVar(&c.watchOutput)
+	watch.Flag("reload", "Runs a command after the template output changed").PlaceHolder("COMMAND").StringVar(&c.watchReload)
+	watch.Flag("debounce", "How long values must be unchanged before rendering the template").Default("1s").DurationVar(&c.watchDebounce)
 
 	ls := kv.Command("ls", "List available buckets or the keys in a bucket").Alias("list").Action(c.lsAction)
 	ls.Arg("bucket", "The bucket to list the keys").StringVar(&c.bucket)
@@ -154,6 +183,13 @@ for an indefinite period or a per-bucket configured TTL.
 	rmHistory := kv.Command("compact", "Reclaim space used by deleted keys").Action(c.compactAction)
 	rmHistory.Arg("bucket", "The bucket to act on").Required().StringVar(&c.bucket)
 	rmHistory.Flag("force", "Act without confirmation").Short('f').UnNegatableBoolVar(&c.force)
+
+	configureKVExportCommand(kv)
+	configureKVRestoreCommand(kv)
+	configureKVDiffCommand(kv)
+	configureKVSchemaCommand(kv)
+	configureKVLockCommand(kv)
+	configureKVMountCommand(kv)
 }
 
 func init() {
@@ -481,15 +517,49 @@ func (c *kvCommand) addAction(_ *fisk.ParseContext) error {
 		})
 	}
 
+	// the schema is checked before creating the bucket so an invalid schema does not leave a bucket behind
+	var schema []byte
+	if c.schemaFile != "" {
+		schema, err = os.ReadFile(c.schemaFile)
+		if err != nil {
+			return err
+		}
+
+		_, err = compileJSONSchema(schema)
+		if err != nil {
+			return err
+		}
+	}
+
 	store, err := js.CreateKeyValue(cfg)
 	if err != nil {
 		return err
 	}
 
+	if schema != nil {
+		err = setKVBucketSchema(js, c.bucket, schema)
+		if err != nil {
+			return err
+		}
+	}
+
 	return c.showStatus(store)
 }
 
 func (c *kvCommand) getAction(_ *fisk.ParseContext) error {
+	decoder, err := newMsgDecoder(c.decode)
+	if err != nil {
+		return err
+	}
+
+	// values are read without their headers so there is no Content-Type to select a decoder with
+	if _, ok := decoder.(*contentTypeDecoder); ok {
+		return fmt.Errorf("auto decoding is not supported for KV values, specify the decoder to use")
+	}
+	if pd, ok := decoder.(*protoDecoder); ok && pd.msgType == "" {
+		return fmt.Errorf("protobuf decoding of KV values requires a message type, for example proto:descriptors.pb#pkg.Message")
+	}
+
 	_, _, store, err := c.loadBucket()
 	if err != nil {
 		return err
@@ -506,12 +576,19 @@ func (c *kvCommand) getAction(_ *fisk.ParseContext) error {
 	}
 
 	if c.raw {
-		os.Stdout.Write(res.Value())
+		os.Stdout.Write(decodeMsgBody(decoder, nil, res.Value()))
 		return nil
 	}
 
 	fmt.Printf("%s > %s revision: %d created @ %s\n", res.Bucket(), res.Key(), res.Revision(), res.Created().Format(time.RFC822))
 	fmt.Println()
+
+	if decoder != nil {
+		fmt.Println(string(decodeMsgBody(decoder, nil, res.Value())))
+		fmt.Println()
+		return nil
+	}
+
 	pv := base64IfNotPrintable(res.Value())
 	lpv := len(pv)
 	if len(pv) > 120 {
@@ -527,7 +604,7 @@ func (c *kvCommand) getAction(_ *fisk.ParseContext) error {
 }
 
 func (c *kvCommand) putAction(_ *fisk.ParseContext) error {
-	_, _, store, err := c.loadBucket()
+	_, js, store, err := c.loadBucket()
 	if err != nil {
 		return err
 	}
@@ -537,6 +614,11 @@ func (c *kvCommand) putAction(_ *fisk.ParseContext) error {
 		return err
 	}
 
+	err = validateKVValue(js, c.bucket, c.key, val)
+	if err != nil {
+		return err
+	}
+
 	_, err = store.Put(c.key, val)
 	if err != nil {
 		return err
@@ -548,7 +630,7 @@ func (c *kvCommand) putAction(_ *fisk.ParseContext) error {
 }
 
 func (c *kvCommand) createAction(_ *fisk.ParseContext) error {
-	_, _, store, err := c.loadBucket()
+	_, js, store, err := c.loadBucket()
 	if err != nil {
 		return err
 	}
@@ -558,6 +640,11 @@ func (c *kvCommand) createAction(_ *fisk.ParseContext) error {
 		return err
 	}
 
+	err = validateKVValue(js, c.bucket, c.key, val)
+	if err != nil {
+		return err
+	}
+
 	_, err = store.Create(c.key, val)
 	if err != nil {
 		return err
@@ -569,7 +656,7 @@ func (c *kvCommand) createAction(_ *fisk.ParseContext) error {
 }
 
 func (c *kvCommand) updateAction(_ *fisk.ParseContext) error {
-	_, _, store, err := c.loadBucket()
+	_, js, store, err := c.loadBucket()
 	if err != nil {
 		return err
 	}
@@ -579,6 +666,11 @@ func (c *kvCommand) updateAction(_ *fisk.ParseContext) error {
 		return err
 	}
 
+	err = validateKVValue(js, c.bucket, c.key, val)
+	if err != nil {
+		return err
+	}
+
 	_, err = store.Update(c.key, val, c.revision)
 	if err != nil {
 		return err
@@ -667,6 +759,10 @@ func (c *kvCommand) watchAction(_ *fisk.ParseContext) error {
 		return err
 	}
 
+	if c.watchCommand != "" || c.watchTemplate != "" {
+		return c.watchActions(store)
+	}
+
 	watch, err := store.Watch(c.key)
 	if err != nil {
 		return err
@@ -0,0 +1,295 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/choria-io/fisk"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	kvDiffAdded   = "added"
+	kvDiffRemoved = "removed"
+	kvDiffChanged = "changed"
+)
+
+type KVDiffCmd struct {
+	bucketA  string
+	bucketB  string
+	contextA string
+	contextB string
+	json     bool
+	dryRun   bool
+	prune    bool
+	force    bool
+
+	// the JetStream context of the second bucket, set by loadBuckets
+	jsB nats.JetStreamContext
+}
+
+// kvDifference is a key that differs between two buckets, added and removed are relative to the first bucket,
+// values that are not valid UTF-8 are base64 encoded with a base64: prefix
+type kvDifference struct {
+	Key       string `json:"key"`
+	Change    string `json:"change"`
+	RevisionA uint64 `json:"revision_a,omitempty"`
+	RevisionB uint64 `json:"revision_b,omitempty"`
+	ValueA    string `json:"value_a,omitempty"`
+	ValueB    string `json:"value_b,omitempty"`
+}
+
+func configureKVDiffCommand(kv *fisk.CmdClause) {
+	c := &KVDiffCmd{}
+
+	diff := kv.Command("diff", "Shows the differences between two buckets").Action(c.diffAction)
+	diff.HelpLong(`Compares the current values of all keys in two buckets, keys are reported
+as added when only found in the second bucket and removed when only found in
+the first bucket.
+
+The buckets can be in different accounts or clusters by using --context-a
+and --context-b, when only one bucket name is given the same bucket is
+compared in both contexts. The command exits with a non zero code when the
+buckets differ.
+`)
+	diff.Arg("bucket", "The bucket to compare").Required().StringVar(&c.bucketA)
+	diff.Arg("other", "The bucket to compare against, defaults to the same bucket name").StringVar(&c.bucketB)
+	diff.Flag("context-a", "The context to use to access the first bucket").PlaceHolder("NAME").StringVar(&c.contextA)
+	diff.Flag("context-b", "The context to use to access the second bucket").PlaceHolder("NAME").StringVar(&c.contextB)
+	diff.Flag("json", "Produce JSON output").Short('j').UnNegatableBoolVar(&c.json)
+
+	sync := kv.Command("sync", "Updates a bucket to match another bucket").Action(c.syncAction)
+	sync.HelpLong(`Puts all keys from the first bucket that are missing or different in the
+second bucket, with --prune keys not in the first bucket are deleted.
+
+Changes are applied using the revisions seen when the sync was planned, any
+key changed by another client during the sync is not updated. Values are
+validated against the schema of the second bucket, if one is set.
+`)
+	sync.Arg("bucket", "The bucket to copy from").Required().StringVar(&c.bucketA)
+	sync.Arg("other", "The bucket to update, defaults to the same bucket name").StringVar(&c.bucketB)
+	sync.Flag("context-a", "The context to use to access the bucket to copy from").PlaceHolder("NAME").StringVar(&c.contextA)
+	sync.Flag("context-b", "The context to use to access the bucket to update").PlaceHolder("NAME").StringVar(&c.contextB)
+	sync.Flag("prune", "Deletes keys that are not in the bucket being copied from").UnNegatableBoolVar(&c.prune)
+	sync.Flag("dry-run", "Shows the changes that would be made without making them").UnNegatableBoolVar(&c.dryRun)
+	sync.Flag("force", "Sync without prompting").Short('f').UnNegatableBoolVar(&c.force)
+}
+
+// loadBuckets loads both buckets, the returned function closes the connections made to access them
+func (c *KVDiffCmd) loadBuckets() (nats.KeyValue, nats.KeyValue, func(), error) {
+	if c.bucketB == "" {
+		c.bucketB = c.bucketA
+	}
+
+	if c.bucketA == c.bucketB && c.contextA == c.contextB {
+		return nil, nil, nil, fmt.Errorf("a different bucket or context is required to compare against")
+	}
+
+	_, jsA, closeA, err := prepareContextHelper(c.contextA)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	_, jsB, closeB, err := prepareContextHelper(c.contextB)
+	if err != nil {
+		closeA()
+		return nil, nil, nil, err
+	}
+
+	closer := func() {
+		closeA()
+		closeB()
+	}
+	c.jsB = jsB
+
+	storeA, err := jsA.KeyValue(c.bucketA)
+	if err != nil {
+		closer()
+		return nil, nil, nil, fmt.Errorf("could not load bucket %s: %w", c.bucketA, err)
+	}
+
+	storeB, err := jsB.KeyValue(c.bucketB)
+	if err != nil {
+		closer()
+		return nil, nil, nil, fmt.Errorf("could not load bucket %s: %w", c.bucketB, err)
+	}
+
+	return storeA, storeB, closer, nil
+}
+
+func (c *KVDiffCmd) diffAction(_ *fisk.ParseContext) error {
+	storeA, storeB, closer, err := c.loadBuckets()
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	entriesA, err := kvCurrentEntries(storeA)
+	if err != nil {
+		return err
+	}
+
+	entriesB, err := kvCurrentEntries(storeB)
+	if err != nil {
+		return err
+	}
+
+	diff := diffKVEntries(entriesA, entriesB)
+
+	if c.json {
+		err = printJSON(diff)
+		if err != nil {
+			return err
+		}
+	} else {
+		c.renderDiff(diff)
+	}
+
+	if len(diff) > 0 {
+		os.Exit(1)
+	}
+
+	return nil
+}
+
+func (c *KVDiffCmd) renderDiff(diff []*kvDifference) {
+	name := func(bucket string, context string) string {
+		if context == "" {
+			return bucket
+		}
+		return fmt.Sprintf("%s (%s)", bucket, context)
+	}
+	nameA := name(c.bucketA, c.contextA)
+	nameB := name(c.bucketB, c.contextB)
+
+	if len(diff) == 0 {
+		fmt.Printf("No differences found between %s and %s\n", nameA, nameB)
+		return
+	}
+
+	table := newTableWriter(fmt.Sprintf("%s differences between %s and %s", f(len(diff)), nameA, nameB))
+	table.AddHeaders("Key", "Change", "Revision A", "Revision B", "Value A", "Value B")
+	for _, d := range diff {
+		revA, revB := "", ""
+		if d.RevisionA > 0 {
+			revA = f(d.RevisionA)
+		}
+		if d.RevisionB > 0 {
+			revB = f(d.RevisionB)
+		}
+
+		table.AddRow(d.Key, d.Change, revA, revB, kvDiffValue(d.ValueA), kvDiffValue(d.ValueB))
+	}
+	fmt.Println(table.Render())
+}
+
+func (c *KVDiffCmd) syncAction(_ *fisk.ParseContext) error {
+	storeA, storeB, closer, err := c.loadBuckets()
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	entriesA, err := kvCurrentEntries(storeA)
+	if err != nil {
+		return err
+	}
+
+	entriesB, err := kvCurrentEntries(storeB)
+	if err != nil {
+		return err
+	}
+
+	values := map[string][]byte{}
+	for k, e := range entriesA {
+		values[k] = e.Value()
+	}
+
+	changes, unchanged := planKVChanges(entriesB, values, c.prune)
+	if len(changes) == 0 {
+		fmt.Printf("No changes, bucket %s matches bucket %s\n", c.bucketB, c.bucketA)
+		return nil
+	}
+
+	err = validateKVChanges(c.jsB, c.bucketB, changes)
+	if err != nil {
+		return err
+	}
+
+	showKVChanges(c.bucketB, changes, unchanged)
+
+	if c.dryRun {
+		return nil
+	}
+
+	if !c.force {
+		fmt.Println()
+		ok, err := askConfirmation(fmt.Sprintf("Really update bucket %s to match bucket %s", c.bucketB, c.bucketA), false)
+		fisk.FatalIfError(err, "could not obtain confirmation")
+
+		if !ok {
+			return nil
+		}
+	}
+
+	err = applyKVImport(storeB, changes)
+	if err != nil {
+		return err
+	}
+
+	create, update, del := countKVChanges(changes)
+	fmt.Println()
+	fmt.Printf("Synchronized bucket %s: %d created, %d updated, %d deleted\n", c.bucketB, create, update, del)
+
+	return nil
+}
+
+// diffKVEntries finds keys that differ between two buckets sorted by key
+func diffKVEntries(a map[string]nats.KeyValueEntry, b map[string]nats.KeyValueEntry) []*kvDifference {
+	var diff []*kvDifference
+
+	for key, ea := range a {
+		eb, ok := b[key]
+		switch {
+		case !ok:
+			diff = append(diff, &kvDifference{Key: key, Change: kvDiffRemoved, RevisionA: ea.Revision(), ValueA: encodeKVString(ea.Value())})
+		case !bytes.Equal(ea.Value(), eb.Value()):
+			diff = append(diff, &kvDifference{Key: key, Change: kvDiffChanged, RevisionA: ea.Revision(), RevisionB: eb.Revision(), ValueA: encodeKVString(ea.Value()), ValueB: encodeKVString(eb.Value())})
+		}
+	}
+
+	for key, eb := range b {
+		if _, ok := a[key]; !ok {
+			diff = append(diff, &kvDifference{Key: key, Change: kvDiffAdded, RevisionB: eb.Revision(), ValueB: encodeKVString(eb.Value())})
+		}
+	}
+
+	sort.Slice(diff, func(i, j int) bool { return diff[i].Key < diff[j].Key })
+
+	return diff
+}
+
+// kvDiffValue shortens long values to 40 characters for display
+func kvDiffValue(v string) string {
+	r := []rune(v)
+	if len(r) > 40 {
+		return string(r[:37]) + "..."
+	}
+
+	return v
+}
@@ -0,0 +1,94 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/nats-io/jsm.go"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+func TestKVDiffAndSync(t *testing.T) {
+	withJetStream(t, func(_ *server.Server, nc *nats.Conn, _ *jsm.Manager) {
+		js, err := nc.JetStream()
+		assertNoError(t, err)
+
+		east, err := js.CreateKeyValue(&nats.KeyValueConfig{Bucket: "EAST"})
+		assertNoError(t, err)
+		west, err := js.CreateKeyValue(&nats.KeyValueConfig{Bucket: "WEST"})
+		assertNoError(t, err)
+
+		for k, v := range map[string]string{"a": "1", "b": "1", "c": "1"} {
+			_, err = east.Put(k, []byte(v))
+			assertNoError(t, err)
+		}
+		for k, v := range map[string]string{"b": "1", "c": "2", "d": "\xff\x00"} {
+			_, err = west.Put(k, []byte(v))
+			assertNoError(t, err)
+		}
+
+		cmd := &KVDiffCmd{bucketA: "EAST", bucketB: "WEST"}
+		storeA, storeB, closer, err := cmd.loadBuckets()
+		assertNoError(t, err)
+		defer closer()
+
+		entriesA, err := kvCurrentEntries(storeA)
+		assertNoError(t, err)
+		entriesB, err := kvCurrentEntries(storeB)
+		assertNoError(t, err)
+
+		diff := diffKVEntries(entriesA, entriesB)
+		if len(diff) != 3 {
+			t.Fatalf("expected 3 differences got %d", len(diff))
+		}
+		if diff[0].Key != "a" || diff[0].Change != kvDiffRemoved || diff[0].ValueA != "1" {
+			t.Fatalf("invalid difference %+v", diff[0])
+		}
+		if diff[1].Key != "c" || diff[1].Change != kvDiffChanged || diff[1].ValueA != "1" || diff[1].ValueB != "2" || diff[1].RevisionB == 0 {
+			t.Fatalf("invalid difference %+v", diff[1])
+		}
+		if diff[2].Key != "d" || diff[2].Change != kvDiffAdded || diff[2].RevisionA != 0 || diff[2].ValueB != "base64:/wA=" {
+			t.Fatalf("invalid difference %+v", diff[2])
+		}
+
+		cmd = &KVDiffCmd{bucketA: "EAST", bucketB: "WEST", prune: true, force: true}
+		assertNoError(t, cmd.syncAction(nil))
+
+		entriesB, err = kvCurrentEntries(west)
+		assertNoError(t, err)
+		if diff = diffKVEntries(entriesA, entriesB); len(diff) != 0 {
+			t.Fatalf("expected no differences after sync got %d", len(diff))
+		}
+
+		_, _, _, err = (&KVDiffCmd{bucketA: "EAST"}).loadBuckets()
+		if err == nil {
+			t.Fatalf("expected an error comparing a bucket with itself")
+		}
+	})
+}
+
+func TestKVDiffValue(t *testing.T) {
+	if v := kvDiffValue("short"); v != "short" {
+		t.Fatalf("expected short values to be unchanged got %q", v)
+	}
+
+	v := kvDiffValue(strings.Repeat("é", 50))
+	if !utf8.ValidString(v) || utf8.RuneCountInString(v) != 40 || !strings.HasSuffix(v, "...") {
+		t.Fatalf("invalid truncated value %q", v)
+	}
+}
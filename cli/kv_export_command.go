@@ -0,0 +1,772 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/choria-io/fisk"
+	"github.com/fatih/color"
+	"github.com/ghodss/yaml"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	kvFormatJSON = "json"
+	kvFormatYAML = "yaml"
+	kvFormatEnv  = "env"
+	kvFormatDir  = "dir"
+
+	// kvBase64Prefix marks json and yaml values that are base64 encoded as they are not valid UTF-8
+	kvBase64Prefix = "base64:"
+
+	// kvDirValueFile holds the value of a key that is also the prefix of other keys in the dir format
+	kvDirValueFile = ".value"
+)
+
+type KVExportCmd struct {
+	bucket    string
+	file      string
+	format    string
+	overwrite bool
+	dryRun    bool
+	prune     bool
+}
+
+// kvImportChange is a change to a single key needed to import data into a bucket
+type kvImportChange struct {
+	action   string
+	key      string
+	value    []byte
+	revision uint64
+}
+
+func configureKVExportCommand(kv *fisk.CmdClause) {
+	c := &KVExportCmd{}
+
+	export := kv.Command("export", "Exports the values in a bucket to a file or directory").Action(c.exportAction)
+	export.HelpLong(`Exports the current values of all keys in a bucket.
+
+Supported formats are json and yaml holding a key to value map, env holding
+KEY=VALUE lines and dir where every key is a file and the key hierarchy,
+separated by dots, is represented by directories.
+
+In json and yaml values that are not valid UTF-8 are base64 encoded and
+prefixed with "base64:", values that start with "base64:" are encoded the
+same way so they survive an import unchanged.
+
+In the dir format a key that is also the prefix of other keys, like app when
+app.port exists, is written to app/.value. Exporting to a directory that is
+not empty replaces its contents, files of keys that are not in the bucket are
+removed while files and directories starting with a dot are kept.
+`)
+	export.Arg("bucket", "The bucket to export").Required().StringVar(&c.bucket)
+	export.Flag("output", "File or directory to write the export to, - for standard output").Short('o').Default("-").StringVar(&c.file)
+	export.Flag("format", "The format to export to").Default(kvFormatJSON).EnumVar(&c.format, kvFormatJSON, kvFormatYAML, kvFormatEnv, kvFormatDir)
+	export.Flag("force", "Overwrite the output file or directory without prompting").Short('f').UnNegatableBoolVar(&c.overwrite)
+
+	imp := kv.Command("import", "Imports values from a file or directory into a bucket").Action(c.importAction)
+	imp.HelpLong(`Imports values into a bucket from a file or directory created using
+'nats kv export' or by hand.
+
+Nested maps in json and yaml files are imported with keys joined by dots, for
+example {"app": {"port": 80}} is stored as app.port. String values starting
+with "base64:" are decoded from base64.
+
+Directories are imported with every file as a key, a .value file holds the
+value of the key named after its directory. Other files and directories
+starting with a dot are ignored.
+
+Changes are applied using the revisions seen when the import was planned, if
+any key is changed by another client during the import the import fails for
+that key.
+`)
+	imp.Arg("bucket", "The bucket to import into").Required().StringVar(&c.bucket)
+	imp.Arg("file", "File or directory holding the values, - for standard input").Required().StringVar(&c.file)
+	imp.Flag("format", "The format of the import, detected from the file name by default").EnumVar(&c.format, kvFormatJSON, kvFormatYAML, kvFormatEnv, kvFormatDir)
+	imp.Flag("dry-run", "Shows the changes that would be made without making them").UnNegatableBoolVar(&c.dryRun)
+	imp.Flag("prune", "Deletes keys from the bucket that are not in the import").UnNegatableBoolVar(&c.prune)
+	imp.Flag("force", "Prune keys without prompting").Short('f').UnNegatableBoolVar(&c.overwrite)
+}
+
+func (c *KVExportCmd) exportAction(_ *fisk.ParseContext) error {
+	_, js, err := prepareJSHelper()
+	fisk.FatalIfError(err, "setup failed")
+
+	store, err := js.KeyValue(c.bucket)
+	if err != nil {
+		return err
+	}
+
+	entries, err := kvCurrentEntries(store)
+	if err != nil {
+		return err
+	}
+
+	values := map[string][]byte{}
+	for k, e := range entries {
+		values[k] = e.Value()
+	}
+
+	if c.format == kvFormatDir {
+		if c.file == "-" {
+			return fmt.Errorf("an output directory is required for the dir format")
+		}
+
+		existing, err := os.ReadDir(c.file)
+		if err == nil && len(existing) > 0 && !c.overwrite {
+			ok, err := askConfirmation(fmt.Sprintf("Replace the contents of directory %s", c.file), false)
+			fisk.FatalIfError(err, "could not obtain confirmation")
+
+			if !ok {
+				return nil
+			}
+		}
+
+		err = writeKVDirectory(c.file, values)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Exported %s keys from bucket %s to %s\n", f(len(values)), c.bucket, c.file)
+		return nil
+	}
+
+	data, err := encodeKVValues(values, c.format)
+	if err != nil {
+		return err
+	}
+
+	if c.file == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	_, err = os.Stat(c.file)
+	if err == nil && !c.overwrite {
+		ok, err := askConfirmation(fmt.Sprintf("Overwrite existing file %s", c.file), false)
+		fisk.FatalIfError(err, "could not obtain confirmation")
+
+		if !ok {
+			return nil
+		}
+	}
+
+	err = os.WriteFile(c.file, data, 0600)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Exported %s keys from bucket %s to %s\n", f(len(values)), c.bucket, c.file)
+
+	return nil
+}
+
+func (c *KVExportCmd) importAction(_ *fisk.ParseContext) error {
+	values, err := c.readImport()
+	if err != nil {
+		return err
+	}
+
+	_, js, err := prepareJSHelper()
+	fisk.FatalIfError(err, "setup failed")
+
+	store, err := js.KeyValue(c.bucket)
+	if err != nil {
+		return err
+	}
+
+	changes, unchanged, err := c.planImport(store, values)
+	if err != nil {
+		return err
+	}
+
+	err = validateKVChanges(js, c.bucket, changes)
+	if err != nil {
+		return err
+	}
+
+	if len(changes) == 0 {
+		fmt.Printf("No changes, bucket %s matches the import\n", c.bucket)
+		return nil
+	}
+
+	create, update, del := countKVChanges(changes)
+
+	if c.dryRun {
+		showKVChanges(c.bucket, changes, unchanged)
+		return nil
+	}
+
+	if del > 0 && !c.overwrite {
+		ok, err := askConfirmation(fmt.Sprintf("Really delete %d keys from bucket %s that are not in the import", del, c.bucket), false)
+		fisk.FatalIfError(err, "could not obtain confirmation")
+
+		if !ok {
+			return nil
+		}
+	}
+
+	err = applyKVImport(store, changes)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported into bucket %s: %d created, %d updated, %d deleted, %d unchanged\n", c.bucket, create, update, del, unchanged)
+
+	return nil
+}
+
+func (c *KVExportCmd) readImport() (map[string][]byte, error) {
+	format := c.format
+
+	if format == "" {
+		if c.file != "-" {
+			nfo, err := os.Stat(c.file)
+			if err != nil {
+				return nil, err
+			}
+			if nfo.IsDir() {
+				format = kvFormatDir
+			}
+		}
+
+		if format == "" {
+			format = kvFormatFromFileName(c.file)
+		}
+	}
+
+	if format == kvFormatDir {
+		return readKVDirectory(c.file)
+	}
+
+	var data []byte
+	var err error
+
+	if c.file == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(c.file)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeKVValues(data, format)
+}
+
+// planImport determines the changes needed to make the bucket match values, returning the changes and the number of unchanged keys
+func (c *KVExportCmd) planImport(store nats.KeyValue, values map[string][]byte) ([]*kvImportChange, int, error) {
+	entries, err := kvCurrentEntries(store)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	changes, unchanged := planKVChanges(entries, values, c.prune)
+
+	return changes, unchanged, nil
+}
+
+// planKVChanges compares the current entries with the desired values, when prune is set keys not in values are deleted
+func planKVChanges(entries map[string]nats.KeyValueEntry, values map[string][]byte, prune bool) ([]*kvImportChange, int) {
+	var changes []*kvImportChange
+	var unchanged int
+
+	keys := mapKeys(values)
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		current, ok := entries[key]
+		switch {
+		case !ok:
+			changes = append(changes, &kvImportChange{action: "create", key: key, value: values[key]})
+		case !bytes.Equal(current.Value(), values[key]):
+			changes = append(changes, &kvImportChange{action: "update", key: key, value: values[key], revision: current.Revision()})
+		default:
+			unchanged++
+		}
+	}
+
+	if prune {
+		keys = mapKeys(entries)
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if _, ok := values[key]; !ok {
+				changes = append(changes, &kvImportChange{action: "delete", key: key, revision: entries[key].Revision()})
+			}
+		}
+	}
+
+	return changes, unchanged
+}
+
+// applyKVImport applies changes using the planned revisions so concurrent changes to a key are not overwritten
+func applyKVImport(store nats.KeyValue, changes []*kvImportChange) error {
+	var failed []string
+
+	for _, change := range changes {
+		var err error
+
+		switch change.action {
+		case "create":
+			_, err = store.Create(change.key, change.value)
+		case "update":
+			_, err = store.Update(change.key, change.value, change.revision)
+		case "delete":
+			err = store.Delete(change.key, nats.LastRevision(change.revision))
+		}
+
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", change.key, err))
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d keys could not be imported:\n\n%s", len(failed), strings.Join(failed, "\n"))
+	}
+
+	return nil
+}
+
+// validateKVChanges validates the values being created or updated against the bucket schema, if any
+func validateKVChanges(js nats.JetStreamContext, bucket string, changes []*kvImportChange) error {
+	schema, err := kvBucketSchema(js, bucket)
+	if err != nil {
+		return err
+	}
+
+	if schema == nil {
+		return nil
+	}
+
+	sch, err := compileJSONSchema(schema)
+	if err != nil {
+		return err
+	}
+
+	var invalid []string
+	for _, change := range changes {
+		if change.action == "delete" {
+			continue
+		}
+
+		ok, errs := new(SchemaValidator).ValidateJSON(change.value, sch)
+		if !ok {
+			invalid = append(invalid, fmt.Sprintf("%s: %s", change.key, strings.Join(errs, ", ")))
+		}
+	}
+
+	if len(invalid) > 0 {
+		return fmt.Errorf("%d values do not match the schema for bucket %s:\n\n%s", len(invalid), bucket, strings.Join(invalid, "\n"))
+	}
+
+	return nil
+}
+
+func countKVChanges(changes []*kvImportChange) (create int, update int, del int) {
+	for _, change := range changes {
+		switch change.action {
+		case "create":
+			create++
+		case "update":
+			update++
+		case "delete":
+			del++
+		}
+	}
+
+	return create, update, del
+}
+
+func showKVChanges(bucket string, changes []*kvImportChange, unchanged int) {
+	fmt.Printf("Changes to bucket %s:\n", bucket)
+	fmt.Println()
+	for _, change := range changes {
+		switch change.action {
+		case "create":
+			fmt.Printf("  %s %s\n", color.GreenString("+ create"), change.key)
+		case "update":
+			fmt.Printf("  %s %s\n", color.YellowString("~ update"), change.key)
+		case "delete":
+			fmt.Printf("  %s %s\n", color.RedString("- delete"), change.key)
+		}
+	}
+	fmt.Println()
+
+	create, update, del := countKVChanges(changes)
+	fmt.Printf("Plan: %d to create, %d to update, %d to delete, %d unchanged\n", create, update, del, unchanged)
+}
+
+// kvCurrentEntries loads the latest entry for every key in the bucket, deleted keys are not included
+func kvCurrentEntries(store nats.KeyValue) (map[string]nats.KeyValueEntry, error) {
+	w, err := store.WatchAll(nats.IgnoreDeletes())
+	if err != nil {
+		return nil, err
+	}
+	defer w.Stop()
+
+	entries := map[string]nats.KeyValueEntry{}
+	for entry := range w.Updates() {
+		// a nil entry marks the end of the initial values
+		if entry == nil {
+			break
+		}
+
+		entries[entry.Key()] = entry
+	}
+
+	return entries, nil
+}
+
+func kvFormatFromFileName(file string) string {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		return kvFormatYAML
+	case ".env":
+		return kvFormatEnv
+	default:
+		return kvFormatJSON
+	}
+}
+
+func encodeKVValues(values map[string][]byte, format string) ([]byte, error) {
+	switch format {
+	case kvFormatJSON, kvFormatYAML:
+		strs := map[string]string{}
+		for k, v := range values {
+			strs[k] = encodeKVString(v)
+		}
+
+		j, err := json.MarshalIndent(strs, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+
+		if format == kvFormatJSON {
+			return append(j, '\n'), nil
+		}
+
+		return yaml.JSONToYAML(j)
+
+	case kvFormatEnv:
+		keys := mapKeys(values)
+		sort.Strings(keys)
+
+		buf := bytes.NewBuffer(nil)
+		for _, k := range keys {
+			fmt.Fprintf(buf, "%s=%s\n", k, strconv.Quote(string(values[k])))
+		}
+
+		return buf.Bytes(), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+func decodeKVValues(data []byte, format string) (map[string][]byte, error) {
+	switch format {
+	case kvFormatJSON, kvFormatYAML:
+		var err error
+		if format == kvFormatYAML {
+			data, err = yaml.YAMLToJSON(data)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		var doc map[string]any
+		err = json.Unmarshal(data, &doc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s import: %w", format, err)
+		}
+
+		values := map[string][]byte{}
+		err = flattenKVValues("", doc, values)
+		if err != nil {
+			return nil, err
+		}
+
+		return values, nil
+
+	case kvFormatEnv:
+		return parseKVEnv(data)
+
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+// flattenKVValues stores every value in doc in values, nested maps are stored with their keys joined by dots
+func flattenKVValues(prefix string, doc map[string]any, values map[string][]byte) error {
+	for k, v := range doc {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+
+		switch val := v.(type) {
+		case map[string]any:
+			err := flattenKVValues(key, val, values)
+			if err != nil {
+				return err
+			}
+		case string:
+			decoded, err := decodeKVString(val)
+			if err != nil {
+				return fmt.Errorf("invalid value for key %s: %w", key, err)
+			}
+			values[key] = decoded
+		case nil:
+			values[key] = nil
+		default:
+			j, err := json.Marshal(val)
+			if err != nil {
+				return err
+			}
+			values[key] = j
+		}
+	}
+
+	return nil
+}
+
+// encodeKVString encodes values that are not valid UTF-8, or that look encoded, as base64 with kvBase64Prefix
+func encodeKVString(v []byte) string {
+	if utf8.Valid(v) && !bytes.HasPrefix(v, []byte(kvBase64Prefix)) {
+		return string(v)
+	}
+
+	return kvBase64Prefix + base64.StdEncoding.EncodeToString(v)
+}
+
+// decodeKVString reverses encodeKVString
+func decodeKVString(v string) ([]byte, error) {
+	encoded, ok := strings.CutPrefix(v, kvBase64Prefix)
+	if !ok {
+		return []byte(v), nil
+	}
+
+	return base64.StdEncoding.DecodeString(encoded)
+}
+
+// parseKVEnv parses KEY=VALUE lines, values can be double quoted and lines starting with # are ignored
+func parseKVEnv(data []byte) (map[string][]byte, error) {
+	values := map[string][]byte{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		text = strings.TrimPrefix(text, "export ")
+		key, val, ok := strings.Cut(text, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid env import line %d: expected KEY=VALUE", line)
+		}
+
+		val = strings.TrimSpace(val)
+		switch {
+		case strings.HasPrefix(val, `"`):
+			unquoted, err := strconv.Unquote(val)
+			if err != nil {
+				return nil, fmt.Errorf("invalid env import line %d: %w", line, err)
+			}
+			val = unquoted
+		case len(val) > 1 && strings.HasPrefix(val, "'") && strings.HasSuffix(val, "'"):
+			val = val[1 : len(val)-1]
+		}
+
+		values[key] = []byte(val)
+	}
+
+	return values, scanner.Err()
+}
+
+// writeKVDirectory writes every key to a file with the key hierarchy as directories, keys that
+// are also prefixes of other keys are written to kvDirValueFile in their directory. Files in dir
+// that do not hold a key are removed
+func writeKVDirectory(dir string, values map[string][]byte) error {
+	keys := mapKeys(values)
+	sort.Strings(keys)
+
+	prefixes := map[string]bool{}
+	for _, key := range keys {
+		for i, c := range key {
+			if c == '.' {
+				prefixes[key[:i]] = true
+			}
+		}
+	}
+
+	files := make(map[string]string, len(keys))
+	for _, key := range keys {
+		parts := strings.Split(key, ".")
+		for _, p := range parts {
+			if p == "" || p == ".." || strings.ContainsRune(p, os.PathSeparator) {
+				return fmt.Errorf("key %q can not be exported to a directory", key)
+			}
+		}
+
+		if prefixes[key] {
+			parts = append(parts, kvDirValueFile)
+		}
+
+		files[key] = filepath.Join(append([]string{dir}, parts...)...)
+	}
+
+	// stale files are removed first as keys might have turned into directories or the other way around
+	err := removeStaleKVFiles(dir, files)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		file := files[key]
+		err := os.MkdirAll(filepath.Dir(file), 0700)
+		if err != nil {
+			return fmt.Errorf("could not export key %q: %w", key, err)
+		}
+
+		err = os.WriteFile(file, values[key], 0600)
+		if err != nil {
+			return fmt.Errorf("could not export key %q: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+// removeStaleKVFiles removes files in dir that readKVDirectory would import but that are not in files
+// and directories left empty by doing so, files and directories starting with a dot are kept
+func removeStaleKVFiles(dir string, files map[string]string) error {
+	keep := make(map[string]bool, len(files))
+	for _, file := range files {
+		keep[file] = true
+	}
+
+	var dirs []string
+	err := filepath.Walk(dir, func(path string, d os.FileInfo, err error) error {
+		if path == dir && errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if path == dir {
+				return nil
+			}
+			if strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+
+			dirs = append(dirs, path)
+			return nil
+		}
+
+		if keep[path] || (strings.HasPrefix(d.Name(), ".") && d.Name() != kvDirValueFile) {
+			return nil
+		}
+
+		return os.Remove(path)
+	})
+	if err != nil {
+		return err
+	}
+
+	// directories are walked in lexical order so children are visited last
+	for i := len(dirs) - 1; i >= 0; i-- {
+		entries, err := os.ReadDir(dirs[i])
+		if err != nil {
+			return err
+		}
+
+		if len(entries) == 0 {
+			err = os.Remove(dirs[i])
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// readKVDirectory reads every file in dir as a key with directories joined by dots, a kvDirValueFile
+// holds the value for the key named after its directory
+func readKVDirectory(dir string) (map[string][]byte, error) {
+	values := map[string][]byte{}
+
+	err := filepath.Walk(dir, func(path string, d os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if path != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		isValue := d.Name() == kvDirValueFile
+		if strings.HasPrefix(d.Name(), ".") && !isValue {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		if isValue {
+			rel = filepath.Dir(rel)
+			if rel == "." {
+				return nil
+			}
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		values[strings.Join(strings.Split(rel, string(os.PathSeparator)), ".")] = data
+
+		return nil
+	})
+
+	return values, err
+}
@@ -0,0 +1,179 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nats-io/jsm.go"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+func TestKVValueFormats(t *testing.T) {
+	values := map[string][]byte{
+		"app.port":    []byte("80"),
+		"app.name":    []byte("orders service"),
+		"app.banner":  []byte("line 1\nline \"2\""),
+		"db.password": []byte("s3cret=yes"),
+		"db":          []byte("postgres"),
+		"db.cert":     {0xde, 0xad, 0xbe, 0xef},
+		"db.note":     []byte("base64:not encoded"),
+	}
+
+	for _, format := range []string{kvFormatJSON, kvFormatYAML, kvFormatEnv} {
+		data, err := encodeKVValues(values, format)
+		assertNoError(t, err)
+
+		res, err := decodeKVValues(data, format)
+		assertNoError(t, err)
+
+		if !cmp.Equal(values, res) {
+			t.Fatalf("%s round trip failed: %s", format, cmp.Diff(values, res))
+		}
+	}
+
+	dir := t.TempDir()
+	assertNoError(t, writeKVDirectory(dir, values))
+	res, err := readKVDirectory(dir)
+	assertNoError(t, err)
+	if !cmp.Equal(values, res) {
+		t.Fatalf("dir round trip failed: %s", cmp.Diff(values, res))
+	}
+	_, err = os.Stat(filepath.Join(dir, "db", ".value"))
+	assertNoError(t, err)
+
+	// exporting again removes keys that were deleted and keeps dot files
+	assertNoError(t, os.WriteFile(filepath.Join(dir, ".keep"), []byte("x"), 0600))
+	updated := map[string][]byte{"app.port": []byte("81"), "db": []byte("mysql")}
+	assertNoError(t, writeKVDirectory(dir, updated))
+	res, err = readKVDirectory(dir)
+	assertNoError(t, err)
+	if !cmp.Equal(updated, res) {
+		t.Fatalf("dir update failed: %s", cmp.Diff(updated, res))
+	}
+	_, err = os.Stat(filepath.Join(dir, ".keep"))
+	assertNoError(t, err)
+	nfo, err := os.Stat(filepath.Join(dir, "db"))
+	assertNoError(t, err)
+	if nfo.IsDir() {
+		t.Fatalf("expected db to be a file once its children were removed")
+	}
+	assertNoError(t, writeKVDirectory(filepath.Join(dir, "new"), updated))
+
+	data, err := encodeKVValues(values, kvFormatJSON)
+	assertNoError(t, err)
+	if !bytes.Contains(data, []byte(`"db.cert": "base64:3q2+7w=="`)) {
+		t.Fatalf("expected binary value to be base64 encoded: %s", data)
+	}
+
+	res, err = decodeKVValues([]byte(`{"app": {"port": 80, "debug": true, "name": "x"}}`), kvFormatJSON)
+	assertNoError(t, err)
+	expected := map[string][]byte{"app.port": []byte("80"), "app.debug": []byte("true"), "app.name": []byte("x")}
+	if !cmp.Equal(expected, res) {
+		t.Fatalf("nested import failed: %s", cmp.Diff(expected, res))
+	}
+
+	res, err = parseKVEnv([]byte("# comment\nexport A=1\nB='two words'\n\nC = \"x\\ty\"\n"))
+	assertNoError(t, err)
+	expected = map[string][]byte{"A": []byte("1"), "B": []byte("two words"), "C": []byte("x\ty")}
+	if !cmp.Equal(expected, res) {
+		t.Fatalf("env import failed: %s", cmp.Diff(expected, res))
+	}
+
+	_, err = parseKVEnv([]byte("INVALID"))
+	if err == nil {
+		t.Fatalf("expected an error for invalid env lines")
+	}
+}
+
+func TestKVImport(t *testing.T) {
+	withJetStream(t, func(_ *server.Server, nc *nats.Conn, _ *jsm.Manager) {
+		js, err := nc.JetStream()
+		assertNoError(t, err)
+
+		store, err := js.CreateKeyValue(&nats.KeyValueConfig{Bucket: "CONFIG"})
+		assertNoError(t, err)
+
+		_, err = store.Put("app.port", []byte("80"))
+		assertNoError(t, err)
+		_, err = store.Put("app.name", []byte("orders"))
+		assertNoError(t, err)
+		_, err = store.Put("app.legacy", []byte("yes"))
+		assertNoError(t, err)
+
+		file := filepath.Join(t.TempDir(), "config.yaml")
+		exp := &KVExportCmd{bucket: "CONFIG", file: file, format: kvFormatYAML}
+		assertNoError(t, exp.exportAction(nil))
+
+		imp := &KVExportCmd{bucket: "CONFIG", file: file}
+		values, err := imp.readImport()
+		assertNoError(t, err)
+
+		changes, unchanged, err := imp.planImport(store, values)
+		assertNoError(t, err)
+		if len(changes) != 0 || unchanged != 3 {
+			t.Fatalf("expected no changes got %d changes and %d unchanged", len(changes), unchanged)
+		}
+
+		delete(values, "app.legacy")
+		values["app.port"] = []byte("8080")
+		values["app.debug"] = []byte("true")
+
+		imp.prune = true
+		changes, unchanged, err = imp.planImport(store, values)
+		assertNoError(t, err)
+		if len(changes) != 3 || unchanged != 1 {
+			t.Fatalf("expected 3 changes got %d changes and %d unchanged", len(changes), unchanged)
+		}
+
+		actions := map[string]string{}
+		for _, change := range changes {
+			actions[change.key] = change.action
+		}
+		if !cmp.Equal(actions, map[string]string{"app.debug": "create", "app.port": "update", "app.legacy": "delete"}) {
+			t.Fatalf("invalid changes: %v", actions)
+		}
+
+		// a concurrent change to a key after planning should not be overwritten
+		_, err = store.Put("app.port", []byte("9090"))
+		assertNoError(t, err)
+
+		err = applyKVImport(store, changes)
+		if err == nil {
+			t.Fatalf("expected a revision error")
+		}
+
+		entry, err := store.Get("app.port")
+		assertNoError(t, err)
+		if string(entry.Value()) != "9090" {
+			t.Fatalf("concurrent update was overwritten: %q", entry.Value())
+		}
+
+		_, err = store.Get("app.legacy")
+		if err != nats.ErrKeyNotFound {
+			t.Fatalf("expected app.legacy to be deleted: %v", err)
+		}
+
+		entry, err = store.Get("app.debug")
+		assertNoError(t, err)
+		if string(entry.Value()) != "true" {
+			t.Fatalf("invalid app.debug value %q", entry.Value())
+		}
+	})
+}
@@ -0,0 +1,500 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/choria-io/fisk"
+	"github.com/nats-io/nats.go"
+)
+
+type KVLockCmd struct {
+	bucket  string
+	key     string
+	owner   string
+	ttl     time.Duration
+	wait    time.Duration
+	command []string
+	force   bool
+	json    bool
+}
+
+// kvLock is the value stored in a key while a lock is held
+type kvLock struct {
+	Owner    string    `json:"owner"`
+	Acquired time.Time `json:"acquired"`
+	Expires  time.Time `json:"expires"`
+	Revision uint64    `json:"revision"`
+}
+
+// kvLockHeldError indicates the lock is held by another owner
+type kvLockHeldError struct {
+	lock *kvLock
+}
+
+func (e *kvLockHeldError) Error() string {
+	return fmt.Sprintf("lock is held by %s until %s", e.lock.Owner, e.lock.Expires.Format(time.RFC3339))
+}
+
+func (l *kvLock) expired() bool {
+	return time.Now().After(l.Expires)
+}
+
+func configureKVLockCommand(kv *fisk.CmdClause) {
+	c := &KVLockCmd{}
+
+	help := `Locks are stored in a key as a JSON document holding the owner and an
+expiry time. A lock is acquired by creating the key, or by updating it when
+the existing lock expired, renewed by updating the key with a new expiry time
+and released by deleting the key. Every change uses the revision of the key
+to guard against concurrent changes by other clients.
+
+Expiry relies on the clocks of the clients being roughly in sync, locks should
+be renewed well before they expire. An expired lock can not be renewed, it has
+to be acquired again.
+
+The owner defaults to NATS_KV_LOCK_OWNER or else the host name so a lock can
+be acquired, renewed and released by separate commands. Leases and exec hold
+the lock in a single process and add the process ID to the default owner, set
+--owner to something unique when several processes on the same host acquire
+the same lock using separate commands.
+`
+
+	lock := kv.Command("lock", "Distributed locks stored in a bucket")
+	lock.HelpLong(help)
+
+	addCommon := func(cmd *fisk.CmdClause, ttl bool) {
+		cmd.Arg("bucket", "The bucket holding the lock").Required().StringVar(&c.bucket)
+		cmd.Arg("key", "The key holding the lock").Required().StringVar(&c.key)
+		cmd.Flag("owner", "The identity of the lock owner").StringVar(&c.owner)
+		if ttl {
+			cmd.Flag("ttl", "How long the lock is valid for before it must be renewed").Default("30s").DurationVar(&c.ttl)
+		}
+	}
+
+	acquire := lock.Command("acquire", "Acquires a lock").Action(c.acquireAction)
+	addCommon(acquire, true)
+	acquire.Flag("wait", "How long to wait for a held lock to become available").DurationVar(&c.wait)
+	acquire.Flag("json", "Produce JSON output").Short('j').UnNegatableBoolVar(&c.json)
+
+	renew := lock.Command("renew", "Extends the expiry time of a held lock").Action(c.renewAction)
+	addCommon(renew, true)
+	renew.Flag("json", "Produce JSON output").Short('j').UnNegatableBoolVar(&c.json)
+
+	release := lock.Command("release", "Releases a held lock").Action(c.releaseAction)
+	addCommon(release, false)
+	release.Flag("force", "Releases the lock even when held by another owner").Short('f').UnNegatableBoolVar(&c.force)
+
+	status := lock.Command("status", "Shows the state of a lock").Alias("info").Action(c.statusAction)
+	status.Arg("bucket", "The bucket holding the lock").Required().StringVar(&c.bucket)
+	status.Arg("key", "The key holding the lock").Required().StringVar(&c.key)
+	status.Flag("json", "Produce JSON output").Short('j').UnNegatableBoolVar(&c.json)
+
+	lockExec := lock.Command("exec", "Runs a command while holding a lock").Action(c.execAction)
+	lockExec.HelpLong(`Acquires the lock, runs the command and releases the lock once the command
+completes. The lock is renewed while the command runs, if the lock is lost the
+command is terminated.
+
+Use -- to separate the command from the flags:
+
+  nats kv lock exec LOCKS backup --ttl 1m -- /usr/local/bin/backup.sh --full
+`)
+	addCommon(lockExec, true)
+	lockExec.Arg("command", "The command to run").Required().StringsVar(&c.command)
+	lockExec.Flag("wait", "How long to wait for a held lock to become available").DurationVar(&c.wait)
+
+	lease := kv.Command("lease", "Holds a lock until interrupted, renewing it as needed").Action(c.leaseAction)
+	lease.HelpLong(help + `
+The lease is renewed every third of the TTL and released on exit. Combined
+with --wait this can be used for leader election where the process holding
+the lease is the leader.
+`)
+	addCommon(lease, true)
+	lease.Flag("wait", "How long to wait for a held lease to become available").DurationVar(&c.wait)
+}
+
+// kvLockDefaultOwner is the owner used when --owner is not given, when process is set the process ID is added
+func kvLockDefaultOwner(process bool) string {
+	owner := os.Getenv("NATS_KV_LOCK_OWNER")
+	if owner != "" {
+		return owner
+	}
+
+	owner, err := os.Hostname()
+	if err != nil {
+		owner = "unknown"
+	}
+
+	if process {
+		owner = fmt.Sprintf("%s:%d", owner, os.Getpid())
+	}
+
+	return owner
+}
+
+// loadStore loads the bucket holding the lock, process indicates the lock is held by this process only
+func (c *KVLockCmd) loadStore(process bool) (nats.KeyValue, error) {
+	if c.owner == "" {
+		c.owner = kvLockDefaultOwner(process)
+	}
+
+	if c.ttl < 0 || (c.ttl > 0 && c.ttl < 3*time.Second) {
+		return nil, fmt.Errorf("the lock TTL must be at least 3 seconds")
+	}
+
+	_, js, err := prepareJSHelper()
+	fisk.FatalIfError(err, "setup failed")
+
+	return js.KeyValue(c.bucket)
+}
+
+func (c *KVLockCmd) acquireAction(_ *fisk.ParseContext) error {
+	store, err := c.loadStore(false)
+	if err != nil {
+		return err
+	}
+
+	lock, err := c.acquire(ctx, store)
+	if err != nil {
+		return err
+	}
+
+	return c.showLock("Acquired", lock)
+}
+
+func (c *KVLockCmd) renewAction(_ *fisk.ParseContext) error {
+	store, err := c.loadStore(false)
+	if err != nil {
+		return err
+	}
+
+	lock, err := renewKVLock(store, c.key, c.owner, c.ttl)
+	if err != nil {
+		return err
+	}
+
+	return c.showLock("Renewed", lock)
+}
+
+func (c *KVLockCmd) releaseAction(_ *fisk.ParseContext) error {
+	store, err := c.loadStore(false)
+	if err != nil {
+		return err
+	}
+
+	err = releaseKVLock(store, c.key, c.owner, c.force)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Released lock %s > %s\n", c.bucket, c.key)
+
+	return nil
+}
+
+func (c *KVLockCmd) statusAction(_ *fisk.ParseContext) error {
+	store, err := c.loadStore(false)
+	if err != nil {
+		return err
+	}
+
+	lock, err := loadKVLock(store, c.key)
+	if err != nil {
+		return err
+	}
+
+	if lock == nil {
+		if c.json {
+			return printJSON(map[string]bool{"held": false})
+		}
+
+		fmt.Printf("Lock %s > %s is not held\n", c.bucket, c.key)
+		return nil
+	}
+
+	if c.json {
+		return printJSON(lock)
+	}
+
+	cols := newColumns(fmt.Sprintf("Lock %s > %s", c.bucket, c.key))
+	cols.AddRow("Owner", lock.Owner)
+	cols.AddRow("Acquired", lock.Acquired)
+	cols.AddRow("Expires", lock.Expires)
+	cols.AddRow("Expired", lock.expired())
+	cols.AddRow("Revision", lock.Revision)
+	cols.Frender(os.Stdout)
+
+	return nil
+}
+
+func (c *KVLockCmd) leaseAction(_ *fisk.ParseContext) error {
+	store, err := c.loadStore(true)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(ctx, syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	_, err = c.acquire(ctx, store)
+	if err != nil {
+		return err
+	}
+	defer releaseKVLock(store, c.key, c.owner, false)
+
+	log.Printf("Acquired lease %s > %s as %s, press ^C to release", c.bucket, c.key, c.owner)
+
+	err = c.hold(ctx, store)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Released lease %s > %s", c.bucket, c.key)
+
+	return nil
+}
+
+func (c *KVLockCmd) execAction(_ *fisk.ParseContext) error {
+	store, err := c.loadStore(true)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(ctx, syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	_, err = c.acquire(ctx, store)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(c.command[0], c.command[1:]...)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("NATS_KV_LOCK_OWNER=%s", c.owner))
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err = cmd.Start()
+	if err != nil {
+		releaseKVLock(store, c.key, c.owner, false)
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	holdCtx, stopHold := context.WithCancel(ctx)
+	defer stopHold()
+
+	lost := make(chan error, 1)
+	go func() { lost <- c.hold(holdCtx, store) }()
+
+	select {
+	case err = <-done:
+		stopHold()
+		<-lost
+
+	case err = <-lost:
+		cmd.Process.Signal(syscall.SIGTERM)
+		if err != nil {
+			log.Printf("Terminated %s: %s", c.command[0], err)
+			<-done
+			return err
+		}
+
+		// interrupted, release the lock once the command exited
+		err = <-done
+	}
+
+	rerr := releaseKVLock(store, c.key, c.owner, false)
+	if rerr != nil {
+		log.Printf("Could not release lock: %s", rerr)
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.ExitCode())
+	}
+
+	return err
+}
+
+// acquire acquires the lock, retrying until c.wait passed when it is held by another owner
+func (c *KVLockCmd) acquire(ctx context.Context, store nats.KeyValue) (*kvLock, error) {
+	deadline := time.Now().Add(c.wait)
+
+	for {
+		lock, err := acquireKVLock(store, c.key, c.owner, c.ttl)
+		var held *kvLockHeldError
+		if err == nil || !errors.As(err, &held) || time.Now().After(deadline) {
+			return lock, err
+		}
+
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// hold renews the lock every third of the ttl until ctx is done, returns an error if the lock could not be renewed
+func (c *KVLockCmd) hold(ctx context.Context, store nats.KeyValue) error {
+	ticker := time.NewTicker(c.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			_, err := renewKVLock(store, c.key, c.owner, c.ttl)
+			if err != nil {
+				return fmt.Errorf("lost lock: %w", err)
+			}
+
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (c *KVLockCmd) showLock(action string, lock *kvLock) error {
+	if c.json {
+		return printJSON(lock)
+	}
+
+	fmt.Printf("%s lock %s > %s as %s until %s\n", action, c.bucket, c.key, lock.Owner, lock.Expires.Format(time.RFC3339))
+
+	return nil
+}
+
+// loadKVLock loads the current lock, nil when the lock is not held
+func loadKVLock(store nats.KeyValue, key string) (*kvLock, error) {
+	entry, err := store.Get(key)
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	lock := &kvLock{}
+	err = json.Unmarshal(entry.Value(), lock)
+	if err != nil {
+		return nil, fmt.Errorf("key %s does not hold a lock: %w", key, err)
+	}
+	lock.Revision = entry.Revision()
+
+	return lock, nil
+}
+
+// acquireKVLock creates the lock or takes over an expired lock
+func acquireKVLock(store nats.KeyValue, key string, owner string, ttl time.Duration) (*kvLock, error) {
+	now := time.Now().UTC()
+	lock := &kvLock{Owner: owner, Acquired: now, Expires: now.Add(ttl)}
+
+	val, err := json.Marshal(lock)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		lock.Revision, err = store.Create(key, val)
+		if err == nil {
+			return lock, nil
+		}
+		if !errors.Is(err, nats.ErrKeyExists) {
+			return nil, err
+		}
+
+		current, err := loadKVLock(store, key)
+		if err != nil {
+			return nil, err
+		}
+
+		// the lock was released between the create and the load
+		if current == nil {
+			continue
+		}
+
+		if !current.expired() {
+			return nil, &kvLockHeldError{lock: current}
+		}
+
+		lock.Revision, err = store.Update(key, val, current.Revision)
+		if err != nil {
+			return nil, fmt.Errorf("could not take over expired lock: %w", err)
+		}
+
+		return lock, nil
+	}
+}
+
+// renewKVLock extends the expiry of a lock held by owner
+func renewKVLock(store nats.KeyValue, key string, owner string, ttl time.Duration) (*kvLock, error) {
+	current, err := loadKVLock(store, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if current == nil {
+		return nil, fmt.Errorf("lock is not held")
+	}
+	if current.Owner != owner {
+		return nil, &kvLockHeldError{lock: current}
+	}
+
+	// once expired others could have held the lock in the meantime, so it has to be acquired again
+	if current.expired() {
+		return nil, fmt.Errorf("lock expired at %s", current.Expires.Format(time.RFC3339))
+	}
+
+	lock := &kvLock{Owner: owner, Acquired: current.Acquired, Expires: time.Now().UTC().Add(ttl)}
+	val, err := json.Marshal(lock)
+	if err != nil {
+		return nil, err
+	}
+
+	lock.Revision, err = store.Update(key, val, current.Revision)
+	if err != nil {
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+// releaseKVLock deletes a lock held by owner, or held by anyone when force is set
+func releaseKVLock(store nats.KeyValue, key string, owner string, force bool) error {
+	current, err := loadKVLock(store, key)
+	if err != nil {
+		return err
+	}
+
+	if current == nil {
+		return fmt.Errorf("lock is not held")
+	}
+	if current.Owner != owner && !force {
+		return &kvLockHeldError{lock: current}
+	}
+
+	return store.Delete(key, nats.LastRevision(current.Revision))
+}
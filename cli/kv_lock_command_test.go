@@ -0,0 +1,114 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/jsm.go"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+func TestKVLock(t *testing.T) {
+	withJetStream(t, func(_ *server.Server, nc *nats.Conn, _ *jsm.Manager) {
+		js, err := nc.JetStream()
+		assertNoError(t, err)
+
+		store, err := js.CreateKeyValue(&nats.KeyValueConfig{Bucket: "LOCKS"})
+		assertNoError(t, err)
+
+		lock, err := loadKVLock(store, "job")
+		assertNoError(t, err)
+		if lock != nil {
+			t.Fatalf("expected no lock")
+		}
+
+		lock, err = acquireKVLock(store, "job", "a", time.Minute)
+		assertNoError(t, err)
+		if lock.Owner != "a" || lock.Revision == 0 {
+			t.Fatalf("invalid lock: %+v", lock)
+		}
+
+		var held *kvLockHeldError
+		_, err = acquireKVLock(store, "job", "b", time.Minute)
+		if !errors.As(err, &held) || held.lock.Owner != "a" {
+			t.Fatalf("expected lock held by a, got %v", err)
+		}
+
+		_, err = renewKVLock(store, "job", "b", time.Minute)
+		if !errors.As(err, &held) {
+			t.Fatalf("expected renew by b to fail, got %v", err)
+		}
+
+		renewed, err := renewKVLock(store, "job", "a", time.Hour)
+		assertNoError(t, err)
+		if !renewed.Expires.After(lock.Expires) || renewed.Revision <= lock.Revision {
+			t.Fatalf("lock was not renewed: %+v", renewed)
+		}
+
+		err = releaseKVLock(store, "job", "b", false)
+		if !errors.As(err, &held) {
+			t.Fatalf("expected release by b to fail, got %v", err)
+		}
+
+		assertNoError(t, releaseKVLock(store, "job", "a", false))
+		lock, err = loadKVLock(store, "job")
+		assertNoError(t, err)
+		if lock != nil {
+			t.Fatalf("expected lock to be released")
+		}
+
+		// acquire after release and take over an expired lock
+		_, err = acquireKVLock(store, "job", "b", time.Millisecond)
+		assertNoError(t, err)
+		time.Sleep(10 * time.Millisecond)
+
+		_, err = renewKVLock(store, "job", "b", time.Minute)
+		if err == nil || !strings.Contains(err.Error(), "expired") {
+			t.Fatalf("expected renewing an expired lock to fail, got %v", err)
+		}
+
+		lock, err = acquireKVLock(store, "job", "c", time.Minute)
+		assertNoError(t, err)
+		if lock.Owner != "c" {
+			t.Fatalf("expected c to take over the expired lock: %+v", lock)
+		}
+
+		assertNoError(t, releaseKVLock(store, "job", "a", true))
+	})
+}
+
+func TestKVLockDefaultOwner(t *testing.T) {
+	t.Setenv("NATS_KV_LOCK_OWNER", "")
+
+	host := kvLockDefaultOwner(false)
+	if host == "" || strings.Contains(host, ":") {
+		t.Fatalf("expected a stable default owner got %q", host)
+	}
+
+	if owner := kvLockDefaultOwner(true); owner != fmt.Sprintf("%s:%d", host, os.Getpid()) {
+		t.Fatalf("expected the process ID in the owner got %q", owner)
+	}
+
+	t.Setenv("NATS_KV_LOCK_OWNER", "worker")
+	if owner := kvLockDefaultOwner(true); owner != "worker" {
+		t.Fatalf("expected the owner from the environment got %q", owner)
+	}
+}
@@ -0,0 +1,247 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/choria-io/fisk"
+	"github.com/fatih/color"
+	"github.com/nats-io/nats.go"
+)
+
+type KVRestoreCmd struct {
+	bucket   string
+	time     string
+	revision uint64
+	dryRun   bool
+	force    bool
+	partial  bool
+}
+
+// kvSnapshot is the view of a bucket as of a point in its history
+type kvSnapshot struct {
+	values map[string][]byte
+	// the last revision included in the snapshot
+	revision uint64
+	// history before the point was removed in a way that could hide the value some keys had at the point
+	truncated bool
+	// the point is before the oldest message retained in the bucket
+	beforeHistory bool
+}
+
+func configureKVRestoreCommand(kv *fisk.CmdClause) {
+	c := &KVRestoreCmd{}
+
+	restore := kv.Command("restore-at", "Restores the entire bucket to how it was at a point in time or revision").Action(c.restoreAction)
+	restore.HelpLong(`Calculates the values of all keys as of a time or revision using the history
+retained in the bucket and then puts and deletes keys to restore the bucket to
+that state.
+
+Only history kept in the bucket can be used, buckets should be created with
+a history larger than 1. A point older than the retained history can not be
+restored accurately and is refused unless --partial is given.
+
+Restored values are validated against the bucket schema, if one is set.
+
+The time can be a RFC3339 timestamp or a duration like 1h indicating a time
+in the past.
+`)
+	restore.Arg("bucket", "The bucket to restore").Required().StringVar(&c.bucket)
+	restore.Flag("time", "Restores the bucket to how it was at this time").PlaceHolder("TIME").StringVar(&c.time)
+	restore.Flag("revision", "Restores the bucket to how it was at this revision").PlaceHolder("REVISION").Uint64Var(&c.revision)
+	restore.Flag("dry-run", "Shows the changes that would be made without making them").UnNegatableBoolVar(&c.dryRun)
+	restore.Flag("force", "Restore without prompting").Short('f').UnNegatableBoolVar(&c.force)
+	restore.Flag("partial", "Restores to a point older than the retained history using the history that remains").UnNegatableBoolVar(&c.partial)
+}
+
+func (c *KVRestoreCmd) restoreAction(_ *fisk.ParseContext) error {
+	if (c.time == "") == (c.revision == 0) {
+		return fmt.Errorf("either --time or --revision is required")
+	}
+
+	var until time.Time
+	if c.time != "" {
+		var err error
+		until, err = parseTimeOrAge(c.time)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, js, err := prepareJSHelper()
+	fisk.FatalIfError(err, "setup failed")
+
+	store, err := js.KeyValue(c.bucket)
+	if err != nil {
+		return err
+	}
+
+	status, err := store.Status()
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := kvSnapshotAt(js, c.bucket, c.revision, until)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case snapshot.beforeHistory && !c.partial:
+		return fmt.Errorf("the requested point is older than the history retained in bucket %s, use --partial to restore it inaccurately", c.bucket)
+	case snapshot.beforeHistory:
+		fmt.Printf("%s: the requested point is older than the history retained in bucket %s, the restored state will not be accurate\n\n", color.HiRedString("WARNING"), c.bucket)
+	case snapshot.truncated:
+		fmt.Printf("%s: some history before the requested point was removed by bucket limits, keys might be missing or have newer values\n\n", color.YellowString("WARNING"))
+	}
+	if status.History() == 1 {
+		fmt.Printf("%s: bucket %s keeps only 1 historic value per key, create buckets with --history to allow restores\n\n", color.YellowString("WARNING"), c.bucket)
+	}
+
+	entries, err := kvCurrentEntries(store)
+	if err != nil {
+		return err
+	}
+
+	changes, unchanged := planKVChanges(entries, snapshot.values, true)
+	if len(changes) == 0 {
+		fmt.Printf("No changes, bucket %s matches its state at revision %d\n", c.bucket, snapshot.revision)
+		return nil
+	}
+
+	err = validateKVChanges(js, c.bucket, changes)
+	if err != nil {
+		return err
+	}
+
+	showKVChanges(c.bucket, changes, unchanged)
+
+	if c.dryRun {
+		return nil
+	}
+
+	if !c.force {
+		fmt.Println()
+		ok, err := askConfirmation(fmt.Sprintf("Really restore bucket %s to its state at revision %d", c.bucket, snapshot.revision), false)
+		fisk.FatalIfError(err, "could not obtain confirmation")
+
+		if !ok {
+			return nil
+		}
+	}
+
+	err = applyKVImport(store, changes)
+	if err != nil {
+		return err
+	}
+
+	create, update, del := countKVChanges(changes)
+	fmt.Println()
+	fmt.Printf("Restored bucket %s to revision %d: %d created, %d updated, %d deleted\n", c.bucket, snapshot.revision, create, update, del)
+
+	return nil
+}
+
+// kvSnapshotAt replays the bucket history up to and including revision, or up to until when revision is 0
+func kvSnapshotAt(js nats.JetStreamContext, bucket string, revision uint64, until time.Time) (*kvSnapshot, error) {
+	stream := "KV_" + bucket
+	prefix := fmt.Sprintf("$KV.%s.", bucket)
+
+	nfo, err := js.StreamInfo(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &kvSnapshot{values: map[string][]byte{}}
+
+	switch {
+	case revision > 0 && nfo.State.FirstSeq > revision:
+		snapshot.beforeHistory = true
+	case !until.IsZero() && nfo.State.Msgs > 0 && nfo.State.FirstTime.After(until) && nfo.State.FirstSeq > 1:
+		snapshot.beforeHistory = true
+	}
+
+	filter := streamMessageFilter{endSeq: revision, until: until}
+	seen := map[string]bool{}
+	var last uint64
+	var gaps bool
+
+	err = eachStreamMessage(js, stream, filter, func(msg *nats.Msg, meta *nats.MsgMetadata) error {
+		if meta.Sequence.Stream != last+1 {
+			gaps = true
+		}
+		last = meta.Sequence.Stream
+		snapshot.revision = last
+
+		key := strings.TrimPrefix(msg.Subject, prefix)
+		seen[key] = true
+
+		switch msg.Header.Get("KV-Operation") {
+		case "DEL", "PURGE":
+			delete(snapshot.values, key)
+		default:
+			snapshot.values[key] = msg.Data
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !gaps {
+		return snapshot, nil
+	}
+
+	// age and size limits remove the oldest messages regardless of key so any gap could hide a value
+	cfg := nfo.Config
+	if cfg.MaxAge > 0 || cfg.MaxBytes > 0 || cfg.MaxMsgs > 0 {
+		snapshot.truncated = true
+		return snapshot, nil
+	}
+
+	// history limits and purges only remove values of keys that were later written again, those
+	// hide a value when the key has no retained revision at or before the point
+	nfo, err = js.StreamInfo(stream, &nats.StreamInfoRequest{SubjectsFilter: prefix + ">"})
+	if err != nil {
+		return nil, err
+	}
+
+	for subject, count := range nfo.State.Subjects {
+		if seen[strings.TrimPrefix(subject, prefix)] {
+			continue
+		}
+
+		// keys with fewer revisions than the history were never trimmed, unless purged
+		if count >= uint64(cfg.MaxMsgsPerSubject) || !cfg.AllowDirect {
+			snapshot.truncated = true
+			break
+		}
+
+		first, err := js.GetMsg(stream, last+1, nats.DirectGet(), nats.DirectGetNext(subject))
+		if err != nil {
+			return nil, err
+		}
+
+		if first.Header.Get("KV-Operation") == "PURGE" {
+			snapshot.truncated = true
+			break
+		}
+	}
+
+	return snapshot, nil
+}
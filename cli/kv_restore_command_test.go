@@ -0,0 +1,144 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nats-io/jsm.go"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+func TestKVRestoreAt(t *testing.T) {
+	withJetStream(t, func(_ *server.Server, nc *nats.Conn, _ *jsm.Manager) {
+		js, err := nc.JetStream()
+		assertNoError(t, err)
+
+		store, err := js.CreateKeyValue(&nats.KeyValueConfig{Bucket: "CONFIG", History: 5})
+		assertNoError(t, err)
+
+		_, err = store.Put("a", []byte("1"))
+		assertNoError(t, err)
+		_, err = store.Put("b", []byte("1"))
+		assertNoError(t, err)
+		_, err = store.Put("c", []byte("1"))
+		assertNoError(t, err)
+
+		time.Sleep(10 * time.Millisecond)
+		point := time.Now()
+		time.Sleep(10 * time.Millisecond)
+
+		_, err = store.Put("a", []byte("2"))
+		assertNoError(t, err)
+		assertNoError(t, store.Delete("b"))
+		_, err = store.Put("d", []byte("1"))
+		assertNoError(t, err)
+
+		snapshot, err := kvSnapshotAt(js, "CONFIG", 0, point)
+		assertNoError(t, err)
+		expected := map[string][]byte{"a": []byte("1"), "b": []byte("1"), "c": []byte("1")}
+		if !cmp.Equal(expected, snapshot.values) || snapshot.revision != 3 || snapshot.truncated || snapshot.beforeHistory {
+			t.Fatalf("invalid snapshot: %+v", snapshot)
+		}
+
+		snapshot, err = kvSnapshotAt(js, "CONFIG", 2, time.Time{})
+		assertNoError(t, err)
+		expected = map[string][]byte{"a": []byte("1"), "b": []byte("1")}
+		if !cmp.Equal(expected, snapshot.values) || snapshot.revision != 2 {
+			t.Fatalf("invalid snapshot: %+v", snapshot)
+		}
+
+		assertNoError(t, (&KVRestoreCmd{bucket: "CONFIG", revision: 3, force: true}).restoreAction(nil))
+
+		entries, err := kvCurrentEntries(store)
+		assertNoError(t, err)
+		values := map[string]string{}
+		for k, e := range entries {
+			values[k] = string(e.Value())
+		}
+		if !cmp.Equal(values, map[string]string{"a": "1", "b": "1", "c": "1"}) {
+			t.Fatalf("invalid restored values: %v", values)
+		}
+
+		// purge history and verify the old point is detected as outside retained history
+		assertNoError(t, js.PurgeStream("KV_CONFIG", &nats.StreamPurgeRequest{Keep: 2}))
+		snapshot, err = kvSnapshotAt(js, "CONFIG", 2, time.Time{})
+		assertNoError(t, err)
+		if !snapshot.beforeHistory {
+			t.Fatalf("expected the revision to be outside retained history")
+		}
+
+		err = (&KVRestoreCmd{bucket: "CONFIG", revision: 2, force: true}).restoreAction(nil)
+		if err == nil {
+			t.Fatalf("expected restoring before the retained history to fail")
+		}
+		assertNoError(t, (&KVRestoreCmd{bucket: "CONFIG", revision: 2, force: true, partial: true}).restoreAction(nil))
+	})
+}
+
+func TestKVSnapshotTruncated(t *testing.T) {
+	withJetStream(t, func(_ *server.Server, nc *nats.Conn, _ *jsm.Manager) {
+		js, err := nc.JetStream()
+		assertNoError(t, err)
+
+		store, err := js.CreateKeyValue(&nats.KeyValueConfig{Bucket: "HIST", History: 2})
+		assertNoError(t, err)
+
+		put := func(k string, v string) {
+			t.Helper()
+			_, err := store.PutString(k, v)
+			assertNoError(t, err)
+		}
+
+		// a's first revision is trimmed but a later revision before the point remains
+		put("a", "1")
+		put("a", "2")
+		put("a", "3")
+		snapshot, err := kvSnapshotAt(js, "HIST", 3, time.Time{})
+		assertNoError(t, err)
+		if snapshot.truncated || string(snapshot.values["a"]) != "3" {
+			t.Fatalf("invalid snapshot: %+v", snapshot)
+		}
+
+		// keys created after the point do not hide anything
+		put("b", "1")
+		snapshot, err = kvSnapshotAt(js, "HIST", 3, time.Time{})
+		assertNoError(t, err)
+		if snapshot.truncated {
+			t.Fatalf("invalid snapshot: %+v", snapshot)
+		}
+
+		// b's value at revision 4 is trimmed by later updates
+		put("b", "2")
+		put("b", "3")
+		snapshot, err = kvSnapshotAt(js, "HIST", 4, time.Time{})
+		assertNoError(t, err)
+		if !snapshot.truncated {
+			t.Fatalf("expected a truncated snapshot: %+v", snapshot)
+		}
+
+		// purges remove earlier values
+		put("c", "1")
+		put("d", "1")
+		assertNoError(t, store.Purge("c"))
+		snapshot, err = kvSnapshotAt(js, "HIST", 8, time.Time{})
+		assertNoError(t, err)
+		if !snapshot.truncated {
+			t.Fatalf("expected a truncated snapshot: %+v", snapshot)
+		}
+	})
+}
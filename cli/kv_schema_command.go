@@ -0,0 +1,282 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/choria-io/fisk"
+	"github.com/nats-io/nats.go"
+)
+
+// kvSchemaMetadata is the bucket stream metadata key holding a JSON Schema all values must match
+const kvSchemaMetadata = "io.nats.kv.schema"
+
+type KVSchemaCmd struct {
+	bucket string
+	file   string
+	force  bool
+	json   bool
+}
+
+// kvSchemaViolation is a key whose value does not match the bucket schema
+type kvSchemaViolation struct {
+	Key      string   `json:"key"`
+	Revision uint64   `json:"revision"`
+	Errors   []string `json:"errors"`
+}
+
+func configureKVSchemaCommand(kv *fisk.CmdClause) {
+	c := &KVSchemaCmd{}
+
+	schema := kv.Command("schema", "Manage the JSON Schema values in a bucket must match")
+	schema.HelpLong(`Buckets can have a JSON Schema stored in their metadata, when set all values
+written using 'nats kv put', 'create' and 'update' must be JSON documents that
+match the schema.
+
+The schema is only enforced by this tool, other clients can still write any
+value, use 'nats kv validate' to find values that do not match the schema.
+`)
+
+	set := schema.Command("set", "Sets the schema for a bucket").Action(c.setAction)
+	set.Arg("bucket", "The bucket to act on").Required().StringVar(&c.bucket)
+	set.Arg("file", "File holding the JSON Schema").Required().ExistingFileVar(&c.file)
+
+	view := schema.Command("view", "Views the schema for a bucket").Alias("show").Action(c.viewAction)
+	view.Arg("bucket", "The bucket to act on").Required().StringVar(&c.bucket)
+
+	rm := schema.Command("rm", "Removes the schema from a bucket").Action(c.rmAction)
+	rm.Arg("bucket", "The bucket to act on").Required().StringVar(&c.bucket)
+	rm.Flag("force", "Remove without prompting").Short('f').UnNegatableBoolVar(&c.force)
+
+	validate := kv.Command("validate", "Validates all values in a bucket against its schema").Action(c.validateAction)
+	validate.Arg("bucket", "The bucket to act on").Required().StringVar(&c.bucket)
+	validate.Flag("json", "Produce JSON output").Short('j').UnNegatableBoolVar(&c.json)
+}
+
+func (c *KVSchemaCmd) setAction(_ *fisk.ParseContext) error {
+	schema, err := os.ReadFile(c.file)
+	if err != nil {
+		return err
+	}
+
+	_, js, err := prepareJSHelper()
+	fisk.FatalIfError(err, "setup failed")
+
+	err = setKVBucketSchema(js, c.bucket, schema)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Set the value schema for bucket %s\n", c.bucket)
+
+	return nil
+}
+
+func (c *KVSchemaCmd) viewAction(_ *fisk.ParseContext) error {
+	_, js, err := prepareJSHelper()
+	fisk.FatalIfError(err, "setup failed")
+
+	schema, err := kvBucketSchema(js, c.bucket)
+	if err != nil {
+		return err
+	}
+
+	if schema == nil {
+		return fmt.Errorf("bucket %s has no value schema", c.bucket)
+	}
+
+	var out bytes.Buffer
+	err = json.Indent(&out, schema, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(out.String())
+
+	return nil
+}
+
+func (c *KVSchemaCmd) rmAction(_ *fisk.ParseContext) error {
+	if !c.force {
+		ok, err := askConfirmation(fmt.Sprintf("Really remove the value schema from bucket %s", c.bucket), false)
+		fisk.FatalIfError(err, "could not obtain confirmation")
+
+		if !ok {
+			return nil
+		}
+	}
+
+	_, js, err := prepareJSHelper()
+	fisk.FatalIfError(err, "setup failed")
+
+	err = setKVBucketSchema(js, c.bucket, nil)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Removed the value schema from bucket %s\n", c.bucket)
+
+	return nil
+}
+
+func (c *KVSchemaCmd) validateAction(_ *fisk.ParseContext) error {
+	_, js, err := prepareJSHelper()
+	fisk.FatalIfError(err, "setup failed")
+
+	schema, err := kvBucketSchema(js, c.bucket)
+	if err != nil {
+		return err
+	}
+
+	if schema == nil {
+		return fmt.Errorf("bucket %s has no value schema", c.bucket)
+	}
+
+	store, err := js.KeyValue(c.bucket)
+	if err != nil {
+		return err
+	}
+
+	violations, checked, err := validateKVBucket(store, schema)
+	if err != nil {
+		return err
+	}
+
+	if c.json {
+		err = printJSON(violations)
+		if err != nil {
+			return err
+		}
+	} else if len(violations) == 0 {
+		fmt.Printf("All %s values in bucket %s match the schema\n", f(checked), c.bucket)
+	} else {
+		table := newTableWriter(fmt.Sprintf("%s of %s values in bucket %s do not match the schema", f(len(violations)), f(checked), c.bucket))
+		table.AddHeaders("Key", "Revision", "Problems")
+		for _, v := range violations {
+			table.AddRow(v.Key, f(v.Revision), strings.Join(v.Errors, "\n"))
+		}
+		fmt.Println(table.Render())
+	}
+
+	if len(violations) > 0 {
+		os.Exit(1)
+	}
+
+	return nil
+}
+
+// validateKVBucket validates all current values in store returning violations and the number of values checked
+func validateKVBucket(store nats.KeyValue, schema []byte) ([]*kvSchemaViolation, int, error) {
+	sch, err := compileJSONSchema(schema)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	entries, err := kvCurrentEntries(store)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	keys := mapKeys(entries)
+	sort.Strings(keys)
+
+	var violations []*kvSchemaViolation
+	for _, key := range keys {
+		ok, errs := new(SchemaValidator).ValidateJSON(entries[key].Value(), sch)
+		if !ok {
+			violations = append(violations, &kvSchemaViolation{Key: key, Revision: entries[key].Revision(), Errors: errs})
+		}
+	}
+
+	return violations, len(entries), nil
+}
+
+// kvBucketSchema retrieves the schema for a bucket, nil when none is set
+func kvBucketSchema(js nats.JetStreamContext, bucket string) ([]byte, error) {
+	nfo, err := js.StreamInfo("KV_" + bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, ok := nfo.Config.Metadata[kvSchemaMetadata]
+	if !ok || schema == "" {
+		return nil, nil
+	}
+
+	return []byte(schema), nil
+}
+
+// setKVBucketSchema stores schema in the bucket metadata after checking it is valid, a nil schema removes it
+func setKVBucketSchema(js nats.JetStreamContext, bucket string, schema []byte) error {
+	nfo, err := js.StreamInfo("KV_" + bucket)
+	if err != nil {
+		return err
+	}
+
+	cfg := nfo.Config
+	if schema == nil {
+		delete(cfg.Metadata, kvSchemaMetadata)
+	} else {
+		_, err = compileJSONSchema(schema)
+		if err != nil {
+			return err
+		}
+
+		// the schema is stored compacted to keep metadata small
+		var compact bytes.Buffer
+		err = json.Compact(&compact, schema)
+		if err != nil {
+			return fmt.Errorf("invalid schema: %w", err)
+		}
+
+		if cfg.Metadata == nil {
+			cfg.Metadata = map[string]string{}
+		}
+		cfg.Metadata[kvSchemaMetadata] = compact.String()
+	}
+
+	_, err = js.UpdateStream(&cfg)
+
+	return err
+}
+
+// validateKVValue checks val against the bucket schema when one is set
+func validateKVValue(js nats.JetStreamContext, bucket string, key string, val []byte) error {
+	schema, err := kvBucketSchema(js, bucket)
+	if err != nil {
+		return err
+	}
+
+	if schema == nil {
+		return nil
+	}
+
+	sch, err := compileJSONSchema(schema)
+	if err != nil {
+		return err
+	}
+
+	ok, errs := new(SchemaValidator).ValidateJSON(val, sch)
+	if !ok {
+		return fmt.Errorf("value for key %s does not match the schema for bucket %s:\n\n%s", key, bucket, strings.Join(errs, "\n"))
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"testing"
+
+	"github.com/nats-io/jsm.go"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+const testKVSchema = `{
+  "type": "object",
+  "required": ["port"],
+  "properties": {
+    "port": {"type": "integer", "minimum": 1}
+  }
+}`
+
+func TestKVSchema(t *testing.T) {
+	withJetStream(t, func(_ *server.Server, nc *nats.Conn, _ *jsm.Manager) {
+		js, err := nc.JetStream()
+		assertNoError(t, err)
+
+		store, err := js.CreateKeyValue(&nats.KeyValueConfig{Bucket: "CONFIG"})
+		assertNoError(t, err)
+
+		_, err = store.Put("legacy", []byte("not json"))
+		assertNoError(t, err)
+		_, err = store.Put("web", []byte(`{"port": 80}`))
+		assertNoError(t, err)
+
+		schema, err := kvBucketSchema(js, "CONFIG")
+		assertNoError(t, err)
+		if schema != nil {
+			t.Fatalf("expected no schema")
+		}
+		assertNoError(t, validateKVValue(js, "CONFIG", "x", []byte("anything")))
+
+		err = setKVBucketSchema(js, "CONFIG", []byte(`{"type": 1}`))
+		if err == nil {
+			t.Fatalf("expected an invalid schema error")
+		}
+
+		assertNoError(t, setKVBucketSchema(js, "CONFIG", []byte(testKVSchema)))
+
+		assertNoError(t, validateKVValue(js, "CONFIG", "api", []byte(`{"port": 8080}`)))
+		for _, val := range []string{`{"port": 0}`, `{}`, `{"port": "80"}`, `invalid`} {
+			if validateKVValue(js, "CONFIG", "api", []byte(val)) == nil {
+				t.Fatalf("expected %s to be invalid", val)
+			}
+		}
+
+		cmd := &kvCommand{bucket: "CONFIG", key: "api", val: `{"port": -1}`}
+		if cmd.putAction(nil) == nil {
+			t.Fatalf("expected put to fail validation")
+		}
+		if _, err = store.Get("api"); err != nats.ErrKeyNotFound {
+			t.Fatalf("expected invalid value not to be stored: %v", err)
+		}
+
+		schema, err = kvBucketSchema(js, "CONFIG")
+		assertNoError(t, err)
+
+		violations, checked, err := validateKVBucket(store, schema)
+		assertNoError(t, err)
+		if checked != 2 || len(violations) != 1 || violations[0].Key != "legacy" || violations[0].Revision != 1 {
+			t.Fatalf("invalid violations %d: %+v", checked, violations)
+		}
+
+		assertNoError(t, setKVBucketSchema(js, "CONFIG", nil))
+		schema, err = kvBucketSchema(js, "CONFIG")
+		assertNoError(t, err)
+		if schema != nil {
+			t.Fatalf("expected the schema to be removed")
+		}
+	})
+}
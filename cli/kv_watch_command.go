@@ -0,0 +1,257 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/kballard/go-shellquote"
+	"github.com/nats-io/nats.go"
+)
+
+// kvTemplateData is the data available to templates rendered by kv watch
+type kvTemplateData struct {
+	Bucket   string
+	Revision uint64
+	Values   map[string]string
+}
+
+// watchActions handles kv watch with --command or --template, running commands per change and rendering templates once changes settle
+func (c *kvCommand) watchActions(store nats.KeyValue) error {
+	var tmpl *template.Template
+	var err error
+
+	if c.watchTemplate != "" {
+		if c.watchOutput == "" {
+			return fmt.Errorf("--output is required when rendering a template")
+		}
+
+		tmpl, err = parseKVTemplate(c.watchTemplate)
+		if err != nil {
+			return err
+		}
+	}
+
+	watch, err := store.Watch(c.key)
+	if err != nil {
+		return err
+	}
+	defer watch.Stop()
+
+	ctx, cancel := signal.NotifyContext(ctx, syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	data := &kvTemplateData{Bucket: store.Bucket(), Values: map[string]string{}}
+	initialized := false
+
+	debounce := time.NewTimer(c.watchDebounce)
+	debounce.Stop()
+	defer debounce.Stop()
+
+	for {
+		select {
+		case entry, ok := <-watch.Updates():
+			if !ok {
+				return nil
+			}
+
+			// nil marks the end of the initial values
+			if entry == nil {
+				initialized = true
+				if tmpl != nil {
+					c.renderWatchTemplate(tmpl, data)
+				}
+				continue
+			}
+
+			switch entry.Operation() {
+			case nats.KeyValuePut:
+				data.Values[entry.Key()] = string(entry.Value())
+			default:
+				delete(data.Values, entry.Key())
+			}
+			data.Revision = entry.Revision()
+
+			if c.watchCommand != "" {
+				c.runWatchCommand(entry)
+			}
+
+			if tmpl != nil && initialized {
+				debounce.Reset(c.watchDebounce)
+			}
+
+		case <-debounce.C:
+			c.renderWatchTemplate(tmpl, data)
+
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (c *kvCommand) runWatchCommand(entry nats.KeyValueEntry) {
+	parts, err := shellquote.Split(c.watchCommand)
+	if err != nil || len(parts) == 0 {
+		log.Printf("Could not parse command %q: %v", c.watchCommand, err)
+		return
+	}
+
+	if opts.Trace {
+		log.Printf("Executing: %s", strings.Join(parts, " "))
+	}
+
+	cmd := exec.Command(parts[0], parts[1:]...)
+	cmd.Env = append(os.Environ(), kvWatchEnv(entry, c.strForOp(entry.Operation()))...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err = cmd.Run()
+	if err != nil {
+		log.Printf("Command %q failed for key %s revision %d: %s", c.watchCommand, entry.Key(), entry.Revision(), err)
+	}
+}
+
+func (c *kvCommand) renderWatchTemplate(tmpl *template.Template, data *kvTemplateData) {
+	changed, err := renderKVTemplate(tmpl, data, c.watchOutput)
+	if err != nil {
+		log.Printf("Could not render %s: %s", c.watchOutput, err)
+		return
+	}
+
+	if !changed {
+		return
+	}
+
+	log.Printf("Rendered %s at revision %d", c.watchOutput, data.Revision)
+
+	if c.watchReload == "" {
+		return
+	}
+
+	parts, err := shellquote.Split(c.watchReload)
+	if err != nil || len(parts) == 0 {
+		log.Printf("Could not parse reload command %q: %v", c.watchReload, err)
+		return
+	}
+
+	cmd := exec.Command(parts[0], parts[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		log.Printf("Reload command %q failed: %s", c.watchReload, err)
+	}
+}
+
+// kvWatchEnv is the environment passed to commands run by kv watch
+func kvWatchEnv(entry nats.KeyValueEntry, op string) []string {
+	return []string{
+		fmt.Sprintf("NATS_KV_BUCKET=%s", entry.Bucket()),
+		fmt.Sprintf("NATS_KV_KEY=%s", entry.Key()),
+		fmt.Sprintf("NATS_KV_VALUE=%s", string(entry.Value())),
+		fmt.Sprintf("NATS_KV_OPERATION=%s", op),
+		fmt.Sprintf("NATS_KV_REVISION=%d", entry.Revision()),
+	}
+}
+
+func parseKVTemplate(file string) (*template.Template, error) {
+	body, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	funcs := template.FuncMap{
+		// placeholders replaced with functions bound to the data during rendering
+		"Get":      func(string) string { return "" },
+		"Keys":     func(string) []string { return nil },
+		"FromJSON": func(string) (any, error) { return nil, nil },
+	}
+
+	return template.New(filepath.Base(file)).Funcs(funcs).Option("missingkey=zero").Parse(string(body))
+}
+
+// renderKVTemplate renders tmpl to file when the result differs from its current content, the file is replaced atomically
+func renderKVTemplate(tmpl *template.Template, data *kvTemplateData, file string) (bool, error) {
+	funcs := template.FuncMap{
+		"Get": func(key string) string {
+			return data.Values[key]
+		},
+		"Keys": func(prefix string) []string {
+			var keys []string
+			for k := range data.Values {
+				if strings.HasPrefix(k, prefix) {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			return keys
+		},
+		"FromJSON": func(key string) (any, error) {
+			var res any
+			err := json.Unmarshal([]byte(data.Values[key]), &res)
+			return res, err
+		},
+	}
+
+	t, err := tmpl.Clone()
+	if err != nil {
+		return false, err
+	}
+
+	var buf bytes.Buffer
+	err = t.Funcs(funcs).Execute(&buf, data)
+	if err != nil {
+		return false, err
+	}
+
+	current, err := os.ReadFile(file)
+	if err == nil && bytes.Equal(current, buf.Bytes()) {
+		return false, nil
+	}
+
+	tf, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file))
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tf.Name())
+
+	_, err = tf.Write(buf.Bytes())
+	if err != nil {
+		tf.Close()
+		return false, err
+	}
+
+	err = tf.Close()
+	if err != nil {
+		return false, err
+	}
+
+	err = os.Chmod(tf.Name(), 0644)
+	if err != nil {
+		return false, err
+	}
+
+	return true, os.Rename(tf.Name(), file)
+}
@@ -0,0 +1,76 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRenderKVTemplate(t *testing.T) {
+	dir := t.TempDir()
+	tfile := filepath.Join(dir, "app.tmpl")
+	out := filepath.Join(dir, "app.conf")
+
+	err := os.WriteFile(tfile, []byte(`# {{ .Bucket }}
+{{- range Keys "app." }}
+{{ . }}={{ Get . }}
+{{- end }}
+{{ with FromJSON "db" }}db={{ .host }}:{{ .port }}{{ end }}
+`), 0600)
+	assertNoError(t, err)
+
+	tmpl, err := parseKVTemplate(tfile)
+	assertNoError(t, err)
+
+	data := &kvTemplateData{Bucket: "CONFIG", Values: map[string]string{
+		"app.name": "orders",
+		"app.port": "80",
+		"other":    "x",
+		"db":       `{"host": "db1", "port": 5432}`,
+	}}
+
+	changed, err := renderKVTemplate(tmpl, data, out)
+	assertNoError(t, err)
+	if !changed {
+		t.Fatalf("expected the output to be written")
+	}
+
+	res, err := os.ReadFile(out)
+	assertNoError(t, err)
+	expected := "# CONFIG\napp.name=orders\napp.port=80\ndb=db1:5432\n"
+	if string(res) != expected {
+		t.Fatalf("invalid output %q expected %q", res, expected)
+	}
+
+	changed, err = renderKVTemplate(tmpl, data, out)
+	assertNoError(t, err)
+	if changed {
+		t.Fatalf("expected unchanged output not to be rewritten")
+	}
+
+	data.Values["app.port"] = "8080"
+	changed, err = renderKVTemplate(tmpl, data, out)
+	assertNoError(t, err)
+	if !changed {
+		t.Fatalf("expected the output to be updated")
+	}
+
+	entries, err := os.ReadDir(dir)
+	assertNoError(t, err)
+	if len(entries) != 2 {
+		t.Fatalf("expected temporary files to be removed, found %d files", len(entries))
+	}
+}
@@ -0,0 +1,324 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/linkedin/goavro/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// msgDecoder renders message bodies in binary encodings as JSON
+type msgDecoder interface {
+	// decode renders data as JSON, nil output means the decoder does not apply to the message
+	decode(hdr nats.Header, data []byte) ([]byte, error)
+}
+
+// msgDecoderHelp describes the values accepted by newMsgDecoder
+const msgDecoderHelp = "Decodes message bodies using msgpack, cbor, proto:FILE#TYPE, avro:FILE or auto to select a decoder using the Content-Type header, use auto,proto:FILE,avro:FILE to also decode protobuf and avro"
+
+// newMsgDecoder creates a decoder from a specification like msgpack, cbor, proto:descriptors.pb#pkg.Msg, avro:schema.avsc
+// or auto,proto:descriptors.pb,avro:schema.avsc
+func newMsgDecoder(spec string) (msgDecoder, error) {
+	if spec == "auto" || strings.HasPrefix(spec, "auto,") {
+		return newContentTypeDecoder(strings.Split(spec, ",")[1:])
+	}
+
+	kind, arg, _ := strings.Cut(spec, ":")
+
+	switch kind {
+	case "":
+		return nil, nil
+	case "msgpack":
+		return &msgpackDecoder{}, nil
+	case "cbor":
+		return &cborDecoder{}, nil
+	case "proto", "protobuf":
+		file, msgType, _ := strings.Cut(arg, "#")
+		if file == "" {
+			return nil, fmt.Errorf("protobuf decoding requires a descriptor set file, for example proto:descriptors.pb#pkg.Message")
+		}
+		return newProtoDecoder(file, msgType)
+	case "avro":
+		if arg == "" {
+			return nil, fmt.Errorf("avro decoding requires a schema file, for example avro:schema.avsc")
+		}
+		return newAvroDecoder(arg)
+	default:
+		return nil, fmt.Errorf("unknown decoder %q", spec)
+	}
+}
+
+// decodeFailures holds the decoders that failed to decode a message body, failures are only logged once per decoder
+var decodeFailures sync.Map
+
+// decodeMsgBody renders data using decoder, data is returned unchanged when no decoder applies or decoding fails
+func decodeMsgBody(decoder msgDecoder, hdr nats.Header, data []byte) []byte {
+	if decoder == nil || len(data) == 0 {
+		return data
+	}
+
+	out, err := decoder.decode(hdr, data)
+	if err != nil {
+		if _, logged := decodeFailures.LoadOrStore(decoder, true); !logged {
+			log.Printf("Could not decode message body, showing it undecoded, further failures will not be logged: %s", err)
+		}
+		return data
+	}
+	if out == nil {
+		return data
+	}
+
+	return out
+}
+
+// jsonSafeValue converts maps with non string keys produced by msgpack and cbor to values that can be JSON encoded
+func jsonSafeValue(v any) any {
+	switch v := v.(type) {
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = jsonSafeValue(val)
+		}
+		return m
+	case map[string]any:
+		for k, val := range v {
+			v[k] = jsonSafeValue(val)
+		}
+		return v
+	case []any:
+		for i, val := range v {
+			v[i] = jsonSafeValue(val)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// msgpackDecoder decodes MessagePack bodies
+type msgpackDecoder struct{}
+
+func (d *msgpackDecoder) decode(_ nats.Header, data []byte) ([]byte, error) {
+	var v any
+	err := msgpack.Unmarshal(data, &v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid msgpack: %w", err)
+	}
+
+	return json.MarshalIndent(jsonSafeValue(v), "", "  ")
+}
+
+// cborDecoder decodes CBOR bodies
+type cborDecoder struct{}
+
+func (d *cborDecoder) decode(_ nats.Header, data []byte) ([]byte, error) {
+	var v any
+	err := cbor.Unmarshal(data, &v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cbor: %w", err)
+	}
+
+	return json.MarshalIndent(jsonSafeValue(v), "", "  ")
+}
+
+// protoDecoder decodes protobuf bodies using message types from a descriptor set, the message type is taken from
+// the Content-Type header when not set
+type protoDecoder struct {
+	files   *protoregistry.Files
+	types   *dynamicpb.Types
+	msgType string
+}
+
+func newProtoDecoder(file string, msgType string) (*protoDecoder, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var set descriptorpb.FileDescriptorSet
+	err = proto.Unmarshal(raw, &set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor set %s: %w", file, err)
+	}
+
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor set %s: %w", file, err)
+	}
+
+	d := &protoDecoder{files: files, types: dynamicpb.NewTypes(files), msgType: msgType}
+
+	if msgType != "" {
+		_, err = d.descriptor(msgType)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+func (d *protoDecoder) descriptor(name string) (protoreflect.MessageDescriptor, error) {
+	desc, err := d.files.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, fmt.Errorf("unknown message type %q", name)
+	}
+
+	md, ok := desc.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a message type", name)
+	}
+
+	return md, nil
+}
+
+func (d *protoDecoder) decode(hdr nats.Header, data []byte) ([]byte, error) {
+	name := d.msgType
+	if name == "" {
+		_, params, err := mime.ParseMediaType(hdr.Get("Content-Type"))
+		if err == nil {
+			name = params["proto"]
+			if name == "" {
+				name = params["messagetype"]
+			}
+		}
+	}
+	if name == "" {
+		return nil, fmt.Errorf("no message type set in the decoder or Content-Type header")
+	}
+
+	md, err := d.descriptor(name)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := dynamicpb.NewMessage(md)
+	err = proto.UnmarshalOptions{Resolver: d.types}.Unmarshal(data, msg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", name, err)
+	}
+
+	return protojson.MarshalOptions{Multiline: true, Indent: "  ", Resolver: d.types}.Marshal(msg)
+}
+
+// avroDecoder decodes Avro binary bodies using a schema
+type avroDecoder struct {
+	codec *goavro.Codec
+}
+
+func newAvroDecoder(file string) (*avroDecoder, error) {
+	schema, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	codec, err := goavro.NewCodec(string(schema))
+	if err != nil {
+		return nil, fmt.Errorf("invalid avro schema %s: %w", file, err)
+	}
+
+	return &avroDecoder{codec: codec}, nil
+}
+
+func (d *avroDecoder) decode(_ nats.Header, data []byte) ([]byte, error) {
+	native, _, err := d.codec.NativeFromBinary(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid avro: %w", err)
+	}
+
+	textual, err := d.codec.TextualFromNative(nil, native)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	err = json.Indent(&out, textual, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
+
+// contentTypeDecoder selects a decoder based on the Content-Type header, protobuf and avro bodies are only decoded
+// when a descriptor set or schema is configured
+type contentTypeDecoder struct {
+	proto *protoDecoder
+	avro  *avroDecoder
+}
+
+func newContentTypeDecoder(specs []string) (*contentTypeDecoder, error) {
+	d := &contentTypeDecoder{}
+
+	for _, spec := range specs {
+		decoder, err := newMsgDecoder(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		switch decoder := decoder.(type) {
+		case *protoDecoder:
+			d.proto = decoder
+		case *avroDecoder:
+			d.avro = decoder
+		default:
+			return nil, fmt.Errorf("auto can only be combined with proto and avro decoders")
+		}
+	}
+
+	return d, nil
+}
+
+func (d *contentTypeDecoder) decode(hdr nats.Header, data []byte) ([]byte, error) {
+	mediaType, _, err := mime.ParseMediaType(hdr.Get("Content-Type"))
+	if err != nil {
+		return nil, nil
+	}
+
+	switch mediaType {
+	case "application/msgpack", "application/x-msgpack", "application/vnd.msgpack":
+		return (&msgpackDecoder{}).decode(hdr, data)
+	case "application/cbor":
+		return (&cborDecoder{}).decode(hdr, data)
+	case "application/protobuf", "application/x-protobuf", "application/vnd.google.protobuf":
+		if d.proto == nil {
+			return nil, nil
+		}
+		return d.proto.decode(hdr, data)
+	case "application/avro", "avro/binary", "application/vnd.apache.avro+binary":
+		if d.avro == nil {
+			return nil, nil
+		}
+		return d.avro.decode(hdr, data)
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/linkedin/goavro/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func assertDecodedJSON(t *testing.T, out []byte, expected map[string]any) {
+	t.Helper()
+
+	var got map[string]any
+	err := json.Unmarshal(out, &got)
+	if err != nil {
+		t.Fatalf("invalid json %q: %s", out, err)
+	}
+
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v got %v", expected, got)
+	}
+}
+
+func TestMsgDecoderSpec(t *testing.T) {
+	d, err := newMsgDecoder("")
+	assertNoError(t, err)
+	if d != nil {
+		t.Fatalf("expected no decoder")
+	}
+
+	for _, invalid := range []string{"yaml", "proto", "proto:#pkg.Msg", "avro", "avro:/nonexisting", "auto,msgpack", "auto,avro:/nonexisting"} {
+		_, err = newMsgDecoder(invalid)
+		if err == nil {
+			t.Fatalf("expected %q to be invalid", invalid)
+		}
+	}
+}
+
+func TestMsgpackAndCborDecoders(t *testing.T) {
+	expected := map[string]any{"name": "nats", "count": float64(10), "tags": []any{"a", "b"}}
+
+	mp, err := msgpack.Marshal(map[string]any{"name": "nats", "count": 10, "tags": []string{"a", "b"}})
+	assertNoError(t, err)
+
+	cb, err := cbor.Marshal(map[string]any{"name": "nats", "count": 10, "tags": []string{"a", "b"}})
+	assertNoError(t, err)
+
+	for spec, data := range map[string][]byte{"msgpack": mp, "cbor": cb} {
+		d, err := newMsgDecoder(spec)
+		assertNoError(t, err)
+
+		out, err := d.decode(nil, data)
+		assertNoError(t, err)
+		assertDecodedJSON(t, out, expected)
+	}
+
+	// non string map keys are rendered as strings
+	cb, err = cbor.Marshal(map[int]string{1: "one"})
+	assertNoError(t, err)
+	out, err := (&cborDecoder{}).decode(nil, cb)
+	assertNoError(t, err)
+	assertDecodedJSON(t, out, map[string]any{"1": "one"})
+
+	auto, err := newMsgDecoder("auto")
+	assertNoError(t, err)
+
+	out, err = auto.decode(nats.Header{"Content-Type": []string{"application/msgpack"}}, mp)
+	assertNoError(t, err)
+	assertDecodedJSON(t, out, expected)
+
+	out, err = auto.decode(nats.Header{"Content-Type": []string{"application/cbor; charset=binary"}}, cb)
+	assertNoError(t, err)
+	assertDecodedJSON(t, out, map[string]any{"1": "one"})
+
+	out, err = auto.decode(nats.Header{"Content-Type": []string{"application/json"}}, []byte(`{}`))
+	assertNoError(t, err)
+	if out != nil {
+		t.Fatalf("expected json to not be decoded")
+	}
+
+	if got := decodeMsgBody(auto, nil, []byte("hello")); string(got) != "hello" {
+		t.Fatalf("expected undecoded body got %q", got)
+	}
+}
+
+func TestProtoDecoder(t *testing.T) {
+	fd := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("order.proto"),
+		Package: proto.String("shop"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Order"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("id"), JsonName: proto.String("id"), Number: proto.Int32(1), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+				{Name: proto.String("quantity"), JsonName: proto.String("quantity"), Number: proto.Int32(2), Type: descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+			},
+		}},
+	}
+
+	set, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{fd}})
+	assertNoError(t, err)
+
+	file := filepath.Join(t.TempDir(), "order.pb")
+	assertNoError(t, os.WriteFile(file, set, 0600))
+
+	fdesc, err := protodesc.NewFile(fd, nil)
+	assertNoError(t, err)
+	md := fdesc.Messages().ByName("Order")
+	msg := dynamicpb.NewMessage(md)
+	msg.Set(md.Fields().ByName("id"), protoreflect.ValueOfString("o1"))
+	msg.Set(md.Fields().ByName("quantity"), protoreflect.ValueOfInt32(3))
+	data, err := proto.Marshal(msg)
+	assertNoError(t, err)
+
+	_, err = newMsgDecoder("proto:" + file + "#shop.Unknown")
+	if err == nil {
+		t.Fatalf("expected unknown type error")
+	}
+
+	d, err := newMsgDecoder("proto:" + file + "#shop.Order")
+	assertNoError(t, err)
+	out, err := d.decode(nil, data)
+	assertNoError(t, err)
+	assertDecodedJSON(t, out, map[string]any{"id": "o1", "quantity": float64(3)})
+
+	d, err = newMsgDecoder("proto:" + file)
+	assertNoError(t, err)
+	_, err = d.decode(nil, data)
+	if err == nil {
+		t.Fatalf("expected missing type error")
+	}
+	out, err = d.decode(nats.Header{"Content-Type": []string{"application/protobuf; proto=shop.Order"}}, data)
+	assertNoError(t, err)
+	assertDecodedJSON(t, out, map[string]any{"id": "o1", "quantity": float64(3)})
+
+	hdr := nats.Header{"Content-Type": []string{"application/x-protobuf; messageType=shop.Order"}}
+	auto, err := newMsgDecoder("auto")
+	assertNoError(t, err)
+	out, err = auto.decode(hdr, data)
+	assertNoError(t, err)
+	if out != nil {
+		t.Fatalf("expected protobuf to not be decoded without a descriptor set")
+	}
+
+	auto, err = newMsgDecoder("auto,proto:" + file)
+	assertNoError(t, err)
+	out, err = auto.decode(hdr, data)
+	assertNoError(t, err)
+	assertDecodedJSON(t, out, map[string]any{"id": "o1", "quantity": float64(3)})
+}
+
+func TestAvroDecoder(t *testing.T) {
+	schema := `{"type":"record","name":"Order","fields":[{"name":"id","type":"string"},{"name":"quantity","type":"int"}]}`
+	file := filepath.Join(t.TempDir(), "order.avsc")
+	assertNoError(t, os.WriteFile(file, []byte(schema), 0600))
+
+	codec, err := goavro.NewCodec(schema)
+	assertNoError(t, err)
+	data, err := codec.BinaryFromNative(nil, map[string]any{"id": "o1", "quantity": 3})
+	assertNoError(t, err)
+
+	d, err := newMsgDecoder("avro:" + file)
+	assertNoError(t, err)
+	out, err := d.decode(nil, data)
+	assertNoError(t, err)
+	assertDecodedJSON(t, out, map[string]any{"id": "o1", "quantity": float64(3)})
+
+	_, err = d.decode(nil, []byte{0xff})
+	if err == nil {
+		t.Fatalf("expected invalid avro error")
+	}
+
+	auto, err := newMsgDecoder("auto,avro:" + file)
+	assertNoError(t, err)
+	out, err = auto.decode(nats.Header{"Content-Type": []string{"avro/binary"}}, data)
+	assertNoError(t, err)
+	assertDecodedJSON(t, out, map[string]any{"id": "o1", "quantity": float64(3)})
+}
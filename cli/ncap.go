@@ -0,0 +1,251 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// The capture format written by 'nats sub --record' starts with ncapMagic followed
+// by records each prefixed with their length as a uvarint. A record holds the receive
+// time in unix nanoseconds as a varint followed by the subject, reply, headers and
+// payload. Strings and the payload are prefixed by their length as a uvarint, headers
+// by the number of header values followed by a name and value per value.
+const ncapMagic = "NCAP\x01"
+
+// ncapMaxRecordSize is the largest record accepted when reading, the largest NATS payload
+// of 64MB including headers plus room for the subject, reply and encoding overhead
+const ncapMaxRecordSize = 64*1024*1024 + 64*1024
+
+// ncapRecord is a single captured message
+type ncapRecord struct {
+	Time    time.Time
+	Subject string
+	Reply   string
+	Header  nats.Header
+	Data    []byte
+}
+
+// ncapWriter appends records to a capture file
+type ncapWriter struct {
+	mu  sync.Mutex
+	f   *os.File
+	w   *bufio.Writer
+	buf bytes.Buffer
+}
+
+// ncapReader reads records from a capture
+type ncapReader struct {
+	r *bufio.Reader
+}
+
+// newNcapWriter opens file for appending records, the file is created when it does not exist
+func newNcapWriter(file string) (*ncapWriter, error) {
+	f, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	w := &ncapWriter{f: f, w: bufio.NewWriter(f)}
+
+	if stat.Size() == 0 {
+		_, err = w.w.WriteString(ncapMagic)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		return w, nil
+	}
+
+	magic := make([]byte, len(ncapMagic))
+	_, err = f.ReadAt(magic, 0)
+	if err != nil || string(magic) != ncapMagic {
+		f.Close()
+		return nil, fmt.Errorf("%s is not a capture file", file)
+	}
+
+	return w, nil
+}
+
+// Write appends msg received at t
+func (w *ncapWriter) Write(msg *nats.Msg, t time.Time) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf.Reset()
+	w.buf.Write(binary.AppendVarint(nil, t.UnixNano()))
+	ncapWriteBytes(&w.buf, []byte(msg.Subject))
+	ncapWriteBytes(&w.buf, []byte(msg.Reply))
+
+	names := mapKeys(msg.Header)
+	sort.Strings(names)
+
+	var count uint64
+	for _, name := range names {
+		count += uint64(len(msg.Header[name]))
+	}
+	w.buf.Write(binary.AppendUvarint(nil, count))
+	for _, name := range names {
+		for _, val := range msg.Header[name] {
+			ncapWriteBytes(&w.buf, []byte(name))
+			ncapWriteBytes(&w.buf, []byte(val))
+		}
+	}
+
+	ncapWriteBytes(&w.buf, msg.Data)
+
+	_, err := w.w.Write(binary.AppendUvarint(nil, uint64(w.buf.Len())))
+	if err != nil {
+		return err
+	}
+
+	_, err = w.w.Write(w.buf.Bytes())
+
+	return err
+}
+
+// Close flushes buffered records and closes the file
+func (w *ncapWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	err := w.w.Flush()
+	if err != nil {
+		w.f.Close()
+		return err
+	}
+
+	return w.f.Close()
+}
+
+func ncapWriteBytes(buf *bytes.Buffer, b []byte) {
+	buf.Write(binary.AppendUvarint(nil, uint64(len(b))))
+	buf.Write(b)
+}
+
+// newNcapReader reads a capture from r verifying it starts with the capture header
+func newNcapReader(r io.Reader) (*ncapReader, error) {
+	br := bufio.NewReader(r)
+
+	magic := make([]byte, len(ncapMagic))
+	_, err := io.ReadFull(br, magic)
+	if err != nil || string(magic) != ncapMagic {
+		return nil, fmt.Errorf("not a capture file")
+	}
+
+	return &ncapReader{r: br}, nil
+}
+
+// Next reads the next record, io.EOF indicates the end of the capture and io.ErrUnexpectedEOF a truncated final record
+func (r *ncapReader) Next() (*ncapRecord, error) {
+	size, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return nil, err
+	}
+
+	invalid := fmt.Errorf("invalid capture record")
+	if size > ncapMaxRecordSize {
+		return nil, invalid
+	}
+
+	buf := make([]byte, size)
+	_, err = io.ReadFull(r.r, buf)
+	if errors.Is(err, io.EOF) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rec := bytes.NewReader(buf)
+
+	ts, err := binary.ReadVarint(rec)
+	if err != nil {
+		return nil, invalid
+	}
+
+	readBytes := func() ([]byte, error) {
+		l, err := binary.ReadUvarint(rec)
+		if err != nil || l > uint64(rec.Len()) {
+			return nil, invalid
+		}
+
+		b := make([]byte, l)
+		_, err = io.ReadFull(rec, b)
+		if err != nil {
+			return nil, invalid
+		}
+
+		return b, nil
+	}
+
+	record := &ncapRecord{Time: time.Unix(0, ts)}
+
+	subject, err := readBytes()
+	if err != nil {
+		return nil, err
+	}
+	record.Subject = string(subject)
+
+	reply, err := readBytes()
+	if err != nil {
+		return nil, err
+	}
+	record.Reply = string(reply)
+
+	count, err := binary.ReadUvarint(rec)
+	if err != nil {
+		return nil, invalid
+	}
+	for i := uint64(0); i < count; i++ {
+		name, err := readBytes()
+		if err != nil {
+			return nil, err
+		}
+		val, err := readBytes()
+		if err != nil {
+			return nil, err
+		}
+
+		if record.Header == nil {
+			record.Header = nats.Header{}
+		}
+		record.Header[string(name)] = append(record.Header[string(name)], string(val))
+	}
+
+	record.Data, err = readBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
@@ -46,6 +46,11 @@ type objCommand struct {
 	maxBucketSize       int64
 	maxBucketSizeString string
 	metadata            map[string]string
+	recursive           bool
+	parallel            int
+	linkTarget          string
+	purgeOrphans        bool
+	json                bool
 
 	description string
 	replicas    uint
@@ -84,13 +89,23 @@ NOTE: This is an experimental feature.
 	add.PreAction(c.parseLimitStrings)
 
 	put := obj.Command("put", "Puts a file into the store").Action(c.putAction)
+	put.HelpLong(`With --recursive all files in a directory are stored using their path
+relative to the directory as name, prefixed by the directory name or --name.
+Files already stored with the same size and digest are skipped so an
+interrupted transfer can be resumed by running the same command again.
+Resuming only skips whole files, a file that was partially stored when the
+transfer was interrupted is uploaded again from the start as the object store
+does not keep incomplete objects.
+`)
 	put.Arg("bucket", "The bucket to act on").Required().StringVar(&c.bucket)
-	put.Arg("file", "The file to put").ExistingFileVar(&c.file)
-	put.Flag("name", "Override the name supplied to the object store").StringVar(&c.overrideName)
+	put.Arg("file", "The file or directory to put").ExistingFileOrDirVar(&c.file)
+	put.Flag("name", "Override the name supplied to the object store, the name prefix for recursive puts").StringVar(&c.overrideName)
 	put.Flag("description", "Sets an optional description for the object").StringVar(&c.description)
 	put.Flag("header", "Adds headers to the object").Short('H').StringsVar(&c.hdrs)
 	put.Flag("progress", "Disable progress bars").Default("true").BoolVar(&c.progress)
 	put.Flag("force", "Act without confirmation").Short('f').UnNegatableBoolVar(&c.force)
+	put.Flag("recursive", "Puts all files in a directory, skipping files already stored unchanged").Short('r').UnNegatableBoolVar(&c.recursive)
+	put.Flag("parallel", "Number of files to put concurrently when putting recursively").Default("4").IntVar(&c.parallel)
 
 	del := obj.Command("del", "Deletes a file or bucket from the store").Action(c.delAction).Alias("rm")
 	del.Arg("bucket", "The bucket to act on").Required().StringVar(&c.bucket)
@@ -98,11 +113,34 @@ NOTE: This is an experimental feature.
 	del.Flag("force", "Act without confirmation").Short('f').UnNegatableBoolVar(&c.force)
 
 	get := obj.Command("get", "Retrieves a file from the store").Action(c.getAction)
+	get.HelpLong(`With --recursive all files with names below the given prefix are written
+to a directory named after the prefix or --output. Files that already exist
+with the same size and digest are skipped so an interrupted transfer can be
+resumed by running the same command again. Files that were partially
+retrieved continue after the last chunk written as long as the object did not
+change since.
+`)
 	get.Arg("bucket", "The bucket to act on").Required().StringVar(&c.bucket)
-	get.Arg("file", "The file to retrieve").Required().StringVar(&c.file)
-	get.Flag("output", "Override the output file name").Short('O').StringVar(&c.overrideName)
+	get.Arg("file", "The file to retrieve, the name prefix for recursive gets").Required().StringVar(&c.file)
+	get.Flag("output", "Override the output file or directory name").Short('O').StringVar(&c.overrideName)
 	get.Flag("progress", "Disable progress bars").Default("true").BoolVar(&c.progress)
 	get.Flag("force", "Act without confirmation").Short('f').UnNegatableBoolVar(&c.force)
+	get.Flag("recursive", "Retrieves all files below a name prefix, skipping files already retrieved unchanged").Short('r').UnNegatableBoolVar(&c.recursive)
+	get.Flag("parallel", "Number of files to retrieve concurrently when getting recursively").Default("4").IntVar(&c.parallel)
+
+	link := obj.Command("link", "Adds a link to an object or bucket").Alias("ln").Action(c.linkAction)
+	link.HelpLong(`Links are names in a bucket that point to an object in the same or another
+bucket, or to an entire bucket. Getting a link retrieves the object it points
+to, names below a link to a bucket retrieve objects from the linked bucket.
+
+Links can be replaced, for example to point a "latest" name to a new version:
+
+  nats obj link ARTIFACTS app/latest --to ARTIFACTS/app/v1.2.0 --force
+`)
+	link.Arg("bucket", "The bucket to add the link to").Required().StringVar(&c.bucket)
+	link.Arg("name", "The name of the link").Required().StringVar(&c.file)
+	link.Flag("to", "The object to link to as bucket/name, or a bucket to link to the entire bucket").Required().PlaceHolder("TARGET").StringVar(&c.linkTarget)
+	link.Flag("force", "Replace existing links without prompting").Short('f').UnNegatableBoolVar(&c.force)
 
 	info := obj.Command("info", "Get information about a bucket or object").Alias("show").Alias("i").Action(c.infoAction)
 	info.Arg("bucket", "The bucket to act on").StringVar(&c.bucket)
@@ -116,8 +154,26 @@ NOTE: This is an experimental feature.
 	seal.Arg("bucket", "The bucket to act on").Required().StringVar(&c.bucket)
 	seal.Flag("force", "Force sealing without prompting").Short('f').UnNegatableBoolVar(&c.force)
 
+	verify := obj.Command("verify", "Verifies the integrity of objects in a bucket").Action(c.verifyAction)
+	verify.HelpLong(`Reads every chunk of every object comparing the number of chunks, the size
+and the digest with the object information, and finds orphaned chunks that
+are not referenced by any object, usually left behind by interrupted puts.
+
+Chunks of objects that are being put while verifying are reported as
+orphaned, do not purge orphans while objects are being put.
+
+The command exits with a non zero code when problems are found.
+`)
+	verify.Arg("bucket", "The bucket to act on").Required().StringVar(&c.bucket)
+	verify.Arg("file", "Verify only a single object").StringVar(&c.file)
+	verify.Flag("purge-orphans", "Purges orphaned chunks").UnNegatableBoolVar(&c.purgeOrphans)
+	verify.Flag("force", "Purge orphaned chunks without prompting").Short('f').UnNegatableBoolVar(&c.force)
+	verify.Flag("json", "Produce JSON output").Short('j').UnNegatableBoolVar(&c.json)
+
 	watch := obj.Command("watch", "Watch a bucket for changes").Action(c.watchAction)
 	watch.Arg("bucket", "The bucket to act on").Required().StringVar(&c.bucket)
+
+	configureObjectMountCommand(obj)
 }
 
 func init() {
@@ -317,19 +373,29 @@ func (c *objCommand) showBucketInfo(store nats.ObjectStore) error {
 }
 
 func (c *objCommand) showObjectInfo(nfo *nats.ObjectInfo) {
-	digest := strings.SplitN(nfo.Digest, "=", 2)
-	digestBytes, _ := base64.URLEncoding.DecodeString(digest[1])
-
 	cols := newColumns(fmt.Sprintf("Object information for %s > %s", nfo.Bucket, nfo.Name))
 	defer cols.Frender(os.Stdout)
 
 	if nfo.Description != "" {
 		cols.AddRowIfNotEmpty("Description", nfo.Description)
 	}
+
+	if isObjectLink(nfo) {
+		cols.AddRow("Link To", objectLinkTarget(nfo))
+		if !nfo.ModTime.IsZero() {
+			cols.AddRow("Modification Time", nfo.ModTime)
+		}
+		cols.AddRowIf("Deleted", nfo.Deleted, nfo.Deleted)
+		return
+	}
+
 	cols.AddRow("Size", fiBytes(nfo.Size))
 	cols.AddRow("Modification Time", nfo.ModTime)
 	cols.AddRow("Chunks", nfo.Chunks)
-	cols.AddRowf("Digest", "%s %x", digest[0], digestBytes)
+	if digest := strings.SplitN(nfo.Digest, "=", 2); len(digest) == 2 {
+		digestBytes, _ := base64.URLEncoding.DecodeString(digest[1])
+		cols.AddRowf("Digest", "%s %x", digest[0], digestBytes)
+	}
 	cols.AddRowIf("Deleted", nfo.Deleted, nfo.Deleted)
 	if len(nfo.Headers) > 0 {
 		var vals []string
@@ -417,11 +483,29 @@ func (c *objCommand) lsAction(_ *fisk.ParseContext) error {
 		return nil
 	}
 
+	var links bool
+	for _, i := range contents {
+		links = links || isObjectLink(i)
+	}
+
 	table := newTableWriter("Bucket Contents")
-	table.AddHeaders("Name", "Size", "Time")
+	if links {
+		table.AddHeaders("Name", "Size", "Time", "Link To")
+	} else {
+		table.AddHeaders("Name", "Size", "Time")
+	}
 
 	for _, i := range contents {
-		table.AddRow(i.Name, humanize.IBytes(i.Size), i.ModTime.Format(time.RFC3339))
+		var mtime string
+		if !i.ModTime.IsZero() {
+			mtime = i.ModTime.Format(time.RFC3339)
+		}
+
+		if links {
+			table.AddRow(i.Name, humanize.IBytes(i.Size), mtime, objectLinkTarget(i))
+		} else {
+			table.AddRow(i.Name, humanize.IBytes(i.Size), mtime)
+		}
 	}
 
 	fmt.Println(table.Render())
@@ -435,6 +519,10 @@ func (c *objCommand) putAction(_ *fisk.ParseContext) error {
 		return err
 	}
 
+	if c.recursive {
+		return c.putRecursiveAction(obj)
+	}
+
 	name := c.file
 	if c.overrideName != "" {
 		name = c.overrideName
@@ -480,6 +568,10 @@ func (c *objCommand) putAction(_ *fisk.ParseContext) error {
 			return err
 		}
 
+		if stat.IsDir() {
+			return fmt.Errorf("%s is a directory, use --recursive to put directories", c.file)
+		}
+
 		pr = f
 	}
 
@@ -517,12 +609,25 @@ func (c *objCommand) putAction(_ *fisk.ParseContext) error {
 }
 
 func (c *objCommand) getAction(_ *fisk.ParseContext) error {
-	_, _, obj, err := c.loadBucket()
+	_, js, obj, err := c.loadBucket()
 	if err != nil {
 		return err
 	}
 
-	res, err := obj.Get(c.file)
+	if c.recursive {
+		return c.getRecursiveAction(js, obj)
+	}
+
+	store, target, err := resolveObject(js, obj, c.file)
+	if err != nil {
+		return err
+	}
+
+	if target.Bucket != c.bucket || target.Name != c.file {
+		fmt.Printf("Following link %s > %s to %s > %s\n", c.bucket, c.file, target.Bucket, target.Name)
+	}
+
+	res, err := store.Get(target.Name)
 	if err != nil {
 		return err
 	}
@@ -536,7 +641,7 @@ func (c *objCommand) getAction(_ *fisk.ParseContext) error {
 		return fmt.Errorf("file has been deleted")
 	}
 
-	out := filepath.Base(nfo.Name)
+	out := filepath.Base(c.file)
 	if c.overrideName != "" {
 		out = c.overrideName
 	}
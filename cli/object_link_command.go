@@ -0,0 +1,227 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/choria-io/fisk"
+	"github.com/nats-io/nats.go"
+)
+
+// resolvedObject is an object found by following links, info describes the object in store
+type resolvedObject struct {
+	store nats.ObjectStore
+	info  *nats.ObjectInfo
+	err   error
+}
+
+func (c *objCommand) linkAction(_ *fisk.ParseContext) error {
+	bucket, name, err := parseObjectLinkTarget(c.linkTarget)
+	if err != nil {
+		return err
+	}
+
+	_, js, obj, err := c.loadBucket()
+	if err != nil {
+		return err
+	}
+
+	target := obj
+	if bucket != c.bucket {
+		target, err = js.ObjectStore(bucket)
+		if err != nil {
+			return fmt.Errorf("could not load bucket %s: %w", bucket, err)
+		}
+	}
+
+	nfo, err := obj.GetInfo(c.file)
+	switch {
+	case err == nil && !isObjectLink(nfo):
+		return fmt.Errorf("%s > %s is an object, links can only replace other links", c.bucket, c.file)
+
+	case err == nil && !c.force:
+		ok, err := askConfirmation(fmt.Sprintf("Replace link %s > %s to %s", c.bucket, c.file, objectLinkTarget(nfo)), false)
+		fisk.FatalIfError(err, "could not obtain confirmation")
+
+		if !ok {
+			return nil
+		}
+
+	case err != nil && !errors.Is(err, nats.ErrObjectNotFound):
+		return err
+	}
+
+	if name == "" {
+		nfo, err = obj.AddBucketLink(c.file, target)
+	} else {
+		var tnfo *nats.ObjectInfo
+		tnfo, err = target.GetInfo(name)
+		if err != nil {
+			return fmt.Errorf("could not load %s > %s: %w", bucket, name, err)
+		}
+
+		nfo, err = obj.AddLink(c.file, tnfo)
+	}
+	if err != nil {
+		return err
+	}
+
+	c.showObjectInfo(nfo)
+
+	return nil
+}
+
+// parseObjectLinkTarget parses bucket/name or bucket, a bucket alone indicates a link to the entire bucket
+func parseObjectLinkTarget(target string) (string, string, error) {
+	bucket, name, _ := strings.Cut(target, "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("invalid link target %q, expected bucket/name or bucket", target)
+	}
+
+	return bucket, name, nil
+}
+
+func isObjectLink(nfo *nats.ObjectInfo) bool {
+	return nfo != nil && nfo.Opts != nil && nfo.Opts.Link != nil
+}
+
+func isObjectBucketLink(nfo *nats.ObjectInfo) bool {
+	return isObjectLink(nfo) && nfo.Opts.Link.Name == ""
+}
+
+// objectLinkTarget describes the target of a link
+func objectLinkTarget(nfo *nats.ObjectInfo) string {
+	if !isObjectLink(nfo) {
+		return ""
+	}
+
+	if nfo.Opts.Link.Name == "" {
+		return fmt.Sprintf("bucket %s", nfo.Opts.Link.Bucket)
+	}
+
+	return fmt.Sprintf("%s > %s", nfo.Opts.Link.Bucket, nfo.Opts.Link.Name)
+}
+
+// linkedObjectStore loads the bucket the link nfo stored in obj points to
+func linkedObjectStore(js nats.JetStreamContext, obj nats.ObjectStore, nfo *nats.ObjectInfo) (nats.ObjectStore, error) {
+	if nfo.Opts.Link.Bucket == nfo.Bucket {
+		return obj, nil
+	}
+
+	return js.ObjectStore(nfo.Opts.Link.Bucket)
+}
+
+// resolveObject finds the object called name following links to objects and names below links to buckets
+func resolveObject(js nats.JetStreamContext, obj nats.ObjectStore, name string) (nats.ObjectStore, *nats.ObjectInfo, error) {
+	nfo, err := obj.GetInfo(name)
+	if err == nil {
+		if !isObjectLink(nfo) {
+			return obj, nfo, nil
+		}
+
+		if isObjectBucketLink(nfo) {
+			return nil, nil, fmt.Errorf("%s is a link to %s", name, objectLinkTarget(nfo))
+		}
+
+		store, err := linkedObjectStore(js, obj, nfo)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		tnfo, err := store.GetInfo(nfo.Opts.Link.Name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not resolve link to %s: %w", objectLinkTarget(nfo), err)
+		}
+
+		return store, tnfo, nil
+	}
+
+	if !errors.Is(err, nats.ErrObjectNotFound) {
+		return nil, nil, err
+	}
+
+	// the name might be below a link to a bucket, only the names of its parent directories are looked up so
+	// this does not depend on the size of the bucket
+	for i := strings.LastIndex(name, "/"); i > 0; i = strings.LastIndex(name[:i], "/") {
+		for _, lname := range []string{name[:i], name[:i+1]} {
+			lnfo, lerr := obj.GetInfo(lname)
+			if errors.Is(lerr, nats.ErrObjectNotFound) || (lerr == nil && !isObjectBucketLink(lnfo)) {
+				continue
+			}
+			if lerr != nil {
+				return nil, nil, lerr
+			}
+
+			store, err := linkedObjectStore(js, obj, lnfo)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			tnfo, err := store.GetInfo(name[i+1:])
+			if err != nil {
+				return nil, nil, err
+			}
+
+			// links in linked buckets are not followed to avoid loops
+			if isObjectLink(tnfo) {
+				return nil, nil, fmt.Errorf("%s is a link in a linked bucket", name)
+			}
+
+			return store, tnfo, nil
+		}
+	}
+
+	return nil, nil, err
+}
+
+// resolveObjectLinks resolves all links in objects, objects in linked buckets are included below the link name
+func resolveObjectLinks(js nats.JetStreamContext, obj nats.ObjectStore, objects map[string]*nats.ObjectInfo) map[string]*resolvedObject {
+	resolved := make(map[string]*resolvedObject, len(objects))
+
+	for name, nfo := range objects {
+		switch {
+		case !isObjectLink(nfo):
+			resolved[name] = &resolvedObject{store: obj, info: nfo}
+
+		case isObjectBucketLink(nfo):
+			store, err := linkedObjectStore(js, obj, nfo)
+			if err != nil {
+				resolved[name] = &resolvedObject{err: err}
+				continue
+			}
+
+			linked, err := listObjects(store)
+			if err != nil {
+				resolved[name] = &resolvedObject{err: err}
+				continue
+			}
+
+			for lname, lnfo := range linked {
+				if !isObjectLink(lnfo) {
+					resolved[path.Join(name, lname)] = &resolvedObject{store: store, info: lnfo}
+				}
+			}
+
+		default:
+			store, tnfo, err := resolveObject(js, obj, name)
+			resolved[name] = &resolvedObject{store: store, info: tnfo, err: err}
+		}
+	}
+
+	return resolved
+}
@@ -0,0 +1,115 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"testing"
+
+	"github.com/nats-io/jsm.go"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+func TestParseObjectLinkTarget(t *testing.T) {
+	for _, tc := range []struct {
+		target string
+		bucket string
+		name   string
+	}{
+		{"ARTIFACTS", "ARTIFACTS", ""},
+		{"ARTIFACTS/app.tgz", "ARTIFACTS", "app.tgz"},
+		{"ARTIFACTS/app/v1/app.tgz", "ARTIFACTS", "app/v1/app.tgz"},
+	} {
+		bucket, name, err := parseObjectLinkTarget(tc.target)
+		assertNoError(t, err)
+		if bucket != tc.bucket || name != tc.name {
+			t.Fatalf("invalid parse of %q: %q %q", tc.target, bucket, name)
+		}
+	}
+
+	_, _, err := parseObjectLinkTarget("/app.tgz")
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+}
+
+func TestResolveObjectLinks(t *testing.T) {
+	withJetStream(t, func(_ *server.Server, nc *nats.Conn, _ *jsm.Manager) {
+		js, err := nc.JetStream()
+		assertNoError(t, err)
+
+		artifacts, err := js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: "ARTIFACTS"})
+		assertNoError(t, err)
+		releases, err := js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: "RELEASES"})
+		assertNoError(t, err)
+
+		v1, err := artifacts.PutString("app/v1.tgz", "version one")
+		assertNoError(t, err)
+		_, err = artifacts.PutString("app/v2.tgz", "version two")
+		assertNoError(t, err)
+
+		latest, err := releases.AddLink("latest", v1)
+		assertNoError(t, err)
+		if objectLinkTarget(latest) != "ARTIFACTS > app/v1.tgz" {
+			t.Fatalf("invalid link target %q", objectLinkTarget(latest))
+		}
+
+		all, err := releases.AddBucketLink("all", artifacts)
+		assertNoError(t, err)
+		if !isObjectBucketLink(all) || objectLinkTarget(all) != "bucket ARTIFACTS" {
+			t.Fatalf("invalid bucket link %+v", all)
+		}
+
+		store, nfo, err := resolveObject(js, releases, "latest")
+		assertNoError(t, err)
+		if nfo.Bucket != "ARTIFACTS" || nfo.Name != "app/v1.tgz" {
+			t.Fatalf("invalid resolved object %+v", nfo)
+		}
+		body, err := store.GetString(nfo.Name)
+		assertNoError(t, err)
+		if body != "version one" {
+			t.Fatalf("invalid body %q", body)
+		}
+
+		_, nfo, err = resolveObject(js, releases, "all/app/v2.tgz")
+		assertNoError(t, err)
+		if nfo.Name != "app/v2.tgz" {
+			t.Fatalf("invalid resolved object %+v", nfo)
+		}
+
+		_, _, err = resolveObject(js, releases, "all")
+		if err == nil {
+			t.Fatalf("expected bucket links to not resolve to an object")
+		}
+
+		_, _, err = resolveObject(js, releases, "missing")
+		if err != nats.ErrObjectNotFound {
+			t.Fatalf("expected not found error, got %v", err)
+		}
+
+		objects, err := listObjects(releases)
+		assertNoError(t, err)
+
+		resolved := resolveObjectLinks(js, releases, objects)
+		if len(resolved) != 3 {
+			t.Fatalf("expected 3 resolved objects got %d", len(resolved))
+		}
+		for _, name := range []string{"latest", "all/app/v1.tgz", "all/app/v2.tgz"} {
+			r, ok := resolved[name]
+			if !ok || r.err != nil || r.info.Bucket != "ARTIFACTS" {
+				t.Fatalf("invalid resolution for %s: %+v", name, r)
+			}
+		}
+	})
+}
@@ -0,0 +1,516 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/choria-io/fisk"
+	"github.com/dustin/go-humanize"
+	"github.com/gosuri/uiprogress"
+	"github.com/nats-io/nats.go"
+)
+
+// objectTransfer is a single file to copy between a directory and a bucket
+type objectTransfer struct {
+	name string
+	file string
+	size uint64
+	// the object to read when getting, differs from name for linked objects
+	info *nats.ObjectInfo
+}
+
+// objectTransferResult summarizes a recursive put or get
+type objectTransferResult struct {
+	transferred atomic.Int64
+	skipped     atomic.Int64
+	bytes       atomic.Uint64
+	mu          sync.Mutex
+	failed      []string
+}
+
+func (r *objectTransferResult) fail(name string, err error) {
+	r.mu.Lock()
+	r.failed = append(r.failed, fmt.Sprintf("%s: %s", name, err))
+	r.mu.Unlock()
+}
+
+// objectFileDigest calculates the digest of a file in the format used by ObjectInfo.Digest
+func objectFileDigest(file string) (string, error) {
+	fh, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer fh.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, fh)
+	if err != nil {
+		return "", err
+	}
+
+	return nats.GetObjectDigestValue(h), nil
+}
+
+// objectUnchanged determines if file has the same size and digest as the object nfo
+func objectUnchanged(nfo *nats.ObjectInfo, file string, size uint64) bool {
+	if nfo == nil || nfo.Deleted || nfo.Size != size || nfo.Digest == "" {
+		return false
+	}
+
+	digest, err := objectFileDigest(file)
+	if err != nil {
+		return false
+	}
+
+	return digest == nfo.Digest
+}
+
+// objectRelativeName is the name of an object relative to prefix, false when the object is not below prefix
+func objectRelativeName(prefix string, name string) (string, bool) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return name, true
+	}
+
+	if !strings.HasPrefix(name, prefix+"/") {
+		return "", false
+	}
+
+	return strings.TrimPrefix(name, prefix+"/"), true
+}
+
+// listObjects lists all objects in a bucket, an empty bucket is not an error
+func listObjects(obj nats.ObjectStore) (map[string]*nats.ObjectInfo, error) {
+	contents, err := obj.List()
+	if err != nil && !errors.Is(err, nats.ErrNoObjectsFound) {
+		return nil, err
+	}
+
+	objects := make(map[string]*nats.ObjectInfo, len(contents))
+	for _, nfo := range contents {
+		objects[nfo.Name] = nfo
+	}
+
+	return objects, nil
+}
+
+// transferObjects runs cb for every transfer using c.parallel workers
+func (c *objCommand) transferObjects(transfers []*objectTransfer, cb func(*objectTransfer) error) *objectTransferResult {
+	result := &objectTransferResult{}
+	if len(transfers) == 0 {
+		return result
+	}
+
+	var progress *uiprogress.Bar
+	if !opts.Trace && c.progress {
+		progress = uiprogress.AddBar(len(transfers)).AppendCompleted().PrependFunc(func(b *uiprogress.Bar) string {
+			return fmt.Sprintf("%d / %d files", b.Current(), len(transfers))
+		})
+		progress.Width = progressWidth()
+
+		fmt.Println()
+		uiprogress.Start()
+	}
+
+	if c.parallel < 1 {
+		c.parallel = 1
+	}
+
+	work := make(chan *objectTransfer, len(transfers))
+	for _, t := range transfers {
+		work <- t
+	}
+	close(work)
+
+	var wg sync.WaitGroup
+	for i := 0; i < c.parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for t := range work {
+				err := cb(t)
+				switch {
+				case err != nil:
+					result.fail(t.name, err)
+				default:
+					result.transferred.Add(1)
+					result.bytes.Add(t.size)
+				}
+
+				if progress != nil {
+					progress.Incr()
+				} else if err == nil {
+					fmt.Printf("Transferred %s (%s)\n", t.name, humanize.IBytes(t.size))
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if progress != nil {
+		uiprogress.Stop()
+		fmt.Println()
+	}
+
+	return result
+}
+
+func (c *objCommand) showTransferResult(action string, result *objectTransferResult) error {
+	sort.Strings(result.failed)
+	for _, failure := range result.failed {
+		fmt.Printf("Failed: %s\n", failure)
+	}
+
+	fmt.Printf("%s %s files totaling %s, skipped %s unchanged files\n", action, f(result.transferred.Load()), humanize.IBytes(result.bytes.Load()), f(result.skipped.Load()))
+
+	if len(result.failed) > 0 {
+		return fmt.Errorf("%d files failed, run the command again to retry them", len(result.failed))
+	}
+
+	return nil
+}
+
+// putRecursiveAction uploads a directory tree, skipping files already stored with the same digest
+func (c *objCommand) putRecursiveAction(obj nats.ObjectStore) error {
+	if c.file == "" {
+		return fmt.Errorf("a directory is required for recursive puts")
+	}
+
+	root := filepath.Clean(c.file)
+	stat, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	if !stat.IsDir() {
+		return fmt.Errorf("%s is not a directory", root)
+	}
+
+	prefix := filepath.Base(root)
+	if c.overrideName != "" {
+		prefix = strings.Trim(c.overrideName, "/")
+	}
+
+	existing, err := listObjects(obj)
+	if err != nil {
+		return err
+	}
+
+	hdr, err := parseStringsToHeader(c.hdrs, 0)
+	if err != nil {
+		return err
+	}
+
+	var transfers []*objectTransfer
+	var replacing int
+	result := &objectTransferResult{}
+
+	err = filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+
+		name := path.Join(prefix, filepath.ToSlash(rel))
+		nfo := existing[name]
+
+		if objectUnchanged(nfo, file, uint64(info.Size())) {
+			result.skipped.Add(1)
+			return nil
+		}
+
+		if nfo != nil {
+			replacing++
+		}
+
+		transfers = append(transfers, &objectTransfer{name: name, file: file, size: uint64(info.Size())})
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(transfers) == 0 {
+		fmt.Printf("All %s files in %s are up to date in bucket %s\n", f(result.skipped.Load()), root, c.bucket)
+		return nil
+	}
+
+	if replacing > 0 && !c.force {
+		ok, err := askConfirmation(fmt.Sprintf("Replace %d existing files in bucket %s", replacing, c.bucket), false)
+		fisk.FatalIfError(err, "could not obtain confirmation")
+
+		if !ok {
+			return nil
+		}
+	}
+
+	res := c.transferObjects(transfers, func(t *objectTransfer) error {
+		fh, err := os.Open(t.file)
+		if err != nil {
+			return err
+		}
+		defer fh.Close()
+
+		_, err = obj.Put(&nats.ObjectMeta{Name: t.name, Description: c.description, Headers: hdr}, fh)
+
+		return err
+	})
+	res.skipped.Store(result.skipped.Load())
+
+	return c.showTransferResult("Uploaded", res)
+}
+
+// getRecursiveAction downloads all objects below a prefix into a directory, skipping files that already match, links are followed
+func (c *objCommand) getRecursiveAction(js nats.JetStreamContext, obj nats.ObjectStore) error {
+	prefix := strings.Trim(c.file, "/")
+
+	out := path.Base(prefix)
+	if prefix == "" || c.overrideName != "" {
+		out = c.overrideName
+	}
+	if out == "" {
+		return fmt.Errorf("--output is required when getting an entire bucket")
+	}
+
+	out, err := filepath.Abs(out)
+	if err != nil {
+		return err
+	}
+
+	existing, err := listObjects(obj)
+	if err != nil {
+		return err
+	}
+
+	var transfers []*objectTransfer
+	var replacing int
+	result := &objectTransferResult{}
+
+	for name, resolved := range resolveObjectLinks(js, obj, existing) {
+		rel, ok := objectRelativeName(prefix, name)
+		if !ok {
+			continue
+		}
+
+		if resolved.err != nil {
+			result.fail(name, resolved.err)
+			continue
+		}
+		nfo := resolved.info
+
+		target := filepath.Join(out, filepath.FromSlash(rel))
+		if !strings.HasPrefix(target, out+string(filepath.Separator)) {
+			result.fail(name, fmt.Errorf("name resolves outside of %s", out))
+			continue
+		}
+
+		stat, err := os.Stat(target)
+		if err == nil {
+			if objectUnchanged(nfo, target, uint64(stat.Size())) {
+				result.skipped.Add(1)
+				continue
+			}
+			replacing++
+		}
+
+		transfers = append(transfers, &objectTransfer{name: name, file: target, size: nfo.Size, info: nfo})
+	}
+
+	if len(transfers) == 0 && len(result.failed) == 0 {
+		if result.skipped.Load() == 0 {
+			return fmt.Errorf("no objects found below %q in bucket %s", prefix, c.bucket)
+		}
+
+		fmt.Printf("All %s files in %s are up to date with bucket %s\n", f(result.skipped.Load()), out, c.bucket)
+		return nil
+	}
+
+	sort.Slice(transfers, func(i, j int) bool { return transfers[i].name < transfers[j].name })
+
+	if replacing > 0 && !c.force {
+		ok, err := askConfirmation(fmt.Sprintf("Replace %d existing files in %s", replacing, out), false)
+		fisk.FatalIfError(err, "could not obtain confirmation")
+
+		if !ok {
+			return nil
+		}
+	}
+
+	res := c.transferObjects(transfers, func(t *objectTransfer) error {
+		return getObjectToFile(js, t.info, t.file)
+	})
+	res.skipped.Store(result.skipped.Load())
+	res.failed = append(res.failed, result.failed...)
+
+	return c.showTransferResult("Downloaded", res)
+}
+
+// objectPartialFiles are the names of the partial download of an object version and the file recording its progress
+func objectPartialFiles(nfo *nats.ObjectInfo, file string) (string, string) {
+	partial := filepath.Join(filepath.Dir(file), fmt.Sprintf(".%s.%s.partial", filepath.Base(file), nfo.NUID))
+	return partial, partial + ".progress"
+}
+
+// readObjectPartialProgress reads the size of a partial download and the stream sequence of its last chunk, 0 when
+// there is no usable progress
+func readObjectPartialProgress(file string) (int64, uint64) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return 0, 0
+	}
+
+	var offset int64
+	var seq uint64
+	_, err = fmt.Sscanf(string(data), "%d %d", &offset, &seq)
+	if err != nil || offset < 0 {
+		return 0, 0
+	}
+
+	return offset, seq
+}
+
+// getObjectToFile downloads an object into a partial file that is renamed to file once complete, an interrupted
+// download of the same object version continues after the last chunk that was written
+func getObjectToFile(js nats.JetStreamContext, nfo *nats.ObjectInfo, file string) error {
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return err
+	}
+
+	partial, progress := objectPartialFiles(nfo, file)
+
+	// partial downloads of previous versions of the object can not be resumed
+	stale, _ := filepath.Glob(filepath.Join(filepath.Dir(file), fmt.Sprintf(".%s.*.partial*", filepath.Base(file))))
+	for _, old := range stale {
+		if old != partial && old != progress {
+			os.Remove(old)
+		}
+	}
+
+	offset, seq := readObjectPartialProgress(progress)
+
+	pf, err := os.OpenFile(partial, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer pf.Close()
+
+	stat, err := pf.Stat()
+	if err != nil {
+		return err
+	}
+	if stat.Size() < offset {
+		offset, seq = 0, 0
+	}
+
+	// anything written after the last recorded chunk is discarded and the digest covers the kept data
+	err = pf.Truncate(offset)
+	if err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	_, err = io.Copy(h, io.NewSectionReader(pf, 0, offset))
+	if err != nil {
+		return err
+	}
+
+	_, err = pf.Seek(offset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	if uint64(offset) < nfo.Size {
+		subOpts := []nats.SubOpt{nats.BindStream("OBJ_" + nfo.Bucket), nats.OrderedConsumer()}
+		if seq > 0 {
+			subOpts = append(subOpts, nats.StartSequence(seq+1))
+		} else {
+			subOpts = append(subOpts, nats.DeliverAll())
+		}
+
+		sub, err := js.SubscribeSync(fmt.Sprintf("$O.%s.C.%s", nfo.Bucket, nfo.NUID), subOpts...)
+		if err != nil {
+			return err
+		}
+		defer sub.Unsubscribe()
+
+		for uint64(offset) < nfo.Size {
+			msg, err := sub.NextMsg(opts.Timeout)
+			if err != nil {
+				return err
+			}
+
+			meta, err := msg.Metadata()
+			if err != nil {
+				return err
+			}
+
+			_, err = pf.Write(msg.Data)
+			if err != nil {
+				return err
+			}
+			h.Write(msg.Data)
+			offset += int64(len(msg.Data))
+
+			err = os.WriteFile(progress, []byte(fmt.Sprintf("%d %d", offset, meta.Sequence.Stream)), 0600)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = pf.Close()
+	if err != nil {
+		return err
+	}
+
+	if uint64(offset) != nfo.Size || (nfo.Digest != "" && nats.GetObjectDigestValue(h) != nfo.Digest) {
+		os.Remove(partial)
+		os.Remove(progress)
+		return fmt.Errorf("downloaded data does not match the object digest")
+	}
+
+	err = os.Rename(partial, file)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(progress)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
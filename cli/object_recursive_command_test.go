@@ -0,0 +1,142 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nats-io/jsm.go"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+func TestObjectRecursive(t *testing.T) {
+	withJetStream(t, func(_ *server.Server, nc *nats.Conn, _ *jsm.Manager) {
+		js, err := nc.JetStream()
+		assertNoError(t, err)
+
+		obj, err := js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: "MODELS"})
+		assertNoError(t, err)
+
+		src := filepath.Join(t.TempDir(), "model")
+		files := map[string]string{
+			"config.json":         `{"layers": 3}`,
+			"weights/layer1.bin":  "layer one",
+			"weights/layer2.bin":  "layer two",
+			"weights/deep/x.data": "",
+		}
+		for name, content := range files {
+			file := filepath.Join(src, filepath.FromSlash(name))
+			assertNoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+			assertNoError(t, os.WriteFile(file, []byte(content), 0644))
+		}
+
+		cmd := &objCommand{bucket: "MODELS", file: src, parallel: 2, force: true}
+		assertNoError(t, cmd.putRecursiveAction(obj))
+
+		nfo, err := obj.GetInfo("model/weights/layer1.bin")
+		assertNoError(t, err)
+		if nfo.Size != 9 {
+			t.Fatalf("invalid size %d", nfo.Size)
+		}
+
+		if !objectUnchanged(nfo, filepath.Join(src, "weights", "layer1.bin"), 9) {
+			t.Fatalf("expected the file to be unchanged")
+		}
+
+		// a second put only uploads the changed file
+		assertNoError(t, os.WriteFile(filepath.Join(src, "config.json"), []byte(`{"layers": 4}`), 0644))
+		assertNoError(t, cmd.putRecursiveAction(obj))
+
+		nfo, err = obj.GetInfo("model/layer1.bin")
+		if err == nil {
+			t.Fatalf("unexpected object %v", nfo)
+		}
+
+		_, err = obj.PutString("other/file.txt", "other")
+		assertNoError(t, err)
+
+		dst := filepath.Join(t.TempDir(), "restored")
+		cmd = &objCommand{bucket: "MODELS", file: "model/", overrideName: dst, parallel: 2, force: true}
+		assertNoError(t, cmd.getRecursiveAction(js, obj))
+
+		files["config.json"] = `{"layers": 4}`
+		for name, content := range files {
+			body, err := os.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+			assertNoError(t, err)
+			if string(body) != content {
+				t.Fatalf("invalid content for %s: %q", name, body)
+			}
+		}
+
+		_, err = os.Stat(filepath.Join(dst, "file.txt"))
+		if !os.IsNotExist(err) {
+			t.Fatalf("expected objects outside the prefix to be skipped")
+		}
+
+		rel, ok := objectRelativeName("model", "model/a/b")
+		if !ok || rel != "a/b" {
+			t.Fatalf("invalid relative name %q", rel)
+		}
+		_, ok = objectRelativeName("model", "models/a")
+		if ok {
+			t.Fatalf("expected models/a to not match prefix model")
+		}
+	})
+}
+
+func TestGetObjectToFileResume(t *testing.T) {
+	withJetStream(t, func(_ *server.Server, nc *nats.Conn, _ *jsm.Manager) {
+		js, err := nc.JetStream()
+		assertNoError(t, err)
+
+		obj, err := js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: "FILES"})
+		assertNoError(t, err)
+
+		nfo, err := obj.Put(&nats.ObjectMeta{Name: "data", Opts: &nats.ObjectMetaOptions{ChunkSize: 4}}, strings.NewReader("0123456789abcdef"))
+		assertNoError(t, err)
+
+		// an interrupted download that wrote the first two chunks, at sequences 1 and 2, and part of the third
+		file := filepath.Join(t.TempDir(), "data")
+		partial, progress := objectPartialFiles(nfo, file)
+		assertNoError(t, os.WriteFile(partial, []byte("0123456789"), 0644))
+		assertNoError(t, os.WriteFile(progress, []byte("8 2"), 0600))
+
+		assertNoError(t, getObjectToFile(js, nfo, file))
+		body, err := os.ReadFile(file)
+		assertNoError(t, err)
+		if string(body) != "0123456789abcdef" {
+			t.Fatalf("invalid content %q", body)
+		}
+		for _, name := range []string{partial, progress} {
+			if _, err := os.Stat(name); !os.IsNotExist(err) {
+				t.Fatalf("expected %s to be removed", name)
+			}
+		}
+
+		// corrupt partial data is detected using the digest and discarded
+		assertNoError(t, os.WriteFile(partial, []byte("XXXXXXXX"), 0644))
+		assertNoError(t, os.WriteFile(progress, []byte("8 2"), 0600))
+		err = getObjectToFile(js, nfo, file)
+		if err == nil || !strings.Contains(err.Error(), "digest") {
+			t.Fatalf("expected digest error got %v", err)
+		}
+		if _, err := os.Stat(partial); !os.IsNotExist(err) {
+			t.Fatalf("expected the partial file to be removed")
+		}
+	})
+}
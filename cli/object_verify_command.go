@@ -0,0 +1,276 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/choria-io/fisk"
+	"github.com/dustin/go-humanize"
+	"github.com/fatih/color"
+	"github.com/nats-io/nats.go"
+)
+
+// objectVerification is the result of verifying the chunks of a single object
+type objectVerification struct {
+	Name           string   `json:"name"`
+	NUID           string   `json:"nuid"`
+	Size           uint64   `json:"size"`
+	FoundSize      uint64   `json:"found_size"`
+	Chunks         uint32   `json:"chunks"`
+	FoundChunks    uint64   `json:"found_chunks"`
+	Digest         string   `json:"digest"`
+	ComputedDigest string   `json:"computed_digest"`
+	Problems       []string `json:"problems,omitempty"`
+}
+
+// objectOrphan is a chunk subject not referenced by any object
+type objectOrphan struct {
+	Subject string `json:"subject"`
+	Chunks  uint64 `json:"chunks"`
+	Size    uint64 `json:"size"`
+}
+
+// objectVerifyReport is the result of verifying a bucket
+type objectVerifyReport struct {
+	Bucket  string                `json:"bucket"`
+	Objects []*objectVerification `json:"objects"`
+	Damaged int                   `json:"damaged"`
+	Orphans []*objectOrphan       `json:"orphans,omitempty"`
+}
+
+func (c *objCommand) verifyAction(_ *fisk.ParseContext) error {
+	_, js, _, err := c.loadBucket()
+	if err != nil {
+		return err
+	}
+
+	if c.file != "" && c.purgeOrphans {
+		return fmt.Errorf("orphans can only be purged when verifying the entire bucket")
+	}
+
+	report, err := verifyObjectBucket(js, c.bucket, c.file)
+	if err != nil {
+		return err
+	}
+
+	if c.json {
+		err = printJSON(report)
+		if err != nil {
+			return err
+		}
+	} else {
+		c.showVerifyReport(report)
+	}
+
+	if c.purgeOrphans && len(report.Orphans) > 0 {
+		purged, err := c.purgeObjectOrphans(js, report)
+		if err != nil {
+			return err
+		}
+		if purged {
+			report.Orphans = nil
+		}
+	}
+
+	if report.Damaged > 0 || len(report.Orphans) > 0 {
+		os.Exit(1)
+	}
+
+	return nil
+}
+
+func (c *objCommand) showVerifyReport(report *objectVerifyReport) {
+	if len(report.Objects) > 0 {
+		table := newTableWriter(fmt.Sprintf("Verified %s objects in bucket %s", f(len(report.Objects)), report.Bucket))
+		table.AddHeaders("Name", "Size", "Chunks", "Status")
+		for _, o := range report.Objects {
+			status := color.GreenString("OK")
+			if len(o.Problems) > 0 {
+				status = color.RedString(strings.Join(o.Problems, ", "))
+			}
+			table.AddRow(o.Name, humanize.IBytes(o.Size), f(o.Chunks), status)
+		}
+		fmt.Println(table.Render())
+	}
+
+	if len(report.Orphans) > 0 {
+		var size uint64
+		table := newTableWriter(fmt.Sprintf("%s orphaned chunk subjects in bucket %s", f(len(report.Orphans)), report.Bucket))
+		table.AddHeaders("Subject", "Chunks", "Size")
+		for _, o := range report.Orphans {
+			table.AddRow(o.Subject, f(o.Chunks), humanize.IBytes(o.Size))
+			size += o.Size
+		}
+		fmt.Println(table.Render())
+		fmt.Printf("Orphaned chunks use %s, purge them using --purge-orphans\n\n", humanize.IBytes(size))
+	}
+
+	if report.Damaged > 0 {
+		fmt.Printf("%s: %s of %s objects are damaged\n", color.RedString("FAILED"), f(report.Damaged), f(len(report.Objects)))
+	} else {
+		fmt.Printf("All %s objects in bucket %s are intact\n", f(len(report.Objects)), report.Bucket)
+	}
+}
+
+// purgeObjectOrphans purges the orphaned chunks in report after confirmation, reporting if they were purged
+func (c *objCommand) purgeObjectOrphans(js nats.JetStreamContext, report *objectVerifyReport) (bool, error) {
+	if !c.force {
+		fmt.Println()
+		ok, err := askConfirmation(fmt.Sprintf("Really purge %d orphaned chunk subjects from bucket %s, chunks of objects being put right now will be lost", len(report.Orphans), report.Bucket), false)
+		fisk.FatalIfError(err, "could not obtain confirmation")
+
+		if !ok {
+			return false, nil
+		}
+	}
+
+	for _, orphan := range report.Orphans {
+		err := js.PurgeStream("OBJ_"+report.Bucket, &nats.StreamPurgeRequest{Subject: orphan.Subject})
+		if err != nil {
+			return false, fmt.Errorf("could not purge %s: %w", orphan.Subject, err)
+		}
+	}
+
+	fmt.Printf("Purged %s orphaned chunk subjects\n", f(len(report.Orphans)))
+
+	return true, nil
+}
+
+// verifyObjectBucket verifies the chunks of all objects in bucket, or just name when set, orphans are only searched for when verifying all objects
+func verifyObjectBucket(js nats.JetStreamContext, bucket string, name string) (*objectVerifyReport, error) {
+	stream := "OBJ_" + bucket
+	chunkPrefix := fmt.Sprintf("$O.%s.C.", bucket)
+
+	nfo, err := js.StreamInfo(stream, &nats.StreamInfoRequest{SubjectsFilter: chunkPrefix + ">"})
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := js.ObjectStore(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	objects, err := listObjects(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	if name != "" {
+		onfo, ok := objects[name]
+		if !ok {
+			return nil, nats.ErrObjectNotFound
+		}
+		objects = map[string]*nats.ObjectInfo{name: onfo}
+	}
+
+	report := &objectVerifyReport{Bucket: bucket}
+	referenced := map[string]bool{}
+
+	names := mapKeys(objects)
+	sort.Strings(names)
+
+	for _, n := range names {
+		onfo := objects[n]
+		if isObjectLink(onfo) {
+			continue
+		}
+
+		subject := chunkPrefix + onfo.NUID
+		referenced[subject] = true
+
+		v, err := verifyObjectChunks(js, stream, subject, onfo, nfo.State.Subjects[subject])
+		if err != nil {
+			return nil, err
+		}
+
+		report.Objects = append(report.Objects, v)
+		if len(v.Problems) > 0 {
+			report.Damaged++
+		}
+	}
+
+	if name != "" {
+		return report, nil
+	}
+
+	subjects := mapKeys(nfo.State.Subjects)
+	sort.Strings(subjects)
+
+	for _, subject := range subjects {
+		if referenced[subject] {
+			continue
+		}
+
+		orphan := &objectOrphan{Subject: subject, Chunks: nfo.State.Subjects[subject]}
+		err = eachStreamMessage(js, stream, streamMessageFilter{subjects: []string{subject}}, func(msg *nats.Msg, _ *nats.MsgMetadata) error {
+			orphan.Size += uint64(len(msg.Data))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		report.Orphans = append(report.Orphans, orphan)
+	}
+
+	return report, nil
+}
+
+// verifyObjectChunks reads all chunks stored for an object comparing their count, size and digest to the object info
+func verifyObjectChunks(js nats.JetStreamContext, stream string, subject string, nfo *nats.ObjectInfo, found uint64) (*objectVerification, error) {
+	v := &objectVerification{
+		Name:        nfo.Name,
+		NUID:        nfo.NUID,
+		Size:        nfo.Size,
+		Chunks:      nfo.Chunks,
+		FoundChunks: found,
+		Digest:      nfo.Digest,
+	}
+
+	h := sha256.New()
+	if found > 0 {
+		err := eachStreamMessage(js, stream, streamMessageFilter{subjects: []string{subject}}, func(msg *nats.Msg, _ *nats.MsgMetadata) error {
+			h.Write(msg.Data)
+			v.FoundSize += uint64(len(msg.Data))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	v.ComputedDigest = nats.GetObjectDigestValue(h)
+
+	switch {
+	case found < uint64(nfo.Chunks):
+		v.Problems = append(v.Problems, fmt.Sprintf("%d of %d chunks missing", uint64(nfo.Chunks)-found, nfo.Chunks))
+	case found > uint64(nfo.Chunks):
+		v.Problems = append(v.Problems, fmt.Sprintf("%d unexpected chunks", found-uint64(nfo.Chunks)))
+	}
+
+	if v.FoundSize != nfo.Size {
+		v.Problems = append(v.Problems, fmt.Sprintf("size is %s expected %s", humanize.IBytes(v.FoundSize), humanize.IBytes(nfo.Size)))
+	}
+
+	if nfo.Digest != "" && v.ComputedDigest != nfo.Digest {
+		v.Problems = append(v.Problems, "digest mismatch")
+	}
+
+	return v, nil
+}
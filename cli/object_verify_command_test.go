@@ -0,0 +1,94 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nats-io/jsm.go"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+func TestVerifyObjectBucket(t *testing.T) {
+	withJetStream(t, func(_ *server.Server, nc *nats.Conn, _ *jsm.Manager) {
+		js, err := nc.JetStream()
+		assertNoError(t, err)
+
+		obj, err := js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: "FILES"})
+		assertNoError(t, err)
+
+		good, err := obj.PutBytes("good", []byte(strings.Repeat("x", 1024)))
+		assertNoError(t, err)
+		bad, err := obj.Put(&nats.ObjectMeta{Name: "bad", Opts: &nats.ObjectMetaOptions{ChunkSize: 100}}, strings.NewReader(strings.Repeat("y", 350)))
+		assertNoError(t, err)
+		if bad.Chunks != 4 {
+			t.Fatalf("expected 4 chunks got %d", bad.Chunks)
+		}
+		_, err = obj.AddLink("link", good)
+		assertNoError(t, err)
+
+		report, err := verifyObjectBucket(js, "FILES", "")
+		assertNoError(t, err)
+		if report.Damaged != 0 || len(report.Objects) != 2 || len(report.Orphans) != 0 {
+			t.Fatalf("unexpected report: %+v", report)
+		}
+
+		// remove a chunk of bad and simulate chunks left by an interrupted put
+		msg, err := js.GetLastMsg("OBJ_FILES", "$O.FILES.C."+bad.NUID)
+		assertNoError(t, err)
+		assertNoError(t, js.DeleteMsg("OBJ_FILES", msg.Sequence))
+		_, err = js.Publish("$O.FILES.C.ORPHAN", []byte("orphaned"))
+		assertNoError(t, err)
+
+		report, err = verifyObjectBucket(js, "FILES", "")
+		assertNoError(t, err)
+		if report.Damaged != 1 {
+			t.Fatalf("expected 1 damaged object: %+v", report)
+		}
+
+		var damaged *objectVerification
+		for _, o := range report.Objects {
+			if o.Name == "bad" {
+				damaged = o
+			}
+		}
+		if damaged == nil || damaged.FoundChunks != 3 || damaged.FoundSize != 300 || len(damaged.Problems) != 3 {
+			t.Fatalf("unexpected verification: %+v", damaged)
+		}
+
+		if len(report.Orphans) != 1 || report.Orphans[0].Subject != "$O.FILES.C.ORPHAN" || report.Orphans[0].Size != 8 {
+			t.Fatalf("unexpected orphans: %+v", report.Orphans)
+		}
+
+		cmd := &objCommand{force: true}
+		purged, err := cmd.purgeObjectOrphans(js, report)
+		assertNoError(t, err)
+		if !purged {
+			t.Fatalf("expected orphans to be purged")
+		}
+		report, err = verifyObjectBucket(js, "FILES", "")
+		assertNoError(t, err)
+		if len(report.Orphans) != 0 {
+			t.Fatalf("expected orphans to be purged: %+v", report.Orphans)
+		}
+
+		report, err = verifyObjectBucket(js, "FILES", "good")
+		assertNoError(t, err)
+		if report.Damaged != 0 || len(report.Objects) != 1 || len(report.Orphans) != 0 {
+			t.Fatalf("unexpected report: %+v", report)
+		}
+	})
+}
@@ -39,6 +39,24 @@ type pubCmd struct {
 	replyTimeout time.Duration
 	forceStdin   bool
 	translate    string
+	decode       string
+	decoder      msgDecoder
+	replay       string
+	replaySpeed  float64
+	rewrites     []string
+	file         string
+	fileEnvelope bool
+	rate         string
+	jetStream    bool
+
+	replyCountIsSet bool
+	gather          bool
+	quiet           time.Duration
+	responderHeader string
+	batch           string
+	concurrency     int
+	json            bool
+	jq              string
 }
 
 func configurePubCommand(app commandHost) {
@@ -62,18 +80,41 @@ Available template functions are:
    Time             the current time
    ID               an unique ID
    Random(min, max) random string at least min long, at most max
+
+Messages recorded using 'nats sub --record' can be published again with the
+original timing between messages using --replay, --speed adjusts the timing
+and --rewrite changes subjects using subject mapping syntax:
+
+   nats pub --replay orders.ncap --speed 2 --rewrite 'orders.*=test.orders.{{wildcard(1)}}'
+
+Every line in a file can be published as a message using --file, with
+--envelope every line is a JSON object with optional subject, reply and
+headers and the data to publish:
+
+   {"subject":"orders.new","headers":{"Nats-Msg-Id":"1"},"data":{"id":1}}
+
+The rate of publishing can be limited using --rate, for example 500/s, 1000/m
+or 10/100ms. Using --jetstream waits for acknowledgements from JetStream and
+reports failed and duplicate messages.
 `
 
 	pub := app.Command("publish", "Generic data publish utility").Alias("pub").Action(c.publish)
 	addCheat("pub", pub)
 	pub.HelpLong(pubHelp)
-	pub.Arg("subject", "Subject to publish to").Required().StringVar(&c.subject)
+	pub.Arg("subject", "Subject to publish to").StringVar(&c.subject)
 	pub.Arg("body", "Message body").Default("!nil!").StringVar(&c.body)
 	pub.Flag("reply", "Sets a custom reply to subject").StringVar(&c.replyTo)
 	pub.Flag("header", "Adds headers to the message").Short('H').StringsVar(&c.hdrs)
 	pub.Flag("count", "Publish multiple messages").Default("1").IntVar(&c.cnt)
 	pub.Flag("sleep", "When publishing multiple messages, sleep between publishes").DurationVar(&c.sleep)
 	pub.Flag("force-stdin", "Force reading from stdin").UnNegatableBoolVar(&c.forceStdin)
+	pub.Flag("replay", "Publishes the messages in a capture file made using 'nats sub --record'").PlaceHolder("FILE").ExistingFileVar(&c.replay)
+	pub.Flag("speed", "When replaying, how much faster than recorded to publish, 0 publishes without delays").Default("1").Float64Var(&c.replaySpeed)
+	pub.Flag("rewrite", "When replaying, rewrites subjects matching a source pattern using a subject mapping").PlaceHolder("SOURCE=DEST").StringsVar(&c.rewrites)
+	pub.Flag("file", "Publishes every line in a file as a message").PlaceHolder("FILE").ExistingFileVar(&c.file)
+	pub.Flag("envelope", "When publishing a file, every line is a JSON object with subject, reply, headers and data").UnNegatableBoolVar(&c.fileEnvelope)
+	pub.Flag("rate", "Limits the rate of publishing, for example 500/s").PlaceHolder("RATE").StringVar(&c.rate)
+	pub.Flag("jetstream", "Waits for acknowledgements from JetStream, reporting failures and duplicates").UnNegatableBoolVar(&c.jetStream)
 
 	requestHelp := `Body and Header values of the messages may use Go templates to 
 create unique messages.
@@ -93,6 +134,20 @@ Available template functions are:
    Time             the current time
    ID               an unique ID
    Random(min, max) random string at least min long, at most max
+
+Using --gather a single request is sent and all replies are gathered until
+--replies were received, no reply arrived for --quiet or the --timeout passed.
+The replies are shown with their latency, as JSON using --json or reduced
+using a --jq query given the array of JSON replies. Only one member of a queue
+group receives a request, so services that should all reply must subscribe
+without a queue group:
+
+   nats request service.status --gather --quiet 100ms --jq 'map(.load) | add'
+
+Every line in a file can be sent as a request using --batch, --concurrency
+requests are sent in parallel and the latency of replies is reported:
+
+   nats request service.echo --batch requests.jsonl --concurrency 20
 `
 
 	req := app.Command("request", "Generic request-reply request utility").Alias("req").Action(c.publish)
@@ -103,9 +158,18 @@ Available template functions are:
 	req.Flag("raw", "Show just the output received").Short('r').UnNegatableBoolVar(&c.raw)
 	req.Flag("header", "Adds headers to the message").Short('H').StringsVar(&c.hdrs)
 	req.Flag("count", "Publish multiple messages").Default("1").IntVar(&c.cnt)
-	req.Flag("replies", "Wait for multiple replies from services. 0 waits until timeout").Default("1").IntVar(&c.replyCount)
+	req.Flag("replies", "Wait for multiple replies from services. 0 waits until timeout").Default("1").IsSetByUser(&c.replyCountIsSet).IntVar(&c.replyCount)
 	req.Flag("reply-timeout", "Maximum timeout between incoming replies.").Default("300ms").DurationVar(&c.replyTimeout)
 	req.Flag("translate", "Translate the message data by running it through the given command before output").StringVar(&c.translate)
+	req.Flag("decode", msgDecoderHelp).PlaceHolder("DECODER").StringVar(&c.decode)
+	req.Flag("gather", "Sends a single request and shows all replies gathered until --replies, --quiet or --timeout").UnNegatableBoolVar(&c.gather)
+	req.Flag("quiet", "When gathering, stops once no replies were received for this long").PlaceHolder("DURATION").DurationVar(&c.quiet)
+	req.Flag("responder-header", "When gathering, a reply header that identifies the responder").PlaceHolder("HEADER").StringVar(&c.responderHeader)
+	req.Flag("jq", "When gathering, reduces the replies using a jq query").PlaceHolder("QUERY").StringVar(&c.jq)
+	req.Flag("batch", "Sends every line in a file as a request").PlaceHolder("FILE").ExistingFileVar(&c.batch)
+	req.Flag("envelope", "When sending a batch, every line is a JSON object with subject, headers and data").UnNegatableBoolVar(&c.fileEnvelope)
+	req.Flag("concurrency", "When sending a batch, how many requests to send in parallel").Default("10").IntVar(&c.concurrency)
+	req.Flag("json", "Produce JSON output").Short('j').UnNegatableBoolVar(&c.json)
 }
 
 func init() {
@@ -183,7 +247,7 @@ func (c *pubCmd) doReq(nc *nats.Conn, progress *uiprogress.Bar) error {
 
 			switch {
 			case c.raw:
-				outPutMSGBody(m.Data, c.translate, m.Subject, "")
+				outPutMSGBody(decodeMsgBody(c.decoder, m.Header, m.Data), c.translate, m.Subject, "")
 			case logOutput:
 				log.Printf("Received with rtt %v", rtt)
 
@@ -196,7 +260,7 @@ func (c *pubCmd) doReq(nc *nats.Conn, progress *uiprogress.Bar) error {
 					fmt.Println()
 				}
 
-				outPutMSGBody(m.Data, c.translate, m.Subject, "")
+				outPutMSGBody(decodeMsgBody(c.decoder, m.Header, m.Data), c.translate, m.Subject, "")
 			}
 
 			rc++
@@ -230,12 +294,61 @@ func (c *pubCmd) doReq(nc *nats.Conn, progress *uiprogress.Bar) error {
 }
 
 func (c *pubCmd) publish(_ *fisk.ParseContext) error {
+	if c.subject == "" && c.replay == "" && c.file == "" && c.batch == "" {
+		return fmt.Errorf("subject is required")
+	}
+	if c.replay != "" && (c.file != "" || c.rate != "" || c.jetStream) {
+		return fmt.Errorf("replaying can not be combined with --file, --rate or --jetstream")
+	}
+	if c.file != "" && (c.cnt != 1 || c.body != "!nil!") {
+		return fmt.Errorf("a body or --count can not be used when publishing a file")
+	}
+	if c.fileEnvelope && c.file == "" && c.batch == "" {
+		return fmt.Errorf("--envelope requires a file to publish")
+	}
+	if c.batch != "" && (c.gather || c.cnt != 1 || c.body != "!nil!") {
+		return fmt.Errorf("a body, --count or --gather can not be used when sending a batch")
+	}
+	if c.gather && c.cnt != 1 {
+		return fmt.Errorf("--count can not be used when gathering replies")
+	}
+	if (c.jq != "" || c.quiet > 0 || c.responderHeader != "") && !c.gather {
+		return fmt.Errorf("--jq, --quiet and --responder-header require --gather")
+	}
+	if c.json && !c.gather && c.batch == "" {
+		return fmt.Errorf("--json requires --gather or --batch")
+	}
+	if c.rate != "" && c.sleep > 0 {
+		return fmt.Errorf("--rate and --sleep can not be used together")
+	}
+	if c.jetStream && c.replyTo != "" {
+		return fmt.Errorf("a reply subject can not be set when publishing to JetStream")
+	}
+
+	var err error
+	c.decoder, err = newMsgDecoder(c.decode)
+	if err != nil {
+		return err
+	}
+
 	nc, err := newNatsConn("", natsOpts()...)
 	if err != nil {
 		return err
 	}
 	defer nc.Close()
 
+	if c.replay != "" {
+		return c.replayCapture(nc)
+	}
+
+	if c.file != "" {
+		return c.publishFile(nc)
+	}
+
+	if c.batch != "" {
+		return c.sendBatch(nc)
+	}
+
 	if c.cnt < 1 {
 		c.cnt = math.MaxInt16
 	}
@@ -249,6 +362,10 @@ func (c *pubCmd) publish(_ *fisk.ParseContext) error {
 		c.body = string(body)
 	}
 
+	if c.gather {
+		return c.sendGather(nc)
+	}
+
 	var progress *uiprogress.Bar
 	if c.cnt > 20 && !c.raw {
 		progressFormat := fmt.Sprintf("%%%dd / %%d", len(fmt.Sprintf("%d", c.cnt)))
@@ -267,6 +384,11 @@ func (c *pubCmd) publish(_ *fisk.ParseContext) error {
 		return c.doReq(nc, progress)
 	}
 
+	sender, err := newPubSender(nc, c.jetStream, c.rate)
+	if err != nil {
+		return err
+	}
+
 	for i := 1; i <= c.cnt; i++ {
 		body, err := pubReplyBodyTemplate(c.body, "", i)
 		if err != nil {
@@ -278,15 +400,18 @@ func (c *pubCmd) publish(_ *fisk.ParseContext) error {
 			return err
 		}
 
-		err = nc.PublishMsg(msg)
+		err = sender.send(ctx, msg)
 		if err != nil {
 			return err
 		}
-		nc.Flush()
 
-		err = nc.LastError()
-		if err != nil {
-			return err
+		if !c.jetStream {
+			nc.Flush()
+
+			err = nc.LastError()
+			if err != nil {
+				return err
+			}
 		}
 
 		if c.cnt > 1 && c.sleep > 0 {
@@ -300,5 +425,10 @@ func (c *pubCmd) publish(_ *fisk.ParseContext) error {
 		}
 	}
 
-	return nil
+	err = sender.finish()
+	if err != nil {
+		return err
+	}
+
+	return sender.report()
 }
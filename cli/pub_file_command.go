@@ -0,0 +1,400 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gosuri/uiprogress"
+	"github.com/nats-io/nats.go"
+	"golang.org/x/time/rate"
+)
+
+// pubAsyncBatch is how many JetStream publishes are in flight before waiting for their acknowledgements
+const pubAsyncBatch = 500
+
+// pubFileMessage is a line in a file published using --file --envelope
+type pubFileMessage struct {
+	Subject string            `json:"subject"`
+	Reply   string            `json:"reply"`
+	Headers map[string]string `json:"headers"`
+	Data    json.RawMessage   `json:"data"`
+}
+
+// pubSender publishes messages optionally limiting the rate and waiting for JetStream acknowledgements
+type pubSender struct {
+	nc      *nats.Conn
+	js      nats.JetStreamContext
+	limiter *rate.Limiter
+	futures []nats.PubAckFuture
+	timeout time.Duration
+
+	published  int
+	acked      int
+	duplicates int
+	failed     int
+	failures   map[string]int
+}
+
+func newPubSender(nc *nats.Conn, jetStream bool, limit string) (*pubSender, error) {
+	s := &pubSender{nc: nc, timeout: opts.Timeout, failures: map[string]int{}}
+
+	if limit != "" {
+		l, burst, err := parsePubRate(limit)
+		if err != nil {
+			return nil, err
+		}
+		s.limiter = rate.NewLimiter(l, burst)
+	}
+
+	if jetStream {
+		js, err := nc.JetStream(jsOpts()...)
+		if err != nil {
+			return nil, err
+		}
+		s.js = js
+	}
+
+	return s, nil
+}
+
+// parsePubRate parses rates like 500/s, 1000/m or 10/500ms, a rate without a period is per second
+func parsePubRate(limit string) (rate.Limit, int, error) {
+	count, period, found := strings.Cut(limit, "/")
+	if !found {
+		period = "s"
+	}
+
+	n, err := strconv.ParseFloat(strings.TrimSpace(count), 64)
+	if err != nil || n <= 0 {
+		return 0, 0, fmt.Errorf("invalid rate %q", limit)
+	}
+
+	period = strings.TrimSpace(period)
+	if period == "" || period[0] < '0' || period[0] > '9' {
+		period = "1" + period
+	}
+
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return 0, 0, fmt.Errorf("invalid rate %q", limit)
+	}
+
+	perSecond := n / d.Seconds()
+
+	// allow 10ms worth of messages in a burst so high rates are not limited by timer resolution
+	burst := int(perSecond / 100)
+	if burst < 1 {
+		burst = 1
+	}
+
+	return rate.Limit(perSecond), burst, nil
+}
+
+// send publishes msg once the rate allows, JetStream acknowledgements are checked in batches
+func (s *pubSender) send(ctx context.Context, msg *nats.Msg) error {
+	if s.limiter != nil {
+		err := s.limiter.Wait(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.js == nil {
+		err := s.nc.PublishMsg(msg)
+		if err != nil {
+			return err
+		}
+		s.published++
+
+		return nil
+	}
+
+	future, err := s.js.PublishMsgAsync(msg)
+	if err != nil {
+		s.published++
+		s.fail(err)
+		return nil
+	}
+	s.published++
+	s.futures = append(s.futures, future)
+
+	if len(s.futures) >= pubAsyncBatch {
+		s.waitAcks()
+	}
+
+	return nil
+}
+
+func (s *pubSender) fail(err error) {
+	s.failed++
+	s.failures[err.Error()]++
+}
+
+// waitAcks waits for all in flight JetStream publishes to be acknowledged
+func (s *pubSender) waitAcks() {
+	if len(s.futures) == 0 {
+		return
+	}
+
+	select {
+	case <-s.js.PublishAsyncComplete():
+	case <-time.After(s.timeout):
+	}
+
+	for _, future := range s.futures {
+		select {
+		case ack := <-future.Ok():
+			s.acked++
+			if ack.Duplicate {
+				s.duplicates++
+			}
+		case err := <-future.Err():
+			s.fail(err)
+		default:
+			s.fail(fmt.Errorf("timeout waiting for acknowledgement"))
+		}
+	}
+
+	s.futures = s.futures[:0]
+}
+
+// finish waits for outstanding acknowledgements or flushes the connection
+func (s *pubSender) finish() error {
+	if s.js != nil {
+		s.waitAcks()
+		return nil
+	}
+
+	err := s.nc.Flush()
+	if err != nil {
+		return err
+	}
+
+	return s.nc.LastError()
+}
+
+// report shows JetStream acknowledgement results and fails when any messages were not stored
+func (s *pubSender) report() error {
+	if s.js == nil {
+		return nil
+	}
+
+	log.Printf("Received %s acknowledgements for %s messages with %s duplicates and %s failures", f(s.acked), f(s.published), f(s.duplicates), f(s.failed))
+
+	if s.failed == 0 {
+		return nil
+	}
+
+	reasons := mapKeys(s.failures)
+	sort.Slice(reasons, func(i, j int) bool { return s.failures[reasons[i]] > s.failures[reasons[j]] })
+
+	table := newTableWriter("Publish failures")
+	table.AddHeaders("Error", "Messages")
+	for _, reason := range reasons {
+		table.AddRow(reason, f(s.failures[reason]))
+	}
+	fmt.Println()
+	fmt.Println(table.Render())
+
+	return fmt.Errorf("%s messages were not acknowledged", f(s.failed))
+}
+
+// parsePubFileLine creates a message from a line in a file, lines are the body of the message unless envelope is set
+func parsePubFileLine(line []byte, envelope bool, subject string) (*nats.Msg, error) {
+	if !envelope {
+		msg := nats.NewMsg(subject)
+		msg.Data = append([]byte{}, line...)
+		return msg, nil
+	}
+
+	var m pubFileMessage
+	err := json.Unmarshal(line, &m)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message: %w", err)
+	}
+
+	if m.Subject != "" {
+		subject = m.Subject
+	}
+	if subject == "" {
+		return nil, fmt.Errorf("message has no subject")
+	}
+
+	msg := nats.NewMsg(subject)
+	msg.Reply = m.Reply
+	for k, v := range m.Headers {
+		msg.Header.Add(k, v)
+	}
+
+	if len(m.Data) > 0 && m.Data[0] == '"' {
+		var data string
+		err = json.Unmarshal(m.Data, &data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid data: %w", err)
+		}
+		msg.Data = []byte(data)
+	} else if len(m.Data) > 0 && string(m.Data) != "null" {
+		msg.Data = []byte(m.Data)
+	}
+
+	return msg, nil
+}
+
+func countPubFileLines(file string) (int, error) {
+	fh, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer fh.Close()
+
+	var lines int
+	scanner := bufio.NewScanner(fh)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if len(strings.TrimSpace(scanner.Text())) > 0 {
+			lines++
+		}
+	}
+
+	return lines, scanner.Err()
+}
+
+func (c *pubCmd) publishFile(nc *nats.Conn) error {
+	if c.subject == "" && !c.fileEnvelope {
+		return fmt.Errorf("subject is required unless publishing a file with --envelope")
+	}
+
+	sender, err := newPubSender(nc, c.jetStream, c.rate)
+	if err != nil {
+		return err
+	}
+
+	total, err := countPubFileLines(c.file)
+	if err != nil {
+		return err
+	}
+
+	fh, err := os.Open(c.file)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	ctx, cancel := signal.NotifyContext(ctx, syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	var progress *uiprogress.Bar
+	if total > 20 {
+		progressFormat := fmt.Sprintf("%%%dd / %%d", len(fmt.Sprintf("%d", total)))
+		progress = uiprogress.AddBar(total).PrependFunc(func(b *uiprogress.Bar) string {
+			return fmt.Sprintf(progressFormat, b.Current(), total)
+		}).AppendElapsed()
+		progress.Width = progressWidth()
+
+		fmt.Println()
+		uiprogress.Start()
+		uiprogress.RefreshInterval = 100 * time.Millisecond
+	}
+
+	start := time.Now()
+	err = c.publishFileLines(ctx, fh, sender, progress)
+
+	// messages published before an error or interrupt are still flushed and their acknowledgements reported
+	ferr := sender.finish()
+
+	if progress != nil {
+		uiprogress.Stop()
+		fmt.Println()
+	}
+
+	if ctx.Err() != nil {
+		log.Printf("Publishing was interrupted after %s of %s messages", f(sender.published), f(total))
+	} else if err == nil && ferr == nil && total > 1 {
+		log.Printf("Published %s messages from %s in %s", f(sender.published), c.file, time.Since(start).Round(time.Millisecond))
+	}
+
+	rerr := sender.report()
+
+	switch {
+	case err != nil:
+		return err
+	case ferr != nil:
+		return ferr
+	default:
+		return rerr
+	}
+}
+
+// publishFileLines publishes every non empty line read from r until it is exhausted or ctx is canceled
+func (c *pubCmd) publishFileLines(ctx context.Context, r io.Reader, sender *pubSender, progress *uiprogress.Bar) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	var lineNo, seq int
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		lineNo++
+
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		seq++
+
+		msg, err := parsePubFileLine(line, c.fileEnvelope, c.subject)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		if c.jetStream && msg.Reply != "" {
+			return fmt.Errorf("line %d: a reply subject can not be set when publishing to JetStream", lineNo)
+		}
+
+		err = parseStringsToMsgHeader(c.hdrs, seq, msg)
+		if err != nil {
+			return err
+		}
+
+		err = sender.send(ctx, msg)
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if progress == nil {
+			log.Printf("Published %d bytes to %q\n", len(msg.Data), msg.Subject)
+		} else {
+			progress.Incr()
+		}
+	}
+
+	return scanner.Err()
+}
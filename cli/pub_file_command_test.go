@@ -0,0 +1,177 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gosuri/uiprogress"
+	"github.com/nats-io/jsm.go"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"golang.org/x/time/rate"
+)
+
+func TestParsePubRate(t *testing.T) {
+	for _, tc := range []struct {
+		rate  string
+		limit rate.Limit
+		burst int
+	}{
+		{"500/s", 500, 5},
+		{"500", 500, 5},
+		{"60/m", 1, 1},
+		{"10/100ms", 100, 1},
+		{"20000/2s", 10000, 100},
+	} {
+		limit, burst, err := parsePubRate(tc.rate)
+		assertNoError(t, err)
+		if limit != tc.limit || burst != tc.burst {
+			t.Fatalf("expected %s to parse to %v burst %d got %v burst %d", tc.rate, tc.limit, tc.burst, limit, burst)
+		}
+	}
+
+	for _, invalid := range []string{"", "x/s", "0/s", "-1/s", "10/x", "10/0s"} {
+		_, _, err := parsePubRate(invalid)
+		if err == nil {
+			t.Fatalf("expected %q to be invalid", invalid)
+		}
+	}
+}
+
+func TestParsePubFileLine(t *testing.T) {
+	msg, err := parsePubFileLine([]byte(`{"id":1}`), false, "orders")
+	assertNoError(t, err)
+	if msg.Subject != "orders" || string(msg.Data) != `{"id":1}` {
+		t.Fatalf("invalid message: %+v", msg)
+	}
+
+	msg, err = parsePubFileLine([]byte(`{"subject":"orders.new","reply":"r","headers":{"X":"y"},"data":{"id":1}}`), true, "orders")
+	assertNoError(t, err)
+	if msg.Subject != "orders.new" || msg.Reply != "r" || msg.Header.Get("X") != "y" || string(msg.Data) != `{"id":1}` {
+		t.Fatalf("invalid message: %+v", msg)
+	}
+
+	msg, err = parsePubFileLine([]byte(`{"data":"hello\nworld"}`), true, "orders")
+	assertNoError(t, err)
+	if msg.Subject != "orders" || string(msg.Data) != "hello\nworld" {
+		t.Fatalf("invalid message: %+v", msg)
+	}
+
+	msg, err = parsePubFileLine([]byte(`{"subject":"orders.new"}`), true, "")
+	assertNoError(t, err)
+	if len(msg.Data) != 0 {
+		t.Fatalf("expected empty body got %q", msg.Data)
+	}
+
+	_, err = parsePubFileLine([]byte(`{"data":1}`), true, "")
+	if err == nil {
+		t.Fatalf("expected missing subject error")
+	}
+
+	_, err = parsePubFileLine([]byte(`hello`), true, "orders")
+	if err == nil {
+		t.Fatalf("expected invalid json error")
+	}
+}
+
+func TestPubSenderJetStream(t *testing.T) {
+	withJetStream(t, func(_ *server.Server, nc *nats.Conn, _ *jsm.Manager) {
+		js, err := nc.JetStream()
+		assertNoError(t, err)
+
+		_, err = js.AddStream(&nats.StreamConfig{Name: "ORDERS", Subjects: []string{"orders.>"}})
+		assertNoError(t, err)
+
+		sender, err := newPubSender(nc, true, "")
+		assertNoError(t, err)
+		sender.timeout = time.Second
+
+		for _, id := range []string{"1", "2", "1"} {
+			msg := nats.NewMsg("orders.new")
+			msg.Header.Set(nats.MsgIdHdr, id)
+			assertNoError(t, sender.send(ctx, msg))
+		}
+		assertNoError(t, sender.send(ctx, nats.NewMsg("other")))
+		assertNoError(t, sender.finish())
+
+		if sender.published != 4 || sender.acked != 3 || sender.duplicates != 1 || sender.failed != 1 {
+			t.Fatalf("invalid results: published %d acked %d duplicates %d failed %d", sender.published, sender.acked, sender.duplicates, sender.failed)
+		}
+
+		nfo, err := js.StreamInfo("ORDERS")
+		assertNoError(t, err)
+		if nfo.State.Msgs != 2 {
+			t.Fatalf("expected 2 messages got %d", nfo.State.Msgs)
+		}
+
+		if len(sender.failures) != 1 {
+			t.Fatalf("expected 1 failure reason got %v", sender.failures)
+		}
+	})
+}
+
+func TestPubSenderRate(t *testing.T) {
+	withJetStream(t, func(_ *server.Server, nc *nats.Conn, _ *jsm.Manager) {
+		sender, err := newPubSender(nc, false, "20/s")
+		assertNoError(t, err)
+
+		start := time.Now()
+		for i := 0; i < 5; i++ {
+			assertNoError(t, sender.send(ctx, nats.NewMsg("test")))
+		}
+		assertNoError(t, sender.finish())
+
+		if time.Since(start) < 190*time.Millisecond {
+			t.Fatalf("rate was not limited")
+		}
+	})
+}
+
+func TestPublishFileLines(t *testing.T) {
+	withJetStream(t, func(_ *server.Server, nc *nats.Conn, _ *jsm.Manager) {
+		cmd := &pubCmd{fileEnvelope: true}
+		lines := "{\"subject\":\"a\"}\n{\"subject\":\"b\"}\ninvalid\n{\"subject\":\"c\"}\n"
+
+		sender, err := newPubSender(nc, false, "")
+		assertNoError(t, err)
+		err = cmd.publishFileLines(ctx, strings.NewReader(lines), sender, uiprogress.NewBar(4))
+		if err == nil || !strings.HasPrefix(err.Error(), "line 3:") {
+			t.Fatalf("expected an error on line 3 got %v", err)
+		}
+		if sender.published != 2 {
+			t.Fatalf("expected 2 messages before the error got %d", sender.published)
+		}
+
+		cctx, cancel := context.WithCancel(ctx)
+		cancel()
+		sender, err = newPubSender(nc, false, "")
+		assertNoError(t, err)
+		assertNoError(t, cmd.publishFileLines(cctx, strings.NewReader(lines), sender, uiprogress.NewBar(4)))
+		if sender.published != 0 {
+			t.Fatalf("expected no messages after cancellation got %d", sender.published)
+		}
+
+		cmd.jetStream = true
+		sender, err = newPubSender(nc, true, "")
+		assertNoError(t, err)
+		err = cmd.publishFileLines(ctx, strings.NewReader("{\"subject\":\"a\"}\n{\"subject\":\"a\",\"reply\":\"r\"}\n"), sender, uiprogress.NewBar(2))
+		if err == nil || !strings.HasPrefix(err.Error(), "line 2: a reply subject") {
+			t.Fatalf("expected a reply error on line 2 got %v", err)
+		}
+	})
+}
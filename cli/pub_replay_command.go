@@ -0,0 +1,164 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+// replayRewriter rewrites subjects of replayed messages using subject mappings, the first matching mapping is used
+type replayRewriter struct {
+	transforms []server.SubjectTransformer
+}
+
+func newReplayRewriter(rewrites []string) (*replayRewriter, error) {
+	r := &replayRewriter{}
+
+	for _, rewrite := range rewrites {
+		src, dest, ok := strings.Cut(rewrite, "=")
+		if !ok || src == "" || dest == "" {
+			return nil, fmt.Errorf("invalid rewrite %q, expected SOURCE=DEST", rewrite)
+		}
+
+		transform, err := server.NewSubjectTransform(src, dest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rewrite %q: %w", rewrite, err)
+		}
+
+		r.transforms = append(r.transforms, transform)
+	}
+
+	return r, nil
+}
+
+func (r *replayRewriter) rewrite(subject string) string {
+	for _, transform := range r.transforms {
+		dest, err := transform.Match(subject)
+		if err == nil {
+			return dest
+		}
+	}
+
+	return subject
+}
+
+func (c *pubCmd) replayCapture(nc *nats.Conn) error {
+	if c.replaySpeed < 0 {
+		return fmt.Errorf("speed can not be negative")
+	}
+
+	rewriter, err := newReplayRewriter(c.rewrites)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(c.replay)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	ctx, cancel := signal.NotifyContext(ctx, syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	log.Printf("Replaying messages from %s", c.replay)
+
+	start := time.Now()
+	cnt, err := replayCapture(ctx, nc, file, c.replaySpeed, rewriter)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			log.Printf("Replay interrupted after %s messages", f(cnt))
+			return nil
+		}
+
+		return err
+	}
+
+	log.Printf("Replayed %s messages in %s", f(cnt), time.Since(start).Round(time.Millisecond))
+
+	return nil
+}
+
+// replayCapture publishes all messages in a capture, the time between messages is the recorded time divided by speed, 0 publishes without delay
+func replayCapture(ctx context.Context, nc *nats.Conn, r io.Reader, speed float64, rewriter *replayRewriter) (int, error) {
+	capture, err := newNcapReader(r)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		cnt     int
+		first   time.Time
+		started time.Time
+	)
+
+	for {
+		rec, err := capture.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return cnt, err
+		}
+
+		if cnt == 0 {
+			first = rec.Time
+			started = time.Now()
+		}
+
+		if speed > 0 {
+			// deadlines are relative to the first message so delays do not accumulate
+			due := started.Add(time.Duration(float64(rec.Time.Sub(first)) / speed))
+			wait := time.Until(due)
+			if wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return cnt, ctx.Err()
+				}
+			}
+		}
+
+		if ctx.Err() != nil {
+			return cnt, ctx.Err()
+		}
+
+		msg := nats.NewMsg(rewriter.rewrite(rec.Subject))
+		msg.Reply = rec.Reply
+		msg.Header = rec.Header
+		msg.Data = rec.Data
+
+		err = nc.PublishMsg(msg)
+		if err != nil {
+			return cnt, err
+		}
+
+		cnt++
+	}
+
+	return cnt, nc.Flush()
+}
@@ -0,0 +1,178 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nats-io/jsm.go"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+func TestNcapRoundTrip(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "capture.ncap")
+	start := time.Unix(0, 1710000000000000000)
+
+	msgs := []*nats.Msg{
+		{Subject: "orders.new", Reply: "_INBOX.1", Header: nats.Header{"Order": []string{"1", "2"}, "X": []string{"y"}}, Data: []byte("one")},
+		{Subject: "orders.cancel", Data: []byte{}},
+	}
+
+	w, err := newNcapWriter(file)
+	assertNoError(t, err)
+	assertNoError(t, w.Write(msgs[0], start))
+	assertNoError(t, w.Close())
+
+	// appending to an existing capture does not repeat the header
+	w, err = newNcapWriter(file)
+	assertNoError(t, err)
+	assertNoError(t, w.Write(msgs[1], start.Add(time.Second)))
+	assertNoError(t, w.Close())
+
+	fh, err := os.Open(file)
+	assertNoError(t, err)
+	defer fh.Close()
+
+	r, err := newNcapReader(fh)
+	assertNoError(t, err)
+
+	for i, msg := range msgs {
+		rec, err := r.Next()
+		assertNoError(t, err)
+
+		if !rec.Time.Equal(start.Add(time.Duration(i) * time.Second)) {
+			t.Fatalf("invalid time %v", rec.Time)
+		}
+		if rec.Subject != msg.Subject || rec.Reply != msg.Reply || !bytes.Equal(rec.Data, msg.Data) {
+			t.Fatalf("invalid record %d: %+v", i, rec)
+		}
+		if len(rec.Header) != len(msg.Header) {
+			t.Fatalf("invalid headers %v", rec.Header)
+		}
+		for k, v := range msg.Header {
+			if len(rec.Header[k]) != len(v) || rec.Header[k][0] != v[0] {
+				t.Fatalf("invalid header %s: %v", k, rec.Header[k])
+			}
+		}
+	}
+
+	_, err = r.Next()
+	if !errors.Is(err, io.EOF) {
+		t.Fatalf("expected EOF got %v", err)
+	}
+
+	data, err := os.ReadFile(file)
+	assertNoError(t, err)
+
+	r, err = newNcapReader(bytes.NewReader(data[:len(data)-2]))
+	assertNoError(t, err)
+	_, err = r.Next()
+	assertNoError(t, err)
+	_, err = r.Next()
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected unexpected EOF got %v", err)
+	}
+
+	// a corrupt length must not be allocated
+	r, err = newNcapReader(bytes.NewReader(binary.AppendUvarint([]byte(ncapMagic), math.MaxUint64)))
+	assertNoError(t, err)
+	_, err = r.Next()
+	if err == nil || err.Error() != "invalid capture record" {
+		t.Fatalf("expected invalid capture record got %v", err)
+	}
+
+	_, err = newNcapReader(bytes.NewReader([]byte("hello world")))
+	if err == nil {
+		t.Fatalf("expected invalid capture error")
+	}
+
+	assertNoError(t, os.WriteFile(file, []byte("hello world"), 0600))
+	_, err = newNcapWriter(file)
+	if err == nil {
+		t.Fatalf("expected invalid capture error")
+	}
+}
+
+func TestReplayRewriter(t *testing.T) {
+	_, err := newReplayRewriter([]string{"orders.>"})
+	if err == nil {
+		t.Fatalf("expected invalid rewrite error")
+	}
+
+	r, err := newReplayRewriter([]string{"orders.*.new=test.new.{{wildcard(1)}}", "orders.>=test.orders.>"})
+	assertNoError(t, err)
+
+	for subject, expected := range map[string]string{
+		"orders.1.new":    "test.new.1",
+		"orders.1.cancel": "test.orders.1.cancel",
+		"other":           "other",
+	} {
+		if got := r.rewrite(subject); got != expected {
+			t.Fatalf("expected %s to rewrite to %s got %s", subject, expected, got)
+		}
+	}
+}
+
+func TestReplayCapture(t *testing.T) {
+	withJetStream(t, func(_ *server.Server, nc *nats.Conn, _ *jsm.Manager) {
+		file := filepath.Join(t.TempDir(), "capture.ncap")
+		start := time.Now()
+
+		w, err := newNcapWriter(file)
+		assertNoError(t, err)
+		for i := 0; i < 3; i++ {
+			msg := &nats.Msg{Subject: "orders.new", Header: nats.Header{"Seq": []string{string(rune('a' + i))}}, Data: []byte("order")}
+			assertNoError(t, w.Write(msg, start.Add(time.Duration(i)*100*time.Millisecond)))
+		}
+		assertNoError(t, w.Close())
+
+		sub, err := nc.SubscribeSync("test.>")
+		assertNoError(t, err)
+
+		rewriter, err := newReplayRewriter([]string{"orders.>=test.orders.>"})
+		assertNoError(t, err)
+
+		fh, err := os.Open(file)
+		assertNoError(t, err)
+		defer fh.Close()
+
+		replayStart := time.Now()
+		cnt, err := replayCapture(context.Background(), nc, fh, 1, rewriter)
+		assertNoError(t, err)
+		if cnt != 3 {
+			t.Fatalf("expected 3 messages got %d", cnt)
+		}
+		if time.Since(replayStart) < 200*time.Millisecond {
+			t.Fatalf("replay did not preserve timing")
+		}
+
+		for i := 0; i < 3; i++ {
+			msg, err := sub.NextMsg(time.Second)
+			assertNoError(t, err)
+			if msg.Subject != "test.orders.new" || msg.Header.Get("Seq") != string(rune('a'+i)) {
+				t.Fatalf("invalid message %d: %s %v", i, msg.Subject, msg.Header)
+			}
+		}
+	})
+}
@@ -29,14 +29,16 @@ import (
 )
 
 type replyCmd struct {
-	subject string
-	body    string
-	queue   string
-	command string
-	echo    bool
-	sleep   time.Duration
-	limit   uint
-	hdrs    []string
+	subject    string
+	body       string
+	queue      string
+	command    string
+	echo       bool
+	sleep      time.Duration
+	limit      uint
+	hdrs       []string
+	rules      string
+	requestLog string
 }
 
 func configureReplyCommand(app commandHost) {
@@ -74,6 +76,39 @@ Available template functions are:
    ID               an unique ID
    Request          the request payload
    Random(min, max) random string at least min long, at most max
+
+Using --rules the requests are handled by the first matching rule in a YAML
+file making it possible to mock services:
+
+  rules:
+    - name: missing order
+      subject: orders.get.0
+      error:
+        code: 404
+        description: order {{2}} not found
+    - name: gold customers
+      subject: orders.get.*
+      headers:
+        X-Tenant: acme
+      body:
+        .customer.tier: gold
+      match: .quantity > 10
+      delay: 100ms
+      response:
+        headers:
+          Content-Type: application/json
+        body: '{"id":"{{2}}","tier":"{{ Field ".customer.tier" }}"}'
+    - name: timeout
+      subject: orders.slow
+      no_response: true
+
+A rule matches when the subject matches, all headers have the given values,
+all body fields have the given values and the match query is true. Body
+fields and match are jq queries evaluated against JSON requests.
+Responses may use the functions above and Subject, Header(name) and
+Field(path) to access the request. Errors set the Nats-Service-Error and
+Nats-Service-Error-Code headers. Requests without a matching rule are not
+answered. Every request can be logged as JSON using --request-log.
 `
 
 	act := app.Command("reply", "Generic service reply utility").Action(c.reply)
@@ -87,6 +122,8 @@ Available template functions are:
 	act.Flag("sleep", "Inject a random sleep delay between replies up to this duration max").PlaceHolder("MAX").DurationVar(&c.sleep)
 	act.Flag("header", "Adds headers to the message").Short('H').StringsVar(&c.hdrs)
 	act.Flag("count", "Quit after receiving this many messages").UintVar(&c.limit)
+	act.Flag("rules", "Responds to requests using rules in a YAML file").PlaceHolder("FILE").ExistingFileVar(&c.rules)
+	act.Flag("request-log", "Logs every request as JSON to a file, - for STDOUT").PlaceHolder("FILE").StringVar(&c.requestLog)
 }
 
 func init() {
@@ -99,6 +136,18 @@ func (c *replyCmd) reply(_ *fisk.ParseContext) error {
 		return err
 	}
 
+	if c.rules != "" {
+		if c.body != "" || c.command != "" || c.echo {
+			return fmt.Errorf("a body, --command or --echo can not be used with --rules")
+		}
+
+		return c.replyWithRules(nc)
+	}
+
+	if c.requestLog != "" {
+		return fmt.Errorf("--request-log requires --rules")
+	}
+
 	if c.body == "" && c.command == "" && !c.echo {
 		log.Println("No body or command supplied, enabling echo mode")
 		c.echo = true
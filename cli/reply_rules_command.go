@@ -0,0 +1,407 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+// replyRules are the rules used by 'nats reply --rules' to mock a service, the first matching rule handles a request
+type replyRules struct {
+	Rules []*replyRule `json:"rules"`
+}
+
+// replyRule matches requests and describes how to respond to them, a rule without conditions matches all requests
+type replyRule struct {
+	Name       string             `json:"name"`
+	Subject    string             `json:"subject"`
+	Headers    map[string]string  `json:"headers"`
+	Body       map[string]any     `json:"body"`
+	Match      string             `json:"match"`
+	Delay      string             `json:"delay"`
+	NoResponse bool               `json:"no_response"`
+	Response   *replyRuleResponse `json:"response"`
+	Error      *replyRuleError    `json:"error"`
+
+	delay  time.Duration
+	match  *jqExpression
+	fields map[string]*jqExpression
+}
+
+// replyRuleResponse is the templated response sent when a rule matches
+type replyRuleResponse struct {
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+// replyRuleError is a service error sent using the Nats-Service-Error headers
+type replyRuleError struct {
+	Code        int    `json:"code"`
+	Description string `json:"description"`
+}
+
+// replyRequestLogEntry is a request handled by the mock service as logged using --request-log
+type replyRequestLogEntry struct {
+	Time    time.Time   `json:"time"`
+	Subject string      `json:"subject"`
+	Header  nats.Header `json:"headers,omitempty"`
+	Data    string      `json:"data"`
+	Rule    string      `json:"rule,omitempty"`
+	Replied bool        `json:"replied"`
+}
+
+// loadReplyRules loads and validates rules from a YAML or JSON file
+func loadReplyRules(file string) (*replyRules, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := &replyRules{}
+	err = yaml.Unmarshal(data, rules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rules file %s: %w", file, err)
+	}
+
+	if len(rules.Rules) == 0 {
+		return nil, fmt.Errorf("no rules found in %s", file)
+	}
+
+	for i, rule := range rules.Rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule %d", i+1)
+		}
+
+		err = rule.prepare()
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule %q: %w", rule.Name, err)
+		}
+	}
+
+	return rules, nil
+}
+
+func (r *replyRule) prepare() error {
+	var err error
+
+	if r.Subject != "" && !server.IsValidSubject(r.Subject) {
+		return fmt.Errorf("invalid subject %q", r.Subject)
+	}
+
+	r.delay, err = parseDurationString(r.Delay)
+	if err != nil {
+		return fmt.Errorf("invalid delay %q: %w", r.Delay, err)
+	}
+
+	if r.Match != "" {
+		r.match, err = newJQExpression(r.Match, true)
+		if err != nil {
+			return err
+		}
+	}
+
+	r.fields = map[string]*jqExpression{}
+	for path := range r.Body {
+		r.fields[path], err = newJQExpression(path, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	if r.Error != nil && r.Error.Description == "" {
+		return fmt.Errorf("errors require a description")
+	}
+
+	if r.NoResponse && (r.Response != nil || r.Error != nil) {
+		return fmt.Errorf("no_response can not be combined with a response or error")
+	}
+
+	return nil
+}
+
+// find finds the first rule matching msg
+func (r *replyRules) find(msg *nats.Msg) *replyRule {
+	for _, rule := range r.Rules {
+		if rule.matches(msg) {
+			return rule
+		}
+	}
+
+	return nil
+}
+
+func (r *replyRule) matches(msg *nats.Msg) bool {
+	if r.Subject != "" && !server.SubjectsCollide(msg.Subject, r.Subject) {
+		return false
+	}
+
+	for k, v := range r.Headers {
+		if msg.Header.Get(k) != v {
+			return false
+		}
+	}
+
+	for path, expr := range r.fields {
+		val, err := expr.Evaluate(msg.Data)
+		if err != nil || !reflect.DeepEqual(val, r.Body[path]) {
+			return false
+		}
+	}
+
+	if r.match != nil && !r.match.Matches(msg.Data) {
+		return false
+	}
+
+	return true
+}
+
+// templateFuncs are template functions giving responses access to the request
+func (r *replyRule) templateFuncs(msg *nats.Msg) template.FuncMap {
+	return template.FuncMap{
+		"Subject": func() string { return msg.Subject },
+		"Header":  func(name string) string { return msg.Header.Get(name) },
+		"Field": func(path string) (string, error) {
+			expr, err := newJQExpression(path, false)
+			if err != nil {
+				return "", err
+			}
+
+			val, err := expr.Evaluate(msg.Data)
+			if err != nil {
+				return "", err
+			}
+
+			switch val := val.(type) {
+			case nil:
+				return "", nil
+			case string:
+				return val, nil
+			default:
+				j, err := json.Marshal(val)
+				return string(j), err
+			}
+		},
+	}
+}
+
+// render renders a response template, {{N}} is replaced by subject token N like in --command
+func (r *replyRule) render(tmpl string, msg *nats.Msg, ctr int) ([]byte, error) {
+	for i, t := range strings.Split(msg.Subject, ".") {
+		tmpl = strings.ReplaceAll(tmpl, fmt.Sprintf("{{%d}}", i), t)
+	}
+
+	return pubReplyBodyTemplateWithFuncs(tmpl, string(msg.Data), ctr, r.templateFuncs(msg))
+}
+
+// response creates the reply to msg, nil when the rule does not respond
+func (r *replyRule) response(msg *nats.Msg, ctr int) (*nats.Msg, error) {
+	if r.NoResponse {
+		return nil, nil
+	}
+
+	reply := nats.NewMsg(msg.Reply)
+
+	if r.Response != nil {
+		for k, v := range r.Response.Headers {
+			val, err := r.render(v, msg, ctr)
+			if err != nil {
+				return nil, fmt.Errorf("header %s: %w", k, err)
+			}
+			reply.Header.Set(k, string(val))
+		}
+
+		body, err := r.render(r.Response.Body, msg, ctr)
+		if err != nil {
+			return nil, fmt.Errorf("body: %w", err)
+		}
+		reply.Data = body
+	}
+
+	if r.Error != nil {
+		desc, err := r.render(r.Error.Description, msg, ctr)
+		if err != nil {
+			return nil, fmt.Errorf("error: %w", err)
+		}
+
+		reply.Header.Set("Nats-Service-Error", string(desc))
+		if r.Error.Code > 0 {
+			reply.Header.Set("Nats-Service-Error-Code", strconv.Itoa(r.Error.Code))
+		}
+	}
+
+	return reply, nil
+}
+
+func (c *replyCmd) replyWithRules(nc *nats.Conn) error {
+	rules, err := loadReplyRules(c.rules)
+	if err != nil {
+		return err
+	}
+
+	var requestLog io.Writer
+	switch c.requestLog {
+	case "":
+	case "-":
+		requestLog = os.Stdout
+	default:
+		file, err := os.Create(c.requestLog)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		requestLog = file
+	}
+
+	ctx, cancel := signal.NotifyContext(ctx, syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		ctr     int
+		stopped bool
+		limit   = make(chan struct{})
+	)
+
+	logRequest := func(m *nats.Msg, rule *replyRule, replied bool) {
+		if requestLog == nil {
+			return
+		}
+
+		entry := &replyRequestLogEntry{Time: time.Now().UTC(), Subject: m.Subject, Header: m.Header, Data: string(m.Data), Replied: replied}
+		if rule != nil {
+			entry.Rule = rule.Name
+		}
+
+		j, err := json.Marshal(entry)
+		if err != nil {
+			log.Printf("Could not log request: %s", err)
+			return
+		}
+
+		mu.Lock()
+		fmt.Fprintln(requestLog, string(j))
+		mu.Unlock()
+	}
+
+	handle := func(m *nats.Msg, rule *replyRule, seq int) {
+		defer wg.Done()
+
+		if rule.delay > 0 {
+			select {
+			case <-time.After(rule.delay):
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		reply, err := rule.response(m, seq)
+		if err != nil {
+			log.Printf("[#%d] Could not render the response of rule %q: %s", seq, rule.Name, err)
+			logRequest(m, rule, false)
+			return
+		}
+
+		if reply == nil || m.Reply == "" {
+			logRequest(m, rule, false)
+			return
+		}
+
+		err = parseStringsToMsgHeader(c.hdrs, seq, reply)
+		if err != nil {
+			log.Printf("[#%d] Could not add headers: %s", seq, err)
+		}
+
+		err = m.RespondMsg(reply)
+		if err != nil {
+			log.Printf("[#%d] Could not publish reply: %s", seq, err)
+		}
+		logRequest(m, rule, err == nil)
+	}
+
+	sub, err := nc.QueueSubscribe(c.subject, c.queue, func(m *nats.Msg) {
+		// requests arriving while shutting down are ignored so none are added while waiting for handlers
+		mu.Lock()
+		if stopped {
+			mu.Unlock()
+			return
+		}
+		seq := ctr
+		ctr++
+		wg.Add(1)
+		mu.Unlock()
+
+		rule := rules.find(m)
+		if rule == nil {
+			log.Printf("[#%d] Received on subject %q, no rule matched", seq, m.Subject)
+			logRequest(m, nil, false)
+			wg.Done()
+		} else {
+			log.Printf("[#%d] Received on subject %q, matched rule %q", seq, m.Subject, rule.Name)
+			go handle(m, rule, seq)
+		}
+
+		if c.limit != 0 && uint(seq+1) == c.limit {
+			close(limit)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if c.limit != 0 {
+		sub.AutoUnsubscribe(int(c.limit))
+	}
+
+	err = nc.Flush()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Listening on %q in group %q using %d rules from %s", c.subject, c.queue, len(rules.Rules), c.rules)
+
+	// outstanding responses are still sent when the limit is reached but not when interrupted
+	select {
+	case <-ctx.Done():
+	case <-limit:
+	}
+
+	mu.Lock()
+	stopped = true
+	mu.Unlock()
+
+	err = sub.Unsubscribe()
+	if err != nil && !errors.Is(err, nats.ErrBadSubscription) {
+		return err
+	}
+
+	wg.Wait()
+
+	return nc.Flush()
+}
@@ -0,0 +1,129 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestReplyRules(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "mock.yaml")
+	err := os.WriteFile(file, []byte(`
+rules:
+  - name: missing
+    subject: orders.get.0
+    error:
+      code: 404
+      description: order {{2}} not found
+  - name: gold
+    subject: orders.get.*
+    headers:
+      X-Tenant: acme
+    body:
+      .customer.tier: gold
+      .quantity: 20
+    match: .express == true
+    delay: 100ms
+    response:
+      headers:
+        X-Order: "{{2}}"
+      body: '{"id":"{{2}}","tier":"{{ Field ".customer.tier" }}","tenant":"{{ Header "X-Tenant" }}","subject":"{{ Subject }}"}'
+  - subject: orders.slow
+    no_response: true
+`), 0600)
+	assertNoError(t, err)
+
+	rules, err := loadReplyRules(file)
+	assertNoError(t, err)
+	if len(rules.Rules) != 3 || rules.Rules[2].Name != "rule 3" || rules.Rules[1].delay != 100*time.Millisecond {
+		t.Fatalf("invalid rules: %+v", rules.Rules)
+	}
+
+	msg := nats.NewMsg("orders.get.0")
+	msg.Reply = "reply"
+	rule := rules.find(msg)
+	if rule == nil || rule.Name != "missing" {
+		t.Fatalf("expected missing rule got %+v", rule)
+	}
+	reply, err := rule.response(msg, 1)
+	assertNoError(t, err)
+	if reply.Subject != "reply" || reply.Header.Get("Nats-Service-Error") != "order 0 not found" || reply.Header.Get("Nats-Service-Error-Code") != "404" {
+		t.Fatalf("invalid error reply: %+v", reply)
+	}
+
+	msg = nats.NewMsg("orders.get.7")
+	msg.Header.Set("X-Tenant", "acme")
+	msg.Data = []byte(`{"customer":{"tier":"gold"},"quantity":20,"express":true}`)
+	rule = rules.find(msg)
+	if rule == nil || rule.Name != "gold" {
+		t.Fatalf("expected gold rule got %+v", rule)
+	}
+	reply, err = rule.response(msg, 1)
+	assertNoError(t, err)
+	if reply.Header.Get("X-Order") != "7" || string(reply.Data) != `{"id":"7","tier":"gold","tenant":"acme","subject":"orders.get.7"}` {
+		t.Fatalf("invalid reply: %v %s", reply.Header, reply.Data)
+	}
+
+	for _, data := range []string{
+		`{"customer":{"tier":"silver"},"quantity":20,"express":true}`,
+		`{"customer":{"tier":"gold"},"quantity":2,"express":true}`,
+		`{"customer":{"tier":"gold"},"quantity":20}`,
+		`not json`,
+	} {
+		msg.Data = []byte(data)
+		if rule := rules.find(msg); rule != nil {
+			t.Fatalf("expected no match for %s got %s", data, rule.Name)
+		}
+	}
+
+	msg.Header.Set("X-Tenant", "other")
+	msg.Data = []byte(`{"customer":{"tier":"gold"},"quantity":20,"express":true}`)
+	if rule := rules.find(msg); rule != nil {
+		t.Fatalf("expected no match for other tenant got %s", rule.Name)
+	}
+
+	rule = rules.find(nats.NewMsg("orders.slow"))
+	if rule == nil || !rule.NoResponse {
+		t.Fatalf("expected no response rule got %+v", rule)
+	}
+	reply, err = rule.response(nats.NewMsg("orders.slow"), 1)
+	assertNoError(t, err)
+	if reply != nil {
+		t.Fatalf("expected no reply")
+	}
+}
+
+func TestReplyRulesInvalid(t *testing.T) {
+	for _, rules := range []string{
+		`rules: []`,
+		`rules: [{subject: "orders..x"}]`,
+		`rules: [{delay: soon}]`,
+		`rules: [{match: ".a +"}]`,
+		`rules: [{error: {code: 500}}]`,
+		`rules: [{no_response: true, response: {body: x}}]`,
+	} {
+		file := filepath.Join(t.TempDir(), "mock.yaml")
+		assertNoError(t, os.WriteFile(file, []byte(rules), 0600))
+
+		_, err := loadReplyRules(file)
+		if err == nil {
+			t.Fatalf("expected %s to be invalid", rules)
+		}
+	}
+}
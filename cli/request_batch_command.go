@@ -0,0 +1,234 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gosuri/uiprogress"
+	"github.com/nats-io/nats.go"
+)
+
+// requestBatchResult summarises the replies to a batch of requests
+type requestBatchResult struct {
+	Requests      int            `json:"requests"`
+	Replies       int            `json:"replies"`
+	ServiceErrors int            `json:"service_errors"`
+	Failed        int            `json:"failed"`
+	Failures      map[string]int `json:"failures,omitempty"`
+	Duration      time.Duration  `json:"duration"`
+	Rate          float64        `json:"rate"`
+	Latency       *latencyStats  `json:"latency,omitempty"`
+}
+
+// loadRequestBatch reads requests from a file, one per line, in the format used by 'nats pub --file'
+func (c *pubCmd) loadRequestBatch() ([]*nats.Msg, error) {
+	if c.subject == "" && !c.fileEnvelope {
+		return nil, fmt.Errorf("subject is required unless sending a batch with --envelope")
+	}
+
+	fh, err := os.Open(c.batch)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	var msgs []*nats.Msg
+	var lineNo int
+
+	scanner := bufio.NewScanner(fh)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		lineNo++
+
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+
+		msg, err := parsePubFileLine(line, c.fileEnvelope, c.subject)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		msg.Reply = ""
+
+		err = parseStringsToMsgHeader(c.hdrs, len(msgs)+1, msg)
+		if err != nil {
+			return nil, err
+		}
+
+		msgs = append(msgs, msg)
+	}
+
+	return msgs, scanner.Err()
+}
+
+// sendRequestBatch sends msgs as requests using concurrency parallel requesters, each waiting up to timeout for the first reply
+func sendRequestBatch(ctx context.Context, nc *nats.Conn, msgs []*nats.Msg, concurrency int, timeout time.Duration, progress *uiprogress.Bar) *requestBatchResult {
+	res := &requestBatchResult{Failures: map[string]int{}}
+
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		latencies []time.Duration
+		work      = make(chan *nats.Msg)
+	)
+
+	start := time.Now()
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for msg := range work {
+				sent := time.Now()
+				reply, err := nc.RequestMsg(msg, timeout)
+				latency := time.Since(sent)
+
+				mu.Lock()
+				res.Requests++
+				if err != nil {
+					res.Failed++
+					res.Failures[err.Error()]++
+				} else {
+					res.Replies++
+					latencies = append(latencies, latency)
+					if reply.Header.Get("Nats-Service-Error") != "" {
+						res.ServiceErrors++
+					}
+				}
+				mu.Unlock()
+
+				if progress != nil {
+					progress.Incr()
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, msg := range msgs {
+		select {
+		case work <- msg:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	res.Duration = time.Since(start)
+	if res.Duration > 0 {
+		res.Rate = float64(res.Requests) / res.Duration.Seconds()
+	}
+	if len(latencies) > 0 {
+		res.Latency, _ = calculateLatencyStats(latencies)
+	}
+
+	return res
+}
+
+func (c *pubCmd) sendBatch(nc *nats.Conn) error {
+	if c.concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1")
+	}
+
+	msgs, err := c.loadRequestBatch()
+	if err != nil {
+		return err
+	}
+	if len(msgs) == 0 {
+		return fmt.Errorf("no requests found in %s", c.batch)
+	}
+
+	ctx, cancel := signal.NotifyContext(ctx, syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	var progress *uiprogress.Bar
+	if !c.json && len(msgs) > 20 {
+		progressFormat := fmt.Sprintf("%%%dd / %%d", len(fmt.Sprintf("%d", len(msgs))))
+		progress = uiprogress.AddBar(len(msgs)).PrependFunc(func(b *uiprogress.Bar) string {
+			return fmt.Sprintf(progressFormat, b.Current(), len(msgs))
+		}).AppendElapsed()
+		progress.Width = progressWidth()
+
+		fmt.Println()
+		uiprogress.Start()
+		uiprogress.RefreshInterval = 100 * time.Millisecond
+	}
+
+	res := sendRequestBatch(ctx, nc, msgs, c.concurrency, opts.Timeout, progress)
+
+	if progress != nil {
+		uiprogress.Stop()
+		fmt.Println()
+	}
+
+	if c.json {
+		err = printJSON(res)
+		if err != nil {
+			return err
+		}
+	} else {
+		c.showRequestBatch(res)
+	}
+
+	if res.Failed > 0 {
+		os.Exit(1)
+	}
+
+	return nil
+}
+
+func (c *pubCmd) showRequestBatch(res *requestBatchResult) {
+	cols := newColumns("Sent %s requests from %s with concurrency %d", f(res.Requests), c.batch, c.concurrency)
+	cols.AddRow("Replies", res.Replies)
+	cols.AddRow("Service Errors", res.ServiceErrors)
+	cols.AddRow("Failed", res.Failed)
+	cols.AddRow("Duration", res.Duration.Round(time.Millisecond))
+	cols.AddRowf("Request Rate", "%s / s", f(res.Rate))
+
+	if res.Latency != nil {
+		cols.AddSectionTitle("Latency")
+		cols.AddRow("Minimum", res.Latency.Min)
+		cols.AddRow("Average", res.Latency.Avg)
+		cols.AddRow("50th Percentile", res.Latency.P50)
+		cols.AddRow("90th Percentile", res.Latency.P90)
+		cols.AddRow("99th Percentile", res.Latency.P99)
+		cols.AddRow("Maximum", res.Latency.Max)
+	}
+
+	if len(res.Failures) > 0 {
+		reasons := mapKeys(res.Failures)
+		sort.Slice(reasons, func(i, j int) bool { return res.Failures[reasons[i]] > res.Failures[reasons[j]] })
+
+		cols.AddSectionTitle("Failures")
+		for _, reason := range reasons {
+			cols.AddRow(reason, res.Failures[reason])
+		}
+	}
+
+	cols.Println()
+	cols.Frender(os.Stdout)
+}
@@ -0,0 +1,209 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/nats-io/nats.go"
+)
+
+// gatheredReply is a single reply received while gathering replies to a request
+type gatheredReply struct {
+	Responder string        `json:"responder,omitempty"`
+	Latency   time.Duration `json:"latency"`
+	Header    nats.Header   `json:"headers,omitempty"`
+	Data      any           `json:"data"`
+
+	size int
+	body []byte
+}
+
+// gatherReplies sends msg and gathers replies until max replies were received, no reply was received for quiet or the deadline passed
+func gatherReplies(nc *nats.Conn, msg *nats.Msg, max int, quiet time.Duration, deadline time.Duration) ([]*nats.Msg, []time.Duration, error) {
+	msg.Reply = nc.NewRespInbox()
+
+	sub, err := nc.SubscribeSync(msg.Reply)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer sub.Unsubscribe()
+
+	start := time.Now()
+	err = nc.PublishMsg(msg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		replies   []*nats.Msg
+		latencies []time.Duration
+	)
+
+	for max == 0 || len(replies) < max {
+		timeout := deadline - time.Since(start)
+		if quiet > 0 && len(replies) > 0 && quiet < timeout {
+			timeout = quiet
+		}
+		if timeout <= 0 {
+			break
+		}
+
+		m, err := sub.NextMsg(timeout)
+		if errors.Is(err, nats.ErrTimeout) {
+			break
+		}
+		if errors.Is(err, nats.ErrNoResponders) {
+			return nil, nil, err
+		}
+		if err != nil {
+			return replies, latencies, err
+		}
+
+		replies = append(replies, m)
+		latencies = append(latencies, time.Since(start))
+	}
+
+	return replies, latencies, nil
+}
+
+func (c *pubCmd) sendGather(nc *nats.Conn) error {
+	var expr *jqExpression
+	if c.jq != "" {
+		var err error
+		expr, err = newJQExpression(c.jq, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	max := c.replyCount
+	if !c.replyCountIsSet {
+		max = 0
+	}
+
+	body, err := pubReplyBodyTemplate(c.body, "", 1)
+	if err != nil {
+		return fmt.Errorf("could not parse body template: %w", err)
+	}
+
+	msg, err := c.prepareMsg(body, 1)
+	if err != nil {
+		return err
+	}
+
+	if !c.json && expr == nil {
+		log.Printf("Gathering replies to request on %q", c.subject)
+	}
+
+	msgs, latencies, err := gatherReplies(nc, msg, max, c.quiet, opts.Timeout)
+	if err != nil {
+		return err
+	}
+
+	replies := make([]*gatheredReply, len(msgs))
+	for i, m := range msgs {
+		replies[i] = c.gatheredReply(m, latencies[i])
+	}
+
+	switch {
+	case expr != nil:
+		docs := make([]any, len(replies))
+		for i, r := range replies {
+			docs[i] = r.Data
+		}
+
+		j, err := json.Marshal(docs)
+		if err != nil {
+			return err
+		}
+
+		res, err := expr.Evaluate(j)
+		if err != nil {
+			return err
+		}
+
+		return printJSON(res)
+
+	case c.json:
+		if replies == nil {
+			replies = []*gatheredReply{}
+		}
+		return printJSON(replies)
+
+	default:
+		c.showGatheredReplies(replies)
+	}
+
+	return nil
+}
+
+func (c *pubCmd) gatheredReply(m *nats.Msg, latency time.Duration) *gatheredReply {
+	body := decodeMsgBody(c.decoder, m.Header, m.Data)
+
+	r := &gatheredReply{
+		Latency: latency,
+		Header:  m.Header,
+		size:    len(m.Data),
+		body:    body,
+	}
+
+	if c.responderHeader != "" {
+		r.Responder = m.Header.Get(c.responderHeader)
+	}
+
+	if json.Valid(body) {
+		r.Data = json.RawMessage(body)
+	} else {
+		r.Data = string(body)
+	}
+
+	return r
+}
+
+func (c *pubCmd) showGatheredReplies(replies []*gatheredReply) {
+	if len(replies) == 0 {
+		log.Printf("No replies received within %v", opts.Timeout)
+		return
+	}
+
+	table := newTableWriter("%s replies to request on %s", f(len(replies)), c.subject)
+
+	hdrs := []any{"#", "Latency", "Size", "Error", "Body"}
+	if c.responderHeader != "" {
+		hdrs = append([]any{"#", "Responder"}, hdrs[1:]...)
+	}
+	table.AddHeaders(hdrs...)
+
+	for i, r := range replies {
+		body := strings.TrimSpace(base64IfNotPrintable(r.body))
+		body = strings.ReplaceAll(body, "\n", " ")
+		if len(body) > 60 {
+			body = body[:57] + "..."
+		}
+
+		row := []any{i + 1, r.Latency.Round(time.Microsecond), humanize.IBytes(uint64(r.size)), r.Header.Get("Nats-Service-Error"), body}
+		if c.responderHeader != "" {
+			row = append([]any{i + 1, r.Responder}, row[1:]...)
+		}
+		table.AddRow(row...)
+	}
+
+	fmt.Println(table.Render())
+}
@@ -0,0 +1,113 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/jsm.go"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+func TestGatherReplies(t *testing.T) {
+	withJetStream(t, func(_ *server.Server, nc *nats.Conn, _ *jsm.Manager) {
+		for i := 1; i <= 3; i++ {
+			delay := time.Duration(i-1) * 50 * time.Millisecond
+			body := []byte(fmt.Sprintf(`{"load":%d}`, i))
+			_, err := nc.Subscribe("svc.status", func(m *nats.Msg) {
+				time.Sleep(delay)
+				m.Respond(body)
+			})
+			assertNoError(t, err)
+		}
+		assertNoError(t, nc.Flush())
+
+		replies, latencies, err := gatherReplies(nc, nats.NewMsg("svc.status"), 0, 0, 500*time.Millisecond)
+		assertNoError(t, err)
+		if len(replies) != 3 || len(latencies) != 3 {
+			t.Fatalf("expected 3 replies got %d", len(replies))
+		}
+		if latencies[2] < 100*time.Millisecond {
+			t.Fatalf("unexpected latency %v", latencies[2])
+		}
+
+		replies, _, err = gatherReplies(nc, nats.NewMsg("svc.status"), 2, 0, time.Second)
+		assertNoError(t, err)
+		if len(replies) != 2 {
+			t.Fatalf("expected 2 replies got %d", len(replies))
+		}
+
+		start := time.Now()
+		replies, _, err = gatherReplies(nc, nats.NewMsg("svc.status"), 0, 20*time.Millisecond, time.Second)
+		assertNoError(t, err)
+		if len(replies) != 1 || time.Since(start) > 500*time.Millisecond {
+			t.Fatalf("expected the quiet period to end gathering after 1 reply, got %d after %v", len(replies), time.Since(start))
+		}
+
+		_, _, err = gatherReplies(nc, nats.NewMsg("nothing"), 0, 0, time.Second)
+		if !errors.Is(err, nats.ErrNoResponders) {
+			t.Fatalf("expected no responders got %v", err)
+		}
+	})
+}
+
+func TestSendRequestBatch(t *testing.T) {
+	withJetStream(t, func(_ *server.Server, nc *nats.Conn, _ *jsm.Manager) {
+		_, err := nc.QueueSubscribe("svc.echo", "q", func(m *nats.Msg) {
+			if string(m.Data) == "fail" {
+				reply := nats.NewMsg(m.Reply)
+				reply.Header.Set("Nats-Service-Error", "failed")
+				m.RespondMsg(reply)
+				return
+			}
+			m.Respond(m.Data)
+		})
+		assertNoError(t, err)
+		assertNoError(t, nc.Flush())
+
+		var msgs []*nats.Msg
+		for i := 0; i < 50; i++ {
+			msg := nats.NewMsg("svc.echo")
+			msg.Data = []byte("hello")
+			if i%10 == 0 {
+				msg.Data = []byte("fail")
+			}
+			msgs = append(msgs, msg)
+		}
+		msgs = append(msgs, nats.NewMsg("nothing"))
+
+		res := sendRequestBatch(context.Background(), nc, msgs, 5, time.Second, nil)
+		if res.Requests != 51 || res.Replies != 50 || res.ServiceErrors != 5 || res.Failed != 1 {
+			t.Fatalf("invalid result: %+v", res)
+		}
+		if res.Failures[nats.ErrNoResponders.Error()] != 1 {
+			t.Fatalf("invalid failures: %v", res.Failures)
+		}
+		if res.Latency == nil || res.Latency.P50 > res.Latency.P99 || res.Latency.Min > res.Latency.Max {
+			t.Fatalf("invalid latency: %+v", res.Latency)
+		}
+
+		cmd := &pubCmd{batch: "requests.txt"}
+		_, err = cmd.loadRequestBatch()
+		if err == nil || !strings.Contains(err.Error(), "subject is required") {
+			t.Fatalf("expected a subject error got %v", err)
+		}
+	})
+}
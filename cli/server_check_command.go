@@ -50,6 +50,8 @@ type SrvCheckCmd struct {
 	sourcesMessagesCrit uint64
 	subjectsWarn        int
 	subjectsCrit        int
+	streamLint          bool
+	streamLintSuppress  []string
 
 	consumerName                   string
 	consumerAckOutstandingCritical int
@@ -137,6 +139,8 @@ func configureServerCheckCommand(srv *fisk.CmdClause) {
 	stream.Flag("msgs-critical", "Critical if there are fewer than this many messages in the stream").PlaceHolder("MSGS").Uint64Var(&c.sourcesMessagesCrit)
 	stream.Flag("subjects-warn", "Critical threshold for subjects in the stream").PlaceHolder("SUBJECTS").Default("-1").IntVar(&c.subjectsWarn)
 	stream.Flag("subjects-critical", "Warning threshold for subjects in the stream").PlaceHolder("SUBJECTS").Default("-1").IntVar(&c.subjectsCrit)
+	stream.Flag("lint", "Checks the stream configuration against best practices").UnNegatableBoolVar(&c.streamLint)
+	stream.Flag("lint-suppress", "Lint rule IDs to suppress (pass multiple times)").PlaceHolder("ID").StringsVar(&c.streamLintSuppress)
 
 	consumer := check.Command("consumer", "Checks the health of a consumer").Action(c.checkConsumer)
 	consumer.Flag("stream", "The streams to check").Required().StringVar(&c.sourcesStream)
@@ -881,6 +885,20 @@ func (c *SrvCheckCmd) checkStream(_ *fisk.ParseContext) error {
 		}
 	}
 
+	if c.streamLint {
+		target, err := newStreamLintTarget(stream)
+		check.CriticalIfErr(err, "could not load stream %s consumers: %s", c.sourcesStream, err)
+
+		for _, finding := range lintStream(target, c.streamLintSuppress) {
+			switch finding.Severity {
+			case lintSeverityCritical:
+				check.Critical("%s: %s", finding.Rule, finding.Message)
+			case lintSeverityWarning:
+				check.Warn("%s: %s", finding.Rule, finding.Message)
+			}
+		}
+	}
+
 	switch {
 	case stream.IsMirror():
 		err = c.checkMirror(check, info)
@@ -14,6 +14,7 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strconv"
@@ -66,7 +67,13 @@ func withJetStream(t *testing.T, cb func(srv *server.Server, nc *nats.Conn, mgr
 		srv.WaitForShutdown()
 	}()
 
+	ctx = context.Background()
+	if opts.Timeout == 0 {
+		opts.Timeout = 5 * time.Second
+	}
 	opts.Conn = nil
+	opts.Mgr = nil
+	opts.JSc = nil
 	nc, mgr, err := prepareHelper(srv.ClientURL())
 	checkErr(t, err, "could not connect client to server @ %s: %v", srv.ClientURL(), err)
 	defer nc.Close()
@@ -35,10 +35,10 @@ import (
 	"github.com/choria-io/fisk"
 	"github.com/dustin/go-humanize"
 	"github.com/emicklei/dot"
-	"github.com/google/go-cmp/cmp"
 	"github.com/gosuri/uiprogress"
 	"github.com/nats-io/jsm.go"
 	"github.com/nats-io/jsm.go/api"
+	"github.com/nats-io/nats-server/v2/server"
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/natscli/columns"
 	"gopkg.in/yaml.v3"
@@ -80,6 +80,9 @@ type streamCmd struct {
 	discardPolicy          string
 	validateOnly           bool
 	backupDirectory        string
+	restoreSubjects        []string
+	restoreSeqRange        string
+	restoreTarget          string
 	showProgress           bool
 	healthCheck            bool
 	snapShotConsumers      bool
@@ -144,6 +147,8 @@ type streamCmd struct {
 	vwPageSize   int
 	vwRaw        bool
 	vwTranslate  string
+	vwDecode     string
+	vwDecoder    msgDecoder
 	vwSubject    string
 
 	dryRun         bool
@@ -234,7 +239,7 @@ func configureStreamCommand(app commandHost) {
 	strAdd := str.Command("add", "Create a new Stream").Alias("create").Alias("new").Action(c.addAction)
 	strAdd.Arg("stream", "Stream name").StringVar(&c.stream)
 	strAdd.Flag("config", "JSON file to read configuration from").ExistingFileVar(&c.inputFile)
-	strAdd.Flag("validate", "Only validates the configuration against the official Schema").UnNegatableBoolVar(&c.validateOnly)
+	strAdd.Flag("validate", "Only validates the configuration against the official Schema and best practices").UnNegatableBoolVar(&c.validateOnly)
 	strAdd.Flag("output", "Save configuration instead of creating").PlaceHolder("FILE").StringVar(&c.outFile)
 	addCreateFlags(strAdd, false)
 	strAdd.Flag("defaults", "Accept default values for all prompts").UnNegatableBoolVar(&c.acceptDefaults)
@@ -356,6 +361,7 @@ Finding streams with certain subjects configured:
 	strView.Flag("since", "Delivers messages received since a duration like 1d3h5m2s").DurationVar(&c.vwStartDelta)
 	strView.Flag("raw", "Show the raw data received").UnNegatableBoolVar(&c.vwRaw)
 	strView.Flag("translate", "Translate the message data by running it through the given command before output").StringVar(&c.vwTranslate)
+	strView.Flag("decode", msgDecoderHelp).PlaceHolder("DECODER").StringVar(&c.vwDecode)
 	strView.Flag("subject", "Filter the stream using a subject").StringVar(&c.vwSubject)
 
 	strGet := str.Command("get", "Retrieves a specific message from a Stream").Action(c.getAction)
@@ -364,8 +370,11 @@ Finding streams with certain subjects configured:
 	strGet.Flag("last-for", "Retrieves the message for a specific subject").Short('S').PlaceHolder("SUBJECT").StringVar(&c.filterSubject)
 	strGet.Flag("json", "Produce JSON output").Short('j').UnNegatableBoolVar(&c.json)
 	strGet.Flag("translate", "Translate the message data by running it through the given command before output").StringVar(&c.vwTranslate)
+	strGet.Flag("decode", msgDecoderHelp).PlaceHolder("DECODER").StringVar(&c.vwDecode)
 
-	strBackup := str.Command("backup", "Creates a backup of a Stream over the NATS network").Alias("snapshot").Action(c.backupAction)
+	strBackupGroup := str.Command("backup", "Creates and inspects backups of Streams").Alias("snapshot")
+
+	strBackup := strBackupGroup.Command("create", "Creates a backup of a Stream over the NATS network").Default().Action(c.backupAction)
 	strBackup.Arg("stream", "Stream to backup").Required().StringVar(&c.stream)
 	strBackup.Arg("target", "Directory to create the backup in").Required().StringVar(&c.backupDirectory)
 	strBackup.Flag("progress", "Enables or disables progress reporting using a progress bar").Default("true").BoolVar(&c.showProgress)
@@ -373,13 +382,40 @@ Finding streams with certain subjects configured:
 	strBackup.Flag("consumers", "Enable or disable consumer backups").Default("true").BoolVar(&c.snapShotConsumers)
 	strBackup.Flag("chunk-size", "Sets a specific chunk size that the server will send").PlaceHolder("BYTES").Default("128KB").StringVar(&c.chunkSize)
 
+	strBackupInspect := strBackupGroup.Command("inspect", "Inspects a Stream backup without a NATS Server").Action(c.backupInspectAction)
+	strBackupInspect.HelpLong(`Shows the Stream and Consumer state held in a backup.
+
+The backup is restored into a temporary server that does not listen on the
+network, this reads the entire backup and needs free space in the temporary
+directory about the size of the Stream that was backed up.
+`)
+	strBackupInspect.Arg("file", "The directory holding the backup to inspect").Required().ExistingDirVar(&c.backupDirectory)
+	strBackupInspect.Flag("json", "Produce JSON output").Short('j').UnNegatableBoolVar(&c.json)
+
 	strRestore := str.Command("restore", "Restore a Stream over the NATS network").Action(c.restoreAction)
+	strRestore.HelpLong(`Restores a Stream from a backup made using 'nats stream backup'.
+
+When --subject or --seq-range are given only the matching messages are
+republished into an existing Stream. To do this the entire backup is first
+restored into a temporary server that does not listen on the network, this
+needs free space in the temporary directory about the size of the Stream that
+was backed up.
+`)
 	strRestore.Arg("file", "The directory holding the backup to restore").Required().ExistingDirVar(&c.backupDirectory)
 	strRestore.Flag("progress", "Enables or disables progress reporting using a progress bar").Default("true").BoolVar(&c.showProgress)
 	strRestore.Flag("config", "Load a different configuration when restoring the stream").ExistingFileVar(&c.inputFile)
 	strRestore.Flag("cluster", "Place the stream in a specific cluster").StringVar(&c.placementCluster)
 	strRestore.Flag("tag", "Place the stream on servers that has specific tags (pass multiple times)").StringsVar(&c.placementTags)
 	strRestore.Flag("replicas", "Override how many replicas of the data to create").Int64Var(&c.replicas)
+	strRestore.Flag("subject", "Republish only messages matching a subject into an existing Stream (pass multiple times)").PlaceHolder("SUBJECT").StringsVar(&c.restoreSubjects)
+	strRestore.Flag("seq-range", "Republish only messages in a sequence range like 100-200 into an existing Stream").PlaceHolder("RANGE").StringVar(&c.restoreSeqRange)
+	strRestore.Flag("stream", "The existing Stream to republish into when doing a partial restore").PlaceHolder("STREAM").StringVar(&c.restoreTarget)
+
+	configureStreamExportCommand(str)
+	configureStreamReplicationCommand(str)
+	configureStreamLintCommand(str)
+	configureStreamSearchCommand(str)
+	configureStreamCompareCommand(str)
 
 	strSeal := str.Command("seal", "Seals a stream preventing further updates").Action(c.sealAction)
 	strSeal.Arg("stream", "The name of the Stream to seal").Required().StringVar(&c.stream)
@@ -800,6 +836,12 @@ func (c *streamCmd) viewAction(_ *fisk.ParseContext) error {
 		return fmt.Errorf("interactive stream paging requires a valid terminal")
 	}
 
+	var err error
+	c.vwDecoder, err = newMsgDecoder(c.vwDecode)
+	if err != nil {
+		return err
+	}
+
 	if c.vwPageSize > 25 {
 		c.vwPageSize = 25
 	}
@@ -861,7 +903,7 @@ func (c *streamCmd) viewAction(_ *fisk.ParseContext) error {
 		case msg == nil:
 			shouldTerminate = true
 		case c.vwRaw:
-			fmt.Println(string(msg.Data))
+			fmt.Println(string(decodeMsgBody(c.vwDecoder, msg.Header, msg.Data)))
 		default:
 			meta, err := jsm.ParseJSMsgMetadata(msg)
 			if err == nil {
@@ -884,7 +926,7 @@ func (c *streamCmd) viewAction(_ *fisk.ParseContext) error {
 			}
 
 			fmt.Println()
-			outPutMSGBody(msg.Data, c.vwTranslate, msg.Subject, meta.Stream())
+			outPutMSGBody(decodeMsgBody(c.vwDecoder, msg.Header, msg.Data), c.vwTranslate, msg.Subject, meta.Stream())
 		}
 
 		if shouldTerminate {
@@ -924,6 +966,10 @@ func (c *streamCmd) sealAction(_ *fisk.ParseContext) error {
 }
 
 func (c *streamCmd) restoreAction(_ *fisk.ParseContext) error {
+	if len(c.restoreSubjects) > 0 || c.restoreSeqRange != "" {
+		return c.partialRestore()
+	}
+
 	_, mgr, err := prepareHelper("", natsOpts()...)
 	fisk.FatalIfError(err, "setup failed")
 
@@ -1027,6 +1073,234 @@ func (c *streamCmd) restoreAction(_ *fisk.ParseContext) error {
 	return nil
 }
 
+func (c *streamCmd) partialRestore() error {
+	start, end, err := parseSeqRange(c.restoreSeqRange)
+	if err != nil {
+		return err
+	}
+
+	_, mgr, err := prepareHelper("", natsOpts()...)
+	fisk.FatalIfError(err, "setup failed")
+
+	backup, err := openStreamBackup(c.backupDirectory)
+	if err != nil {
+		return err
+	}
+	defer backup.close()
+
+	target := c.restoreTarget
+	if target == "" {
+		target = backup.config.Name
+	}
+
+	known, err := mgr.IsKnownStream(target)
+	if err != nil {
+		return err
+	}
+	if !known {
+		return fmt.Errorf("stream %q does not exist, partial restores republish into an existing Stream", target)
+	}
+
+	bjs, err := backup.nc.JetStream()
+	if err != nil {
+		return err
+	}
+
+	js, err := mgr.NatsConn().JetStream()
+	if err != nil {
+		return err
+	}
+
+	var published, duplicates int
+
+	filter := streamMessageFilter{subjects: c.restoreSubjects, startSeq: start, endSeq: end}
+	err = eachStreamMessage(bjs, backup.config.Name, filter, func(msg *nats.Msg, meta *nats.MsgMetadata) error {
+		out := nats.NewMsg(msg.Subject)
+		out.Data = msg.Data
+
+		// expectations stored with the message held when it was first published and would reject the restore
+		for k, v := range msg.Header {
+			if !strings.HasPrefix(k, "Nats-Expected-") {
+				out.Header[k] = v
+			}
+		}
+
+		ack, err := js.PublishMsg(out, nats.ExpectStream(target))
+		if err != nil {
+			return fmt.Errorf("could not republish message %d: %w", meta.Sequence.Stream, err)
+		}
+
+		if ack.Duplicate {
+			duplicates++
+		} else {
+			published++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Republished %s messages from backup of Stream %q into Stream %q", f(published), backup.config.Name, target)
+	if duplicates > 0 {
+		fmt.Printf(", %s were discarded as duplicates", f(duplicates))
+	}
+	fmt.Println()
+
+	return nil
+}
+
+func (c *streamCmd) backupInspectAction(_ *fisk.ParseContext) error {
+	backup, err := openStreamBackup(c.backupDirectory)
+	if err != nil {
+		return err
+	}
+	defer backup.close()
+
+	stream, err := backup.mgr.LoadStream(backup.config.Name)
+	if err != nil {
+		return err
+	}
+
+	info, err := stream.LatestInformation()
+	if err != nil {
+		return err
+	}
+
+	// show the configuration as it was at backup time rather than the one adjusted for the local server
+	info.Config = backup.config
+	info.Cluster = nil
+
+	var consumers []*api.ConsumerInfo
+	_, err = stream.EachConsumer(func(cons *jsm.Consumer) {
+		ci, err := cons.LatestState()
+		if err == nil {
+			consumers = append(consumers, &ci)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if c.json {
+		return printJSON(map[string]any{
+			"stream":    info,
+			"consumers": consumers,
+		})
+	}
+
+	c.stream = backup.config.Name
+	c.showStreamInfo(info)
+	fmt.Println()
+
+	if len(consumers) == 0 {
+		fmt.Println("No Consumers in the backup")
+		return nil
+	}
+
+	table := newTableWriter(fmt.Sprintf("%d Consumers in the backup", len(consumers)))
+	table.AddHeaders("Name", "Filter", "Ack Policy", "Delivered", "Ack Floor", "Pending")
+	for _, ci := range consumers {
+		filter := ci.Config.FilterSubject
+		if len(ci.Config.FilterSubjects) > 0 {
+			filter = strings.Join(ci.Config.FilterSubjects, ", ")
+		}
+
+		table.AddRow(ci.Name, filter, ci.Config.AckPolicy.String(), ci.Delivered.Stream, ci.AckFloor.Stream, ci.NumPending)
+	}
+	fmt.Println(table.Render())
+
+	return nil
+}
+
+type streamBackup struct {
+	config api.StreamConfig
+	srv    *server.Server
+	nc     *nats.Conn
+	mgr    *jsm.Manager
+	dir    string
+}
+
+// openStreamBackup restores a backup into a temporary in-process server that does not listen on the network,
+// the whole backup is restored into the temporary directory regardless of how much of it will be read
+func openStreamBackup(dir string) (*streamBackup, error) {
+	var bm api.JSApiStreamRestoreRequest
+	bmj, err := os.ReadFile(filepath.Join(dir, "backup.json"))
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(bmj, &bm)
+	if err != nil {
+		return nil, err
+	}
+
+	backup := &streamBackup{config: bm.Config}
+
+	backup.dir, err = os.MkdirTemp("", "nats-backup")
+	if err != nil {
+		return nil, err
+	}
+
+	backup.srv, err = server.NewServer(&server.Options{
+		ServerName: "backup",
+		DontListen: true,
+		JetStream:  true,
+		StoreDir:   backup.dir,
+		NoSigs:     true,
+	})
+	if err != nil {
+		backup.close()
+		return nil, err
+	}
+
+	go backup.srv.Start()
+	if !backup.srv.ReadyForConnections(10 * time.Second) {
+		backup.close()
+		return nil, fmt.Errorf("temporary server did not start")
+	}
+
+	backup.nc, err = nats.Connect("", nats.InProcessServer(backup.srv))
+	if err != nil {
+		backup.close()
+		return nil, err
+	}
+
+	backup.mgr, err = jsm.New(backup.nc)
+	if err != nil {
+		backup.close()
+		return nil, err
+	}
+
+	// the stream is restored in isolation so it should not try to reach other streams or cluster peers
+	cfg := bm.Config
+	cfg.Replicas = 1
+	cfg.Placement = nil
+	cfg.Mirror = nil
+	cfg.Sources = nil
+
+	_, _, err = backup.mgr.RestoreSnapshotFromDirectory(ctx, cfg.Name, dir, jsm.RestoreConfiguration(cfg))
+	if err != nil {
+		backup.close()
+		return nil, fmt.Errorf("could not load backup: %w", err)
+	}
+
+	return backup, nil
+}
+
+func (b *streamBackup) close() {
+	if b.nc != nil {
+		b.nc.Close()
+	}
+
+	if b.srv != nil {
+		b.srv.Shutdown()
+		b.srv.WaitForShutdown()
+	}
+
+	os.RemoveAll(b.dir)
+}
+
 func backupStream(stream *jsm.Stream, showProgress bool, consumers bool, check bool, target string, chunkSize int) error {
 	first := true
 	inprogress := true
@@ -1737,14 +2011,7 @@ func (c *streamCmd) editAction(pc *fisk.ParseContext) error {
 		fisk.FatalIfError(err, "could not create new configuration for Stream %s", c.stream)
 	}
 
-	// sorts strings to subject lists that only differ in ordering is considered equal
-	sorter := cmp.Transformer("Sort", func(in []string) []string {
-		out := append([]string(nil), in...)
-		sort.Strings(out)
-		return out
-	})
-
-	diff := cmp.Diff(sourceStream.Configuration(), cfg, sorter)
+	diff := configDiff(sourceStream.Configuration(), cfg)
 	if diff == "" {
 		if !c.dryRun {
 			fmt.Println("No difference in configuration")
@@ -2809,6 +3076,24 @@ func (c *streamCmd) addAction(pc *fisk.ParseContext) (err error) {
 			fisk.Fatalf("Validation Failed: %s", strings.Join(errs, "\n\t"))
 		}
 
+		// informational findings are left to 'nats stream lint'
+		var shown int
+		critical := false
+		for _, finding := range lintStream(&streamLintTarget{config: cfg, clustered: mgr.NatsConn().ConnectedClusterName() != ""}, nil) {
+			if finding.Severity == lintSeverityInfo {
+				continue
+			}
+			fmt.Printf("%s %s: %s\n", finding.Rule, finding.Severity, finding.Message)
+			critical = critical || finding.Severity == lintSeverityCritical
+			shown++
+		}
+		if shown > 0 {
+			fmt.Println()
+		}
+		if critical {
+			fisk.Fatalf("Validation Failed: configuration does not follow best practices")
+		}
+
 		fmt.Printf("Configuration is a valid Stream matching %s\n", cfg.SchemaType())
 		return nil
 
@@ -3077,6 +3362,11 @@ func (c *streamCmd) rmMsgAction(_ *fisk.ParseContext) (err error) {
 }
 
 func (c *streamCmd) getAction(_ *fisk.ParseContext) (err error) {
+	c.vwDecoder, err = newMsgDecoder(c.vwDecode)
+	if err != nil {
+		return err
+	}
+
 	c.connectAndAskStream()
 
 	if c.msgID == -1 && c.filterSubject == "" {
@@ -3120,9 +3410,10 @@ func (c *streamCmd) getAction(_ *fisk.ParseContext) (err error) {
 
 	fmt.Printf("Item: %s#%d received %v on Subject %s\n\n", c.stream, item.Sequence, item.Time, item.Subject)
 
+	var hdrs nats.Header
 	if len(item.Header) > 0 {
 		fmt.Println("Headers:")
-		hdrs, err := decodeHeadersMsg(item.Header)
+		hdrs, err = decodeHeadersMsg(item.Header)
 		if err == nil {
 			for k, vals := range hdrs {
 				for _, val := range vals {
@@ -3132,7 +3423,7 @@ func (c *streamCmd) getAction(_ *fisk.ParseContext) (err error) {
 		}
 		fmt.Println()
 	}
-	outPutMSGBody(item.Data, c.vwTranslate, item.Subject, c.stream)
+	outPutMSGBody(decodeMsgBody(c.vwDecoder, hdrs, item.Data), c.vwTranslate, item.Subject, c.stream)
 	return nil
 }
 
@@ -0,0 +1,87 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nats-io/jsm.go"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+func TestStreamPartialRestore(t *testing.T) {
+	withJetStream(t, func(_ *server.Server, nc *nats.Conn, mgr *jsm.Manager) {
+		str, err := mgr.NewStreamFromDefault("ORDERS", applyStreamDefaults, jsm.Subjects("ORDERS.*"), jsm.FileStorage())
+		assertNoError(t, err)
+
+		for i := 1; i <= 10; i++ {
+			tenant := "a"
+			if i%2 == 0 {
+				tenant = "b"
+			}
+			msg := nats.NewMsg(fmt.Sprintf("ORDERS.%s", tenant))
+			msg.Data = []byte(fmt.Sprintf("%d", i))
+			msg.Header.Set("X-Tenant", tenant)
+			// stored expectations only held when first published
+			if i == 4 {
+				msg.Header.Set(nats.ExpectedLastSubjSeqHdr, "2")
+			}
+			_, err = nc.RequestMsg(msg, time.Second)
+			assertNoError(t, err)
+		}
+
+		dir := filepath.Join(t.TempDir(), "backup")
+		assertNoError(t, backupStream(str, false, true, false, dir, 128*1024))
+
+		backup, err := openStreamBackup(dir)
+		assertNoError(t, err)
+		bstr, err := backup.mgr.LoadStream("ORDERS")
+		assertNoError(t, err)
+		nfo, err := bstr.State()
+		assertNoError(t, err)
+		backup.close()
+		if nfo.Msgs != 10 {
+			t.Fatalf("expected 10 messages in the backup got %d", nfo.Msgs)
+		}
+
+		assertNoError(t, (&streamCmd{backupDirectory: dir}).backupInspectAction(nil))
+
+		assertNoError(t, str.Purge())
+
+		cmd := &streamCmd{backupDirectory: dir, restoreSubjects: []string{"ORDERS.b"}, restoreSeqRange: "3-8"}
+		assertNoError(t, cmd.restoreAction(nil))
+
+		nfo, err = str.State()
+		assertNoError(t, err)
+		if nfo.Msgs != 3 {
+			t.Fatalf("expected 3 restored messages got %d", nfo.Msgs)
+		}
+
+		msg, err := str.ReadMessage(nfo.FirstSeq)
+		assertNoError(t, err)
+		if msg.Subject != "ORDERS.b" || string(msg.Data) != "4" {
+			t.Fatalf("unexpected first restored message %s: %q", msg.Subject, msg.Data)
+		}
+
+		hdr, err := nats.DecodeHeadersMsg(msg.Header)
+		assertNoError(t, err)
+		if hdr.Get("X-Tenant") != "b" || hdr.Get(nats.ExpectedLastSubjSeqHdr) != "" {
+			t.Fatalf("unexpected restored headers %v", hdr)
+		}
+	})
+}
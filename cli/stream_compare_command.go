@@ -0,0 +1,355 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/choria-io/fisk"
+	"github.com/nats-io/jsm.go"
+	"github.com/nats-io/nats.go"
+)
+
+type StreamCompareCmd struct {
+	streamA  string
+	streamB  string
+	contextA string
+	contextB string
+	subject  string
+	fast     bool
+	limit    int
+	json     bool
+}
+
+// streamComparison is the result of comparing the messages in two streams
+type streamComparison struct {
+	StreamA   string                  `json:"stream_a"`
+	StreamB   string                  `json:"stream_b"`
+	MessagesA uint64                  `json:"messages_a"`
+	MessagesB uint64                  `json:"messages_b"`
+	Fast      bool                    `json:"fast"`
+	Subjects  []*streamCompareSubject `json:"subject_counts,omitempty"`
+	Missing   []*streamCompareMessage `json:"missing,omitempty"`
+	Extra     []*streamCompareMessage `json:"extra,omitempty"`
+	Differing []*streamCompareMessage `json:"differing,omitempty"`
+
+	// messages in stream a by subject, with an index of positions by hash
+	hashes map[string][]*messageHash
+	index  map[string]map[[32]byte][]int
+	// sequences of messages in stream b not found in stream a by subject
+	unmatched map[string][]uint64
+}
+
+// streamCompareSubject is a subject holding a different number of messages in each stream
+type streamCompareSubject struct {
+	Subject string `json:"subject"`
+	CountA  uint64 `json:"count_a"`
+	CountB  uint64 `json:"count_b"`
+}
+
+// streamCompareMessage is a message that is missing, extra or differs between the streams
+type streamCompareMessage struct {
+	Subject string `json:"subject"`
+	SeqA    uint64 `json:"seq_a,omitempty"`
+	SeqB    uint64 `json:"seq_b,omitempty"`
+}
+
+type messageHash struct {
+	seq     uint64
+	hash    [32]byte
+	matched bool
+}
+
+func configureStreamCompareCommand(str *fisk.CmdClause) {
+	c := &StreamCompareCmd{}
+
+	compare := str.Command("compare", "Compares the messages held in two Streams").Action(c.compareAction)
+	compare.HelpLong(`Compares two Streams message by message and reports messages that are
+missing from the second Stream, extra in the second Stream or that differ in
+content.
+
+Messages are matched by their subject and a hash of their payload, sequences
+may differ between the Streams. Unmatched messages on the same subject are
+reported as differing. The per subject message counts are compared first,
+with --fast only the counts are compared.
+
+The hashes of all messages in the first Stream are held in memory while the
+second Stream is read, this needs roughly 100 bytes per message. Large Streams
+can be compared in parts using --subject.
+
+The Streams can be in different accounts or clusters by using --context-a
+and --context-b. The command exits with a non zero code when the Streams differ.
+`)
+	compare.Arg("a", "The Stream to compare").Required().StringVar(&c.streamA)
+	compare.Arg("b", "The Stream to compare against").Required().StringVar(&c.streamB)
+	compare.Flag("context-a", "The context to use to access the first Stream").PlaceHolder("NAME").StringVar(&c.contextA)
+	compare.Flag("context-b", "The context to use to access the second Stream").PlaceHolder("NAME").StringVar(&c.contextB)
+	compare.Flag("subject", "Only compare messages matching a subject").PlaceHolder("SUBJECT").StringVar(&c.subject)
+	compare.Flag("fast", "Only compare the number of messages per subject").UnNegatableBoolVar(&c.fast)
+	compare.Flag("limit", "Limits the number of differences shown").Default("100").IntVar(&c.limit)
+	compare.Flag("json", "Produce JSON output").Short('j').UnNegatableBoolVar(&c.json)
+}
+
+func (c *StreamCompareCmd) compareAction(_ *fisk.ParseContext) error {
+	mgrA, jsA, closeA, err := prepareContextHelper(c.contextA)
+	if err != nil {
+		return err
+	}
+	defer closeA()
+
+	mgrB, jsB, closeB, err := prepareContextHelper(c.contextB)
+	if err != nil {
+		return err
+	}
+	defer closeB()
+
+	res, err := c.compare(mgrA, jsA, mgrB, jsB)
+	if err != nil {
+		return err
+	}
+
+	if c.json {
+		err = printJSON(res)
+		if err != nil {
+			return err
+		}
+	} else {
+		c.render(res)
+	}
+
+	// deferred functions do not run on exit so the connections are closed first
+	if res.diverged() {
+		closeA()
+		closeB()
+		os.Exit(1)
+	}
+
+	return nil
+}
+
+func (c *StreamCompareCmd) compare(mgrA *jsm.Manager, jsA nats.JetStreamContext, mgrB *jsm.Manager, jsB nats.JetStreamContext) (*streamComparison, error) {
+	var filter []string
+	if c.subject != "" {
+		filter = append(filter, c.subject)
+	}
+
+	countsA, err := mgrA.StreamContainedSubjects(c.streamA, filter...)
+	if err != nil {
+		return nil, fmt.Errorf("could not load subjects for %s: %w", c.streamA, err)
+	}
+
+	countsB, err := mgrB.StreamContainedSubjects(c.streamB, filter...)
+	if err != nil {
+		return nil, fmt.Errorf("could not load subjects for %s: %w", c.streamB, err)
+	}
+
+	res := newStreamComparison(c.streamA, c.streamB)
+	res.Fast = c.fast
+	res.Subjects = compareSubjectCounts(countsA, countsB)
+
+	for _, v := range countsA {
+		res.MessagesA += v
+	}
+	for _, v := range countsB {
+		res.MessagesB += v
+	}
+
+	if c.fast {
+		return res, nil
+	}
+
+	msgFilter := streamMessageFilter{subjects: filter}
+
+	err = eachStreamMessage(jsA, c.streamA, msgFilter, func(msg *nats.Msg, meta *nats.MsgMetadata) error {
+		res.addMessage(msg.Subject, meta.Sequence.Stream, msg.Data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = eachStreamMessage(jsB, c.streamB, msgFilter, func(msg *nats.Msg, meta *nats.MsgMetadata) error {
+		res.compareMessage(msg.Subject, meta.Sequence.Stream, msg.Data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res.finish()
+
+	return res, nil
+}
+
+func newStreamComparison(a string, b string) *streamComparison {
+	return &streamComparison{
+		StreamA:   a,
+		StreamB:   b,
+		hashes:    map[string][]*messageHash{},
+		index:     map[string]map[[32]byte][]int{},
+		unmatched: map[string][]uint64{},
+	}
+}
+
+// addMessage records a message from stream a
+func (r *streamComparison) addMessage(subject string, seq uint64, data []byte) {
+	h := sha256.Sum256(data)
+	if r.index[subject] == nil {
+		r.index[subject] = map[[32]byte][]int{}
+	}
+
+	r.index[subject][h] = append(r.index[subject][h], len(r.hashes[subject]))
+	r.hashes[subject] = append(r.hashes[subject], &messageHash{seq: seq, hash: h})
+}
+
+// compareMessage matches a message from stream b with the first unmatched message with the same subject and content in stream a
+func (r *streamComparison) compareMessage(subject string, seq uint64, data []byte) {
+	h := sha256.Sum256(data)
+
+	positions := r.index[subject][h]
+	if len(positions) == 0 {
+		r.unmatched[subject] = append(r.unmatched[subject], seq)
+		return
+	}
+
+	r.hashes[subject][positions[0]].matched = true
+	r.index[subject][h] = positions[1:]
+}
+
+// finish pairs up unmatched messages on the same subject as differing, the rest are missing from or extra in stream b
+func (r *streamComparison) finish() {
+	subjects := map[string]struct{}{}
+	for subject := range r.hashes {
+		subjects[subject] = struct{}{}
+	}
+	for subject := range r.unmatched {
+		subjects[subject] = struct{}{}
+	}
+
+	for subject := range subjects {
+		var missing []uint64
+		for _, h := range r.hashes[subject] {
+			if !h.matched {
+				missing = append(missing, h.seq)
+			}
+		}
+
+		extra := r.unmatched[subject]
+		for i := 0; i < len(missing) || i < len(extra); i++ {
+			switch {
+			case i < len(missing) && i < len(extra):
+				r.Differing = append(r.Differing, &streamCompareMessage{Subject: subject, SeqA: missing[i], SeqB: extra[i]})
+			case i < len(missing):
+				r.Missing = append(r.Missing, &streamCompareMessage{Subject: subject, SeqA: missing[i]})
+			default:
+				r.Extra = append(r.Extra, &streamCompareMessage{Subject: subject, SeqB: extra[i]})
+			}
+		}
+	}
+
+	sort.Slice(r.Missing, func(i, j int) bool { return r.Missing[i].SeqA < r.Missing[j].SeqA })
+	sort.Slice(r.Extra, func(i, j int) bool { return r.Extra[i].SeqB < r.Extra[j].SeqB })
+	sort.Slice(r.Differing, func(i, j int) bool { return r.Differing[i].SeqA < r.Differing[j].SeqA })
+}
+
+func (r *streamComparison) diverged() bool {
+	return len(r.Subjects) > 0 || len(r.Missing) > 0 || len(r.Extra) > 0 || len(r.Differing) > 0
+}
+
+func (c *StreamCompareCmd) render(r *streamComparison) {
+	cols := newColumns(fmt.Sprintf("Comparison of Stream %s and %s", r.StreamA, r.StreamB))
+	cols.AddRow(fmt.Sprintf("Messages in %s", r.StreamA), r.MessagesA)
+	cols.AddRow(fmt.Sprintf("Messages in %s", r.StreamB), r.MessagesB)
+	cols.AddRow("Subjects with different counts", len(r.Subjects))
+	if !r.Fast {
+		cols.AddRow(fmt.Sprintf("Missing from %s", r.StreamB), len(r.Missing))
+		cols.AddRow(fmt.Sprintf("Extra in %s", r.StreamB), len(r.Extra))
+		cols.AddRow("Differing content", len(r.Differing))
+	}
+	cols.Println()
+	if r.diverged() {
+		cols.AddRow("Result", "Streams differ")
+	} else if r.Fast {
+		cols.AddRow("Result", "Subject counts match")
+	} else {
+		cols.AddRow("Result", "Streams match")
+	}
+	cols.Frender(os.Stdout)
+
+	if len(r.Subjects) > 0 {
+		table := newTableWriter("Subjects with different message counts")
+		table.AddHeaders("Subject", r.StreamA, r.StreamB)
+		for i, s := range r.Subjects {
+			if i == c.limit {
+				break
+			}
+			table.AddRow(s.Subject, f(s.CountA), f(s.CountB))
+		}
+		fmt.Println()
+		fmt.Println(table.Render())
+	}
+
+	show := func(title string, msgs []*streamCompareMessage) {
+		if len(msgs) == 0 {
+			return
+		}
+
+		table := newTableWriter(title)
+		table.AddHeaders("Subject", fmt.Sprintf("%s Sequence", r.StreamA), fmt.Sprintf("%s Sequence", r.StreamB))
+		for i, m := range msgs {
+			if i == c.limit {
+				break
+			}
+
+			seqA, seqB := "", ""
+			if m.SeqA > 0 {
+				seqA = f(m.SeqA)
+			}
+			if m.SeqB > 0 {
+				seqB = f(m.SeqB)
+			}
+			table.AddRow(m.Subject, seqA, seqB)
+		}
+		fmt.Println()
+		fmt.Println(table.Render())
+	}
+
+	show(fmt.Sprintf("Messages missing from %s", r.StreamB), r.Missing)
+	show(fmt.Sprintf("Extra messages in %s", r.StreamB), r.Extra)
+	show("Messages with differing content", r.Differing)
+}
+
+// compareSubjectCounts finds subjects with different message counts, sorted by subject
+func compareSubjectCounts(a map[string]uint64, b map[string]uint64) []*streamCompareSubject {
+	var res []*streamCompareSubject
+
+	for subject, count := range a {
+		if b[subject] != count {
+			res = append(res, &streamCompareSubject{Subject: subject, CountA: count, CountB: b[subject]})
+		}
+	}
+
+	for subject, count := range b {
+		if _, ok := a[subject]; !ok {
+			res = append(res, &streamCompareSubject{Subject: subject, CountB: count})
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Subject < res[j].Subject })
+
+	return res
+}
@@ -0,0 +1,106 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/jsm.go"
+	"github.com/nats-io/jsm.go/api"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+func TestStreamComparisonMessages(t *testing.T) {
+	r := newStreamComparison("A", "B")
+	r.addMessage("x", 1, []byte("1"))
+	r.addMessage("y", 2, []byte("2"))
+	r.addMessage("x", 3, []byte("3"))
+	r.addMessage("y", 4, []byte("4"))
+
+	r.compareMessage("x", 10, []byte("1"))
+	r.compareMessage("y", 11, []byte("2"))
+	r.compareMessage("x", 12, []byte("changed"))
+	r.compareMessage("z", 13, []byte("5"))
+	r.finish()
+
+	if !r.diverged() {
+		t.Fatalf("expected divergence")
+	}
+	if len(r.Differing) != 1 || r.Differing[0].SeqA != 3 || r.Differing[0].SeqB != 12 {
+		t.Fatalf("invalid differing messages %+v", r.Differing)
+	}
+	if len(r.Extra) != 1 || r.Extra[0].Subject != "z" || r.Extra[0].SeqB != 13 {
+		t.Fatalf("invalid extra messages %+v", r.Extra)
+	}
+	if len(r.Missing) != 1 || r.Missing[0].Subject != "y" || r.Missing[0].SeqA != 4 {
+		t.Fatalf("invalid missing messages %+v", r.Missing)
+	}
+
+	counts := compareSubjectCounts(map[string]uint64{"x": 1, "y": 2}, map[string]uint64{"y": 1, "z": 1})
+	if len(counts) != 3 || counts[0].Subject != "x" || counts[1].CountA != 2 || counts[1].CountB != 1 || counts[2].CountA != 0 {
+		t.Fatalf("invalid subject counts %+v", counts)
+	}
+}
+
+func TestStreamCompare(t *testing.T) {
+	withJetStream(t, func(_ *server.Server, nc *nats.Conn, mgr *jsm.Manager) {
+		js, err := nc.JetStream()
+		assertNoError(t, err)
+
+		_, err = mgr.NewStreamFromDefault("A", applyStreamDefaults, jsm.Subjects("A.*"), jsm.MemoryStorage())
+		assertNoError(t, err)
+
+		for i := 1; i <= 10; i++ {
+			_, err = js.Publish(fmt.Sprintf("A.%d", i%3), []byte(fmt.Sprintf("msg %d", i)))
+			assertNoError(t, err)
+		}
+
+		b, err := mgr.NewStreamFromDefault("B", applyStreamDefaults, jsm.MemoryStorage(), jsm.Sources(&api.StreamSource{Name: "A"}))
+		assertNoError(t, err)
+
+		for i := 0; i < 100; i++ {
+			nfo, err := b.State()
+			assertNoError(t, err)
+			if nfo.Msgs == 10 {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+
+		cmp := &StreamCompareCmd{streamA: "A", streamB: "B"}
+		res, err := cmp.compare(mgr, js, mgr, js)
+		assertNoError(t, err)
+		if res.diverged() || res.MessagesA != 10 || res.MessagesB != 10 {
+			t.Fatalf("expected identical streams: %+v", res)
+		}
+
+		assertNoError(t, b.DeleteMessage(5))
+
+		res, err = cmp.compare(mgr, js, mgr, js)
+		assertNoError(t, err)
+		if !res.diverged() || len(res.Missing) != 1 || res.Missing[0].SeqA != 5 || len(res.Subjects) != 1 {
+			t.Fatalf("expected a missing message: %+v", res)
+		}
+
+		cmp.fast = true
+		res, err = cmp.compare(mgr, js, mgr, js)
+		assertNoError(t, err)
+		if !res.diverged() || len(res.Missing) != 0 || len(res.Subjects) != 1 || res.Subjects[0].Subject != "A.2" {
+			t.Fatalf("expected a subject count difference: %+v", res)
+		}
+	})
+}
@@ -0,0 +1,450 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"archive/tar"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/choria-io/fisk"
+	"github.com/nats-io/nats.go"
+)
+
+type StreamExportCmd struct {
+	stream    string
+	file      string
+	format    string
+	subjects  []string
+	seqRange  string
+	since     string
+	until     string
+	dedupe    bool
+	rate      int
+	overwrite bool
+}
+
+// streamExportRecord is a single message in an export, the tar format stores the data in a separate file
+type streamExportRecord struct {
+	Stream   string      `json:"stream"`
+	Subject  string      `json:"subject"`
+	Sequence uint64      `json:"seq"`
+	Time     time.Time   `json:"time"`
+	Headers  nats.Header `json:"headers,omitempty"`
+	Data     []byte      `json:"data,omitempty"`
+}
+
+// streamMessageFilter selects messages when iterating a stream using eachStreamMessage
+type streamMessageFilter struct {
+	subjects []string
+	startSeq uint64
+	endSeq   uint64
+	since    time.Time
+	until    time.Time
+}
+
+func configureStreamExportCommand(str *fisk.CmdClause) {
+	c := &StreamExportCmd{}
+
+	export := str.Command("export", "Exports messages from a Stream to a file").Action(c.exportAction)
+	export.HelpLong(`Exports messages including their subject, headers, timestamp and original
+sequence in a format that can be loaded using 'nats stream import'.
+
+The jsonl and ndjson formats write one JSON document per message while the tar
+format writes a metadata file and a file holding the raw body per message.
+
+Times given to --since and --until can be RFC3339 timestamps or durations
+like 1h indicating a time in the past.
+`)
+	export.Arg("stream", "Stream to export").Required().StringVar(&c.stream)
+	export.Flag("output", "File to write the export to, - for standard output").Short('o').Default("-").StringVar(&c.file)
+	export.Flag("format", "The format to export to").Default("jsonl").EnumVar(&c.format, "jsonl", "ndjson", "tar")
+	export.Flag("subject", "Only export messages matching a subject (pass multiple times)").PlaceHolder("SUBJECT").StringsVar(&c.subjects)
+	export.Flag("seq-range", "Only export messages in a sequence range like 100-200").PlaceHolder("RANGE").StringVar(&c.seqRange)
+	export.Flag("since", "Only export messages received since a time").PlaceHolder("TIME").StringVar(&c.since)
+	export.Flag("until", "Only export messages received before a time").PlaceHolder("TIME").StringVar(&c.until)
+	export.Flag("force", "Overwrite the output file without prompting").Short('f').UnNegatableBoolVar(&c.overwrite)
+
+	imp := str.Command("import", "Imports messages into a Stream from an export").Action(c.importAction)
+	imp.HelpLong(`Publishes messages created by 'nats stream export' into a Stream
+using their original subjects and headers.
+
+When --dedupe is set messages without a Nats-Msg-Id header will get one based
+on the original stream and sequence so that repeated imports within the
+Stream duplicate window do not store the same message twice.
+`)
+	imp.Arg("stream", "Stream to import into").Required().StringVar(&c.stream)
+	imp.Arg("file", "File holding the export, - for standard input").Required().StringVar(&c.file)
+	imp.Flag("format", "The format of the export, detected from the file name by default").EnumVar(&c.format, "jsonl", "ndjson", "tar")
+	imp.Flag("dedupe", "Set Nats-Msg-Id headers based on the original sequence").UnNegatableBoolVar(&c.dedupe)
+	imp.Flag("rate", "Limit publishing to a number of messages per second").PlaceHolder("MSGS").IntVar(&c.rate)
+}
+
+func (c *StreamExportCmd) exportAction(_ *fisk.ParseContext) error {
+	filter := streamMessageFilter{subjects: c.subjects}
+
+	var err error
+	filter.startSeq, filter.endSeq, err = parseSeqRange(c.seqRange)
+	if err != nil {
+		return err
+	}
+
+	if c.since != "" {
+		filter.since, err = parseTimeOrAge(c.since)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.until != "" {
+		filter.until, err = parseTimeOrAge(c.until)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, js, err := prepareJSHelper()
+	fisk.FatalIfError(err, "setup failed")
+
+	var out io.Writer = os.Stdout
+	var file *os.File
+	if c.file != "-" {
+		_, err = os.Stat(c.file)
+		if err == nil && !c.overwrite {
+			ok, err := askConfirmation(fmt.Sprintf("Overwrite existing file %s", c.file), false)
+			fisk.FatalIfError(err, "could not obtain confirmation")
+
+			if !ok {
+				return nil
+			}
+		}
+
+		file, err = os.Create(c.file)
+		if err != nil {
+			return err
+		}
+		// closes the file on error paths, on success it is closed below so write errors are reported
+		defer file.Close()
+
+		out = file
+	}
+
+	bw := bufio.NewWriter(out)
+
+	var tw *tar.Writer
+	var enc *json.Encoder
+
+	if c.format == "tar" {
+		tw = tar.NewWriter(bw)
+	} else {
+		enc = json.NewEncoder(bw)
+	}
+
+	count := 0
+	err = eachStreamMessage(js, c.stream, filter, func(msg *nats.Msg, meta *nats.MsgMetadata) error {
+		rec := streamExportRecord{
+			Stream:   c.stream,
+			Subject:  msg.Subject,
+			Sequence: meta.Sequence.Stream,
+			Time:     meta.Timestamp,
+			Headers:  msg.Header,
+			Data:     msg.Data,
+		}
+
+		count++
+
+		if tw == nil {
+			return enc.Encode(rec)
+		}
+
+		return writeTarExportRecord(tw, rec)
+	})
+	if err != nil {
+		return err
+	}
+
+	if tw != nil {
+		err = tw.Close()
+		if err != nil {
+			return fmt.Errorf("could not write export: %w", err)
+		}
+	}
+
+	err = bw.Flush()
+	if err != nil {
+		return fmt.Errorf("could not write export: %w", err)
+	}
+
+	if file != nil {
+		err = file.Close()
+		if err != nil {
+			return fmt.Errorf("could not write export: %w", err)
+		}
+
+		fmt.Printf("Exported %s messages from Stream %s to %s\n", f(count), c.stream, c.file)
+	}
+
+	return nil
+}
+
+func writeTarExportRecord(tw *tar.Writer, rec streamExportRecord) error {
+	data := rec.Data
+	rec.Data = nil
+
+	meta, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%020d", rec.Sequence)
+	for _, file := range []struct {
+		name string
+		body []byte
+	}{{name + ".json", meta}, {name + ".data", data}} {
+		err = tw.WriteHeader(&tar.Header{Name: file.name, Mode: 0600, Size: int64(len(file.body)), ModTime: rec.Time})
+		if err != nil {
+			return err
+		}
+
+		_, err = tw.Write(file.body)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *StreamExportCmd) importAction(_ *fisk.ParseContext) error {
+	if c.format == "" {
+		c.format = "jsonl"
+		if strings.HasSuffix(c.file, ".tar") {
+			c.format = "tar"
+		}
+	}
+
+	_, js, err := prepareJSHelper()
+	fisk.FatalIfError(err, "setup failed")
+
+	var in io.Reader = os.Stdin
+	if c.file != "-" {
+		f, err := os.Open(filepath.Clean(c.file))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		in = f
+	}
+
+	var pace *time.Ticker
+	if c.rate > 0 {
+		pace = time.NewTicker(time.Second / time.Duration(c.rate))
+		defer pace.Stop()
+	}
+
+	var published, duplicates int
+
+	publish := func(rec streamExportRecord) error {
+		msg := nats.NewMsg(rec.Subject)
+		msg.Data = rec.Data
+		for k, vs := range rec.Headers {
+			for _, v := range vs {
+				msg.Header.Add(k, v)
+			}
+		}
+
+		if c.dedupe && msg.Header.Get(nats.MsgIdHdr) == "" {
+			msg.Header.Set(nats.MsgIdHdr, fmt.Sprintf("%s:%d", rec.Stream, rec.Sequence))
+		}
+
+		if pace != nil {
+			select {
+			case <-pace.C:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		ack, err := js.PublishMsg(msg, nats.ExpectStream(c.stream))
+		if err != nil {
+			return fmt.Errorf("could not publish message %d: %w", rec.Sequence, err)
+		}
+
+		if ack.Duplicate {
+			duplicates++
+		} else {
+			published++
+		}
+
+		return nil
+	}
+
+	if c.format == "tar" {
+		err = readTarExport(in, publish)
+	} else {
+		err = readJSONLExport(in, publish)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported %s messages into Stream %s", f(published), c.stream)
+	if duplicates > 0 {
+		fmt.Printf(", %s were discarded as duplicates", f(duplicates))
+	}
+	fmt.Println()
+
+	return nil
+}
+
+func readJSONLExport(in io.Reader, cb func(streamExportRecord) error) error {
+	dec := json.NewDecoder(in)
+	for {
+		var rec streamExportRecord
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid export: %w", err)
+		}
+
+		err = cb(rec)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func readTarExport(in io.Reader, cb func(streamExportRecord) error) error {
+	tr := tar.NewReader(in)
+
+	var rec *streamExportRecord
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("invalid export: %w", err)
+		}
+
+		body, err := io.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+
+		switch filepath.Ext(hdr.Name) {
+		case ".json":
+			if rec != nil {
+				return fmt.Errorf("invalid export: no data found for message %d", rec.Sequence)
+			}
+
+			rec = &streamExportRecord{}
+			err = json.Unmarshal(body, rec)
+			if err != nil {
+				return fmt.Errorf("invalid export: %s: %w", hdr.Name, err)
+			}
+
+		case ".data":
+			if rec == nil {
+				return fmt.Errorf("invalid export: no metadata found for %s", hdr.Name)
+			}
+
+			rec.Data = body
+			err = cb(*rec)
+			if err != nil {
+				return err
+			}
+			rec = nil
+		}
+	}
+
+	if rec != nil {
+		return fmt.Errorf("invalid export: no data found for message %d", rec.Sequence)
+	}
+
+	return nil
+}
+
+// eachStreamMessage calls cb for every message in stream matching filter using an ordered consumer
+func eachStreamMessage(js nats.JetStreamContext, stream string, filter streamMessageFilter, cb func(msg *nats.Msg, meta *nats.MsgMetadata) error) error {
+	subOpts := []nats.SubOpt{nats.BindStream(stream), nats.OrderedConsumer()}
+
+	switch {
+	case filter.startSeq > 0:
+		subOpts = append(subOpts, nats.StartSequence(filter.startSeq))
+	case !filter.since.IsZero():
+		subOpts = append(subOpts, nats.StartTime(filter.since))
+	default:
+		subOpts = append(subOpts, nats.DeliverAll())
+	}
+
+	if len(filter.subjects) > 0 {
+		subOpts = append(subOpts, nats.ConsumerFilterSubjects(filter.subjects...))
+	}
+
+	sub, err := js.SubscribeSync("", subOpts...)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	nfo, err := sub.ConsumerInfo()
+	if err != nil {
+		return err
+	}
+	// messages are pushed as soon as the consumer is created so some might already be delivered
+	if nfo.NumPending+nfo.Delivered.Consumer == 0 {
+		return nil
+	}
+
+	for {
+		msg, err := sub.NextMsgWithContext(ctx)
+		if err != nil {
+			return err
+		}
+
+		meta, err := msg.Metadata()
+		if err != nil {
+			return err
+		}
+
+		if filter.endSeq > 0 && meta.Sequence.Stream > filter.endSeq {
+			return nil
+		}
+		if !filter.until.IsZero() && meta.Timestamp.After(filter.until) {
+			return nil
+		}
+
+		if filter.since.IsZero() || !meta.Timestamp.Before(filter.since) {
+			err = cb(msg, meta)
+			if err != nil {
+				return err
+			}
+		}
+
+		if meta.NumPending == 0 {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/nats-io/jsm.go"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+func TestStreamExportImport(t *testing.T) {
+	withJetStream(t, func(_ *server.Server, nc *nats.Conn, mgr *jsm.Manager) {
+		js, err := nc.JetStream()
+		assertNoError(t, err)
+
+		for _, format := range []string{"jsonl", "tar"} {
+			orders, err := mgr.NewStreamFromDefault("ORDERS", applyStreamDefaults, jsm.Subjects("ORDERS.*"), jsm.MemoryStorage())
+			assertNoError(t, err)
+
+			for i := 1; i <= 10; i++ {
+				msg := nats.NewMsg(fmt.Sprintf("ORDERS.%d", i%2))
+				msg.Header.Add("X-Index", fmt.Sprintf("%d", i))
+				msg.Data = []byte{byte(i), 0, 1}
+				_, err = js.PublishMsg(msg)
+				assertNoError(t, err)
+			}
+
+			file := filepath.Join(t.TempDir(), "export."+format)
+
+			exp := &StreamExportCmd{stream: "ORDERS", file: file, format: format, subjects: []string{"ORDERS.0"}, seqRange: "3-"}
+			assertNoError(t, exp.exportAction(nil))
+
+			assertNoError(t, orders.Purge())
+
+			imp := &StreamExportCmd{stream: "ORDERS", file: file, dedupe: true}
+			assertNoError(t, imp.importAction(nil))
+			// imported again to verify dedupe
+			assertNoError(t, imp.importAction(nil))
+
+			nfo, err := orders.State()
+			assertNoError(t, err)
+			if nfo.Msgs != 4 {
+				t.Fatalf("expected 4 imported messages got %d", nfo.Msgs)
+			}
+
+			msg, err := js.GetMsg("ORDERS", nfo.FirstSeq)
+			assertNoError(t, err)
+			if msg.Subject != "ORDERS.0" || msg.Header.Get("X-Index") != "4" || len(msg.Data) != 3 || msg.Data[0] != 4 {
+				t.Fatalf("invalid message imported: %s %v %v", msg.Subject, msg.Header, msg.Data)
+			}
+			if msg.Header.Get(nats.MsgIdHdr) != "ORDERS:4" {
+				t.Fatalf("invalid msg id %q", msg.Header.Get(nats.MsgIdHdr))
+			}
+
+			assertNoError(t, orders.Delete())
+		}
+	})
+}
@@ -0,0 +1,385 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/choria-io/fisk"
+	"github.com/nats-io/jsm.go"
+	"github.com/nats-io/jsm.go/api"
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+const (
+	lintSeverityInfo     = "info"
+	lintSeverityWarning  = "warning"
+	lintSeverityCritical = "critical"
+
+	// streamLintSuppressMetadata is a Stream metadata key holding a comma separated list of rule IDs to suppress
+	streamLintSuppressMetadata = "io.nats.lint.suppress"
+)
+
+type StreamLintCmd struct {
+	stream     string
+	configFile string
+	suppress   []string
+	json       bool
+	listRules  bool
+}
+
+// streamLintTarget is the stream being linted along with the context it is deployed in
+type streamLintTarget struct {
+	config    api.StreamConfig
+	clustered bool
+	consumers []api.ConsumerConfig
+}
+
+type streamLintRule struct {
+	ID          string `json:"id"`
+	Severity    string `json:"severity"`
+	Description string `json:"description"`
+	check       func(t *streamLintTarget) []string
+}
+
+type streamLintFinding struct {
+	Stream   string `json:"stream"`
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+var streamLintRules = []*streamLintRule{
+	{
+		ID:          "STR001",
+		Severity:    lintSeverityWarning,
+		Description: "File storage Streams in a cluster should have more than 1 replica",
+		check: func(t *streamLintTarget) []string {
+			if t.clustered && t.config.Storage == api.FileStorage && t.config.Replicas <= 1 && t.config.Mirror == nil {
+				return []string{"Stream uses file storage with 1 replica in a cluster, data will be unavailable when the server is down"}
+			}
+			return nil
+		},
+	},
+	{
+		ID:          "STR002",
+		Severity:    lintSeverityInfo,
+		Description: "Limits based Streams should be limited by size, age or message count",
+		check: func(t *streamLintTarget) []string {
+			// buckets are unlimited by default and managed using the KV and Object Store tools
+			if streamLintIsBucket(t.config) || t.config.Retention != api.LimitsPolicy {
+				return nil
+			}
+
+			if t.config.MaxBytes <= 0 && t.config.MaxAge <= 0 && t.config.MaxMsgs <= 0 {
+				return []string{"Stream has limits retention but no size, age or message limits, it can grow to fill the available storage"}
+			}
+			return nil
+		},
+	},
+	{
+		ID:          "STR003",
+		Severity:    lintSeverityWarning,
+		Description: "The duplicate window should not exceed the maximum message age",
+		check: func(t *streamLintTarget) []string {
+			if t.config.MaxAge > 0 && t.config.Duplicates > t.config.MaxAge {
+				return []string{fmt.Sprintf("duplicate window %v is larger than the maximum age %v", t.config.Duplicates, t.config.MaxAge)}
+			}
+			return nil
+		},
+	},
+	{
+		ID:          "STR004",
+		Severity:    lintSeverityCritical,
+		Description: "Work Queue Streams should not have Consumers with overlapping filters",
+		check: func(t *streamLintTarget) []string {
+			if t.config.Retention != api.WorkQueuePolicy {
+				return nil
+			}
+
+			var res []string
+			for i := 0; i < len(t.consumers); i++ {
+				for j := i + 1; j < len(t.consumers); j++ {
+					if streamLintFiltersOverlap(t.consumers[i], t.consumers[j]) {
+						res = append(res, fmt.Sprintf("Consumers %s and %s have overlapping filters", streamLintConsumerName(t.consumers[i]), streamLintConsumerName(t.consumers[j])))
+					}
+				}
+			}
+			return res
+		},
+	},
+	{
+		ID:          "STR005",
+		Severity:    lintSeverityWarning,
+		Description: "KV style Streams should limit messages per subject",
+		check: func(t *streamLintTarget) []string {
+			kvStyle := jsm.IsKVBucketStream(t.config.Name)
+			for _, subj := range t.config.Subjects {
+				if strings.HasPrefix(subj, "$KV.") {
+					kvStyle = true
+				}
+			}
+
+			if kvStyle && t.config.MaxMsgsPer <= 0 {
+				return []string{"Stream holds KV data but does not limit messages per subject, history will grow without bound"}
+			}
+			return nil
+		},
+	},
+	{
+		ID:          "STR006",
+		Severity:    lintSeverityCritical,
+		Description: "Mirrors can not listen on subjects",
+		check: func(t *streamLintTarget) []string {
+			if t.config.Mirror != nil && len(t.config.Subjects) > 0 {
+				return []string{fmt.Sprintf("Stream mirrors %s but also listens on subjects %s", t.config.Mirror.Name, strings.Join(t.config.Subjects, ", "))}
+			}
+			return nil
+		},
+	},
+	{
+		ID:          "STR007",
+		Severity:    lintSeverityWarning,
+		Description: "Clustered Streams should have an odd number of replicas",
+		check: func(t *streamLintTarget) []string {
+			if t.config.Replicas > 1 && t.config.Replicas%2 == 0 {
+				return []string{fmt.Sprintf("Stream has %d replicas, an even number of replicas tolerates no more failures than one fewer", t.config.Replicas)}
+			}
+			return nil
+		},
+	},
+	{
+		ID:          "STR008",
+		Severity:    lintSeverityInfo,
+		Description: "Discard new only has an effect when limits are set",
+		check: func(t *streamLintTarget) []string {
+			if streamLintIsBucket(t.config) {
+				return nil
+			}
+
+			if t.config.Discard == api.DiscardNew && t.config.MaxBytes <= 0 && t.config.MaxMsgs <= 0 && t.config.MaxMsgsPer <= 0 {
+				return []string{"Stream discards new messages but has no message or size limits"}
+			}
+			return nil
+		},
+	},
+}
+
+func configureStreamLintCommand(str *fisk.CmdClause) {
+	c := &StreamLintCmd{}
+
+	lint := str.Command("lint", "Checks Stream configuration against best practices").Action(c.lintAction)
+	lint.HelpLong(`Evaluates the configuration of a Stream against a set of rules that
+detect common operational problems.
+
+Rules can be suppressed using --suppress or by setting the io.nats.lint.suppress
+metadata on a Stream to a comma separated list of rule IDs.
+
+When no Stream or configuration file is given all Streams are checked. The
+command exits with a non zero code when critical problems are found.
+`)
+	lint.Arg("stream", "The Stream to check").StringVar(&c.stream)
+	lint.Flag("config", "Checks a Stream configuration file").PlaceHolder("FILE").ExistingFileVar(&c.configFile)
+	lint.Flag("suppress", "Rule IDs to suppress (pass multiple times)").PlaceHolder("ID").StringsVar(&c.suppress)
+	lint.Flag("rules", "Lists all rules").UnNegatableBoolVar(&c.listRules)
+	lint.Flag("json", "Produce JSON output").Short('j').UnNegatableBoolVar(&c.json)
+}
+
+func (c *StreamLintCmd) lintAction(_ *fisk.ParseContext) error {
+	if c.listRules {
+		return c.showRules()
+	}
+
+	var targets []*streamLintTarget
+
+	if c.configFile != "" {
+		cfg, err := (&streamCmd{}).loadConfigFile(c.configFile)
+		if err != nil {
+			return err
+		}
+
+		target := &streamLintTarget{config: *cfg}
+
+		// the file is checked offline when no server is reachable
+		nc, _, err := prepareHelper("", natsOpts()...)
+		if err == nil {
+			target.clustered = nc.ConnectedClusterName() != ""
+		}
+
+		targets = append(targets, target)
+	} else {
+		_, mgr, err := prepareHelper("", natsOpts()...)
+		fisk.FatalIfError(err, "setup failed")
+
+		var streams []*jsm.Stream
+		if c.stream != "" {
+			stream, err := mgr.LoadStream(c.stream)
+			if err != nil {
+				return err
+			}
+			streams = append(streams, stream)
+		} else {
+			streams, _, err = mgr.Streams(nil)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, stream := range streams {
+			target, err := newStreamLintTarget(stream)
+			if err != nil {
+				return err
+			}
+			targets = append(targets, target)
+		}
+	}
+
+	var findings []*streamLintFinding
+	for _, target := range targets {
+		findings = append(findings, lintStream(target, c.suppress)...)
+	}
+
+	if c.json {
+		err := printJSON(findings)
+		if err != nil {
+			return err
+		}
+	} else {
+		c.renderFindings(findings, len(targets))
+	}
+
+	for _, finding := range findings {
+		if finding.Severity == lintSeverityCritical {
+			os.Exit(1)
+		}
+	}
+
+	return nil
+}
+
+func (c *StreamLintCmd) showRules() error {
+	if c.json {
+		return printJSON(streamLintRules)
+	}
+
+	table := newTableWriter("Stream Lint Rules")
+	table.AddHeaders("ID", "Severity", "Description")
+	for _, rule := range streamLintRules {
+		table.AddRow(rule.ID, rule.Severity, rule.Description)
+	}
+	fmt.Println(table.Render())
+
+	return nil
+}
+
+func (c *StreamLintCmd) renderFindings(findings []*streamLintFinding, streams int) {
+	if len(findings) == 0 {
+		fmt.Printf("No problems found in %s Streams\n", f(streams))
+		return
+	}
+
+	table := newTableWriter(fmt.Sprintf("%s problems found in %s Streams", f(len(findings)), f(streams)))
+	table.AddHeaders("Stream", "Rule", "Severity", "Problem")
+	for _, finding := range findings {
+		table.AddRow(finding.Stream, finding.Rule, finding.Severity, finding.Message)
+	}
+	fmt.Println(table.Render())
+}
+
+func newStreamLintTarget(stream *jsm.Stream) (*streamLintTarget, error) {
+	nfo, err := stream.LatestInformation()
+	if err != nil {
+		return nil, err
+	}
+
+	target := &streamLintTarget{
+		config:    nfo.Config,
+		clustered: nfo.Cluster != nil && nfo.Cluster.Name != "",
+	}
+
+	_, err = stream.EachConsumer(func(cons *jsm.Consumer) {
+		target.consumers = append(target.consumers, cons.Configuration())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return target, nil
+}
+
+// lintStream evaluates all rules against target, rules listed in suppress or the stream metadata are skipped
+func lintStream(target *streamLintTarget, suppress []string) []*streamLintFinding {
+	suppressed := map[string]bool{}
+	for _, id := range suppress {
+		suppressed[strings.ToUpper(id)] = true
+	}
+	for _, id := range strings.Split(target.config.Metadata[streamLintSuppressMetadata], ",") {
+		suppressed[strings.ToUpper(strings.TrimSpace(id))] = true
+	}
+
+	var findings []*streamLintFinding
+	for _, rule := range streamLintRules {
+		if suppressed[rule.ID] {
+			continue
+		}
+
+		for _, msg := range rule.check(target) {
+			findings = append(findings, &streamLintFinding{Stream: target.config.Name, Rule: rule.ID, Severity: rule.Severity, Message: msg})
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Stream < findings[j].Stream
+	})
+
+	return findings
+}
+
+// streamLintIsBucket determines if cfg is the Stream of a KV bucket or Object Store
+func streamLintIsBucket(cfg api.StreamConfig) bool {
+	return jsm.IsKVBucketStream(cfg.Name) || jsm.IsObjectBucketStream(cfg.Name)
+}
+
+func streamLintConsumerName(cfg api.ConsumerConfig) string {
+	if cfg.Durable != "" {
+		return cfg.Durable
+	}
+
+	return cfg.Name
+}
+
+func streamLintFiltersOverlap(a api.ConsumerConfig, b api.ConsumerConfig) bool {
+	filters := func(cfg api.ConsumerConfig) []string {
+		if len(cfg.FilterSubjects) > 0 {
+			return cfg.FilterSubjects
+		}
+		if cfg.FilterSubject != "" {
+			return []string{cfg.FilterSubject}
+		}
+		return []string{">"}
+	}
+
+	for _, fa := range filters(a) {
+		for _, fb := range filters(b) {
+			if server.SubjectsCollide(fa, fb) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,83 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/jsm.go/api"
+)
+
+func TestLintStream(t *testing.T) {
+	rules := func(findings []*streamLintFinding) []string {
+		var res []string
+		for _, f := range findings {
+			res = append(res, f.Rule)
+		}
+		return res
+	}
+
+	target := &streamLintTarget{
+		clustered: true,
+		config: api.StreamConfig{
+			Name:       "ORDERS",
+			Subjects:   []string{"ORDERS.*"},
+			Retention:  api.LimitsPolicy,
+			Storage:    api.FileStorage,
+			Replicas:   1,
+			MaxBytes:   -1,
+			MaxAge:     time.Minute,
+			Duplicates: time.Hour,
+		},
+	}
+
+	assertListEquals(t, rules(lintStream(target, nil)), "STR001", "STR003")
+	assertListEquals(t, rules(lintStream(target, []string{"str001", "STR002"})), "STR003")
+
+	target.config.Metadata = map[string]string{streamLintSuppressMetadata: "STR001"}
+	assertListEquals(t, rules(lintStream(target, nil)), "STR003")
+
+	// unbounded streams are reported but buckets with their default unlimited settings are not
+	target.config.MaxAge = 0
+	target.config.Duplicates = 0
+	assertListEquals(t, rules(lintStream(target, nil)), "STR002")
+
+	for _, cfg := range []api.StreamConfig{applyKVDefaults("KV_CONFIG"), applyObjectDefaults("OBJ_FILES")} {
+		if findings := lintStream(&streamLintTarget{config: cfg}, nil); len(findings) != 0 {
+			t.Fatalf("unexpected findings for %s: %v", cfg.Name, rules(findings))
+		}
+	}
+
+	target = &streamLintTarget{
+		config: api.StreamConfig{
+			Name:      "JOBS",
+			Retention: api.WorkQueuePolicy,
+			Replicas:  3,
+			Mirror:    &api.StreamSource{Name: "OTHER"},
+			Subjects:  []string{"JOBS.>"},
+		},
+		consumers: []api.ConsumerConfig{
+			{Durable: "A", FilterSubject: "JOBS.a.>"},
+			{Durable: "B", FilterSubjects: []string{"JOBS.*.x"}},
+			{Durable: "C", FilterSubject: "JOBS.c"},
+		},
+	}
+
+	findings := lintStream(target, nil)
+	assertListEquals(t, rules(findings), "STR004", "STR006")
+	if findings[0].Message != "Consumers A and B have overlapping filters" {
+		t.Fatalf("invalid overlap message: %s", findings[0].Message)
+	}
+}
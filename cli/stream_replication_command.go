@@ -0,0 +1,358 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/choria-io/fisk"
+	"github.com/nats-io/jsm.go"
+	"github.com/nats-io/jsm.go/api"
+	terminal "golang.org/x/term"
+)
+
+type StreamReplicationCmd struct {
+	topCount   int
+	sort       string
+	interval   time.Duration
+	filter     string
+	errorsOnly bool
+	minLag     uint64
+	sortNames  map[string]string
+
+	lastPoll time.Time
+	lastLag  map[string]uint64
+	lastSeq  map[string]uint64
+}
+
+// replicationEdge is a single mirror or source relationship between two streams
+type replicationEdge struct {
+	stream   string
+	kind     string
+	origin   string
+	filter   string
+	external string
+	lag      uint64
+	active   time.Duration
+	err      string
+	rate     float64
+	hasRate  bool
+
+	// only is set when this is the only way messages enter the stream
+	only bool
+}
+
+func (e *replicationEdge) key() string {
+	return fmt.Sprintf("%s<%s:%s:%s", e.stream, e.origin, e.external, e.filter)
+}
+
+func configureStreamReplicationCommand(str *fisk.CmdClause) {
+	c := &StreamReplicationCmd{
+		sortNames: map[string]string{
+			"lag":  "Lag",
+			"seen": "Last Seen",
+			"name": "Stream Name",
+			"rate": "Replication Rate",
+		},
+	}
+
+	sortKeys := mapKeys(c.sortNames)
+	sort.Strings(sortKeys)
+
+	repl := str.Command("replication", "Reports on Stream mirrors and sources").Alias("repl")
+
+	watch := repl.Command("watch", "Watch the replication state of all mirrors and sources").Action(c.watchAction)
+	watch.HelpLong(`Discovers all mirrored and sourced Streams in the account and shows the
+lag, last seen time, error state and replication rate for each relationship.
+
+The rate is calculated from changes between polls. Messages received by a mirror,
+or by a Stream with a single source and no subjects of its own, are counted on the
+receiving Stream. Unfiltered sources are measured on the origin Stream when it is in
+the same account. Other filtered sources show no rate as the messages they copied
+can not be told apart from others.
+`)
+	watch.Flag("sort", fmt.Sprintf("Sorts by a specific property (%s)", strings.Join(sortKeys, ", "))).Default("lag").EnumVar(&c.sort, sortKeys...)
+	watch.Flag("number", "Amount of mirrors and sources to show by the selected dimension").Default("0").Short('n').IntVar(&c.topCount)
+	watch.Flag("interval", "How often to poll for Stream state").Default("5s").DurationVar(&c.interval)
+	watch.Flag("stream", "Only show mirrors and sources where either side matches a substring").PlaceHolder("NAME").StringVar(&c.filter)
+	watch.Flag("errors", "Only show mirrors and sources that report errors").UnNegatableBoolVar(&c.errorsOnly)
+	watch.Flag("lag", "Only show mirrors and sources with at least this many messages lag").PlaceHolder("MSGS").Uint64Var(&c.minLag)
+}
+
+func (c *StreamReplicationCmd) watchAction(_ *fisk.ParseContext) error {
+	_, h, err := terminal.GetSize(int(os.Stdout.Fd()))
+	if err != nil && c.topCount == 0 {
+		return fmt.Errorf("could not determine screen dimensions: %v", err)
+	}
+
+	if c.topCount == 0 {
+		c.topCount = h - 8
+	}
+
+	// without a terminal the requested number of rows is shown as is
+	if err == nil && c.topCount > h-8 {
+		c.topCount = h - 8
+	}
+
+	if c.topCount < 1 {
+		return fmt.Errorf("requested render limits exceed screen size")
+	}
+
+	if c.interval < time.Second {
+		c.interval = time.Second
+	}
+
+	_, mgr, err := prepareHelper("", natsOpts()...)
+	if err != nil {
+		return err
+	}
+
+	tick := time.NewTicker(c.interval)
+	defer tick.Stop()
+
+	ctx, cancel := signal.NotifyContext(ctx, syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	for {
+		edges, err := c.poll(mgr)
+		if err != nil {
+			return err
+		}
+
+		c.redraw(edges)
+
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (c *StreamReplicationCmd) poll(mgr *jsm.Manager) ([]*replicationEdge, error) {
+	streams, _, err := mgr.Streams(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// the list response holds the info for every stream so this does not make further requests
+	var infos []*api.StreamInfo
+	for _, stream := range streams {
+		nfo, err := stream.LatestInformation()
+		if err != nil {
+			continue
+		}
+		infos = append(infos, nfo)
+	}
+
+	edges := replicationEdges(infos)
+	c.updateRates(infos, edges, time.Now())
+
+	return edges, nil
+}
+
+// updateRates calculates the replication rate of edges from the changes since the previous poll
+func (c *StreamReplicationCmd) updateRates(infos []*api.StreamInfo, edges []*replicationEdge, now time.Time) {
+	lags := map[string]uint64{}
+	seqs := map[string]uint64{}
+	for _, nfo := range infos {
+		seqs[nfo.Config.Name] = nfo.State.LastSeq
+	}
+
+	for _, edge := range edges {
+		lags[edge.key()] = edge.lag
+
+		if c.lastPoll.IsZero() {
+			continue
+		}
+
+		prevLag, ok := c.lastLag[edge.key()]
+		if !ok {
+			continue
+		}
+
+		elapsed := now.Sub(c.lastPoll).Seconds()
+
+		// when the edge is the only way messages enter the stream all new messages were replicated, filtered
+		// mirrors keep the origin sequences so gaps left by the filter would be counted. Otherwise messages
+		// that arrived at the origin less any increase in lag were replicated, which only holds without a
+		// filter as lag is measured in origin sequences
+		switch {
+		case edge.only && !(edge.kind == "Mirror" && edge.filter != "") && c.lastSeq[edge.stream] > 0:
+			edge.rate = math.Max(0, (float64(seqs[edge.stream])-float64(c.lastSeq[edge.stream]))/elapsed)
+			edge.hasRate = true
+		case edge.filter == "" && edge.external == "" && c.lastSeq[edge.origin] > 0:
+			added := float64(seqs[edge.origin]) - float64(c.lastSeq[edge.origin])
+			edge.rate = math.Max(0, (added-(float64(edge.lag)-float64(prevLag)))/elapsed)
+			edge.hasRate = true
+		}
+	}
+
+	c.lastPoll = now
+	c.lastLag = lags
+	c.lastSeq = seqs
+}
+
+// replicationEdges extracts all mirror and source relationships from stream information
+func replicationEdges(infos []*api.StreamInfo) []*replicationEdge {
+	var edges []*replicationEdge
+
+	add := func(stream string, kind string, only bool, s *api.StreamSourceInfo) {
+		edge := &replicationEdge{
+			stream: stream,
+			kind:   kind,
+			only:   only,
+			origin: s.Name,
+			filter: s.FilterSubject,
+			lag:    s.Lag,
+			active: s.Active,
+		}
+
+		if edge.filter == "" && len(s.SubjectTransforms) > 0 {
+			var filters []string
+			for _, t := range s.SubjectTransforms {
+				filters = append(filters, t.Source)
+			}
+			edge.filter = strings.Join(filters, ", ")
+		}
+
+		if s.External != nil {
+			edge.external = s.External.ApiPrefix
+		}
+
+		if s.Error != nil {
+			edge.err = s.Error.Description
+		}
+
+		edges = append(edges, edge)
+	}
+
+	for _, nfo := range infos {
+		if nfo.Mirror != nil {
+			add(nfo.Config.Name, "Mirror", true, nfo.Mirror)
+		}
+
+		only := len(nfo.Sources) == 1 && len(nfo.Config.Subjects) == 0
+		for _, s := range nfo.Sources {
+			add(nfo.Config.Name, "Source", only, s)
+		}
+	}
+
+	return edges
+}
+
+func (c *StreamReplicationCmd) filterEdges(edges []*replicationEdge) []*replicationEdge {
+	var matched []*replicationEdge
+
+	for _, edge := range edges {
+		if c.filter != "" && !strings.Contains(edge.stream, c.filter) && !strings.Contains(edge.origin, c.filter) {
+			continue
+		}
+
+		if c.errorsOnly && edge.err == "" {
+			continue
+		}
+
+		if edge.lag < c.minLag {
+			continue
+		}
+
+		matched = append(matched, edge)
+	}
+
+	return matched
+}
+
+func (c *StreamReplicationCmd) redraw(edges []*replicationEdge) {
+	var (
+		totalLag uint64
+		errors   int
+	)
+
+	edges = c.filterEdges(edges)
+
+	for _, edge := range edges {
+		totalLag += edge.lag
+		if edge.err != "" {
+			errors++
+		}
+	}
+
+	sort.Slice(edges, func(i, j int) bool {
+		ni := edges[i].stream + edges[i].origin
+		nj := edges[j].stream + edges[j].origin
+
+		switch c.sort {
+		case "seen":
+			return sortMultiSort(c.seenDuration(edges[i]), c.seenDuration(edges[j]), ni, nj)
+		case "name":
+			return ni < nj
+		case "rate":
+			return sortMultiSort(edges[i].rate, edges[j].rate, ni, nj)
+		default:
+			return sortMultiSort(edges[i].lag, edges[j].lag, ni, nj)
+		}
+	})
+
+	tc := fmt.Sprintf("%d", len(edges))
+	if len(edges) > c.topCount {
+		tc = fmt.Sprintf("%d / %d", c.topCount, len(edges))
+	}
+
+	table := newTableWriter(fmt.Sprintf("Top %s Stream mirrors and sources by %s at %s", tc, c.sortNames[c.sort], c.lastPoll.Format(time.DateTime)))
+	table.AddHeaders("Stream", "Type", "Origin", "Filter", "Lag", "Last Seen", "Rate", "Error")
+
+	if len(edges) > c.topCount {
+		edges = edges[:c.topCount]
+	}
+
+	for _, edge := range edges {
+		origin := edge.origin
+		if edge.external != "" {
+			origin = fmt.Sprintf("%s (%s)", origin, edge.external)
+		}
+
+		seen := "never"
+		if edge.active > 0 && edge.active < math.MaxInt64 {
+			seen = f(edge.active)
+		}
+
+		rate := "-"
+		if edge.hasRate {
+			rate = fmt.Sprintf("%s/s", f(edge.rate))
+		}
+
+		table.AddRow(edge.stream, edge.kind, origin, edge.filter, f(edge.lag), seen, rate, edge.err)
+	}
+	table.AddFooter("Totals", "", "", "", f(totalLag), "", "", fmt.Sprintf("%s errors", f(errors)))
+
+	clearScreen()
+	fmt.Println(table.Render())
+}
+
+// seenDuration sorts never seen mirrors and sources as the longest ago
+func (c *StreamReplicationCmd) seenDuration(e *replicationEdge) time.Duration {
+	if e.active <= 0 {
+		return math.MaxInt64
+	}
+
+	return e.active
+}
@@ -0,0 +1,99 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/jsm.go/api"
+)
+
+func TestReplicationEdges(t *testing.T) {
+	infos := []*api.StreamInfo{
+		{Config: api.StreamConfig{Name: "ORDERS"}},
+		{Config: api.StreamConfig{Name: "BACKUP"}, Mirror: &api.StreamSourceInfo{Name: "ORDERS", Lag: 10}},
+		{Config: api.StreamConfig{Name: "AGGREGATE"}, Sources: []*api.StreamSourceInfo{
+			{Name: "ORDERS", FilterSubject: "ORDERS.new"},
+			{Name: "REMOTE", External: &api.ExternalStream{ApiPrefix: "$JS.east.API"}, Error: &api.ApiError{Description: "stream not found"}},
+		}},
+	}
+
+	edges := replicationEdges(infos)
+	if len(edges) != 3 {
+		t.Fatalf("expected 3 edges got %d", len(edges))
+	}
+
+	if edges[0].stream != "BACKUP" || edges[0].kind != "Mirror" || edges[0].lag != 10 {
+		t.Fatalf("invalid mirror edge: %#v", edges[0])
+	}
+
+	if edges[1].filter != "ORDERS.new" || edges[2].external != "$JS.east.API" || edges[2].err != "stream not found" {
+		t.Fatalf("invalid source edges: %#v %#v", edges[1], edges[2])
+	}
+
+	cmd := &StreamReplicationCmd{errorsOnly: true}
+	matched := cmd.filterEdges(edges)
+	if len(matched) != 1 || matched[0].origin != "REMOTE" {
+		t.Fatalf("invalid error filter: %v", matched)
+	}
+
+	cmd = &StreamReplicationCmd{filter: "BACK", minLag: 1}
+	matched = cmd.filterEdges(edges)
+	if len(matched) != 1 || matched[0].stream != "BACKUP" {
+		t.Fatalf("invalid stream filter: %v", matched)
+	}
+}
+
+func TestReplicationRates(t *testing.T) {
+	infos := func(orders uint64, backup uint64, aggregate uint64, lag uint64) []*api.StreamInfo {
+		return []*api.StreamInfo{
+			{Config: api.StreamConfig{Name: "ORDERS", Subjects: []string{"ORDERS.>"}}, State: api.StreamState{LastSeq: orders}},
+			{Config: api.StreamConfig{Name: "BACKUP"}, State: api.StreamState{LastSeq: backup}, Mirror: &api.StreamSourceInfo{Name: "ORDERS"}},
+			{Config: api.StreamConfig{Name: "NEW"}, State: api.StreamState{LastSeq: aggregate}, Sources: []*api.StreamSourceInfo{{Name: "ORDERS", FilterSubject: "ORDERS.new"}}},
+			{Config: api.StreamConfig{Name: "MIXED", Subjects: []string{"MIXED"}}, Sources: []*api.StreamSourceInfo{
+				{Name: "ORDERS", FilterSubject: "ORDERS.new"},
+				{Name: "ORDERS", Lag: lag},
+			}},
+		}
+	}
+
+	cmd := &StreamReplicationCmd{}
+	start := time.Now()
+
+	first := infos(100, 100, 10, 0)
+	cmd.updateRates(first, replicationEdges(first), start)
+
+	second := infos(200, 150, 30, 20)
+	edges := replicationEdges(second)
+	cmd.updateRates(second, edges, start.Add(10*time.Second))
+
+	expected := map[string]float64{"BACKUP": 5, "NEW": 2}
+	for _, edge := range edges {
+		switch {
+		case edge.stream == "MIXED" && edge.filter != "":
+			if edge.hasRate {
+				t.Fatalf("expected no rate for filtered source into a stream with other sources: %#v", edge)
+			}
+		case edge.stream == "MIXED":
+			if !edge.hasRate || edge.rate != 8 {
+				t.Fatalf("invalid unfiltered source rate: %#v", edge)
+			}
+		default:
+			if !edge.hasRate || edge.rate != expected[edge.stream] {
+				t.Fatalf("invalid rate for %s: %#v", edge.stream, edge)
+			}
+		}
+	}
+}
@@ -0,0 +1,351 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/choria-io/fisk"
+	"github.com/nats-io/jsm.go"
+	"github.com/nats-io/nats.go"
+)
+
+type StreamSearchCmd struct {
+	stream    string
+	subjects  []string
+	headers   []string
+	bodyRegex string
+	jq        string
+	since     string
+	until     string
+	seqRange  string
+	parallel  int
+	count     bool
+	json      bool
+	translate string
+
+	headerMatch map[string]string
+	bodyMatch   *regexp.Regexp
+	jqMatch     *jqExpression
+	mu          sync.Mutex
+}
+
+func configureStreamSearchCommand(str *fisk.CmdClause) {
+	c := &StreamSearchCmd{}
+
+	search := str.Command("search", "Search for messages in a Stream matching headers or content").Action(c.searchAction)
+	search.HelpLong(`Scans the messages in a Stream and shows those matching all the given
+criteria.
+
+The Stream is scanned in order using an ordered consumer. With --parallel the
+sequences are split into ranges that are scanned concurrently by several
+ordered consumers, results are then shown in the order they are found rather
+than in Stream order.
+
+Queries given to --jq are evaluated against JSON bodies and must produce a
+boolean, for example '.order.total > 100 and .order.state == "new"'.
+
+Times given to --since and --until can be RFC3339 timestamps or durations
+like 1h indicating a time in the past.
+`)
+	search.Arg("stream", "Stream to search").Required().StringVar(&c.stream)
+	search.Flag("subject", "Only search messages matching a subject (pass multiple times)").PlaceHolder("SUBJECT").StringsVar(&c.subjects)
+	search.Flag("header", "Only match messages with a header value like K=V (pass multiple times)").Short('H').PlaceHolder("K=V").StringsVar(&c.headers)
+	search.Flag("body-regex", "Only match messages with bodies matching a regular expression").PlaceHolder("REGEX").StringVar(&c.bodyRegex)
+	search.Flag("jq", "Only match messages with JSON bodies matching a jq query").PlaceHolder("QUERY").StringVar(&c.jq)
+	search.Flag("since", "Only search messages received since a time").PlaceHolder("TIME").StringVar(&c.since)
+	search.Flag("until", "Only search messages received before a time").PlaceHolder("TIME").StringVar(&c.until)
+	search.Flag("seq-range", "Only search messages in a sequence range like 100-200").PlaceHolder("RANGE").StringVar(&c.seqRange)
+	search.Flag("parallel", "Number of ordered consumers to scan the Stream with").Default("1").IntVar(&c.parallel)
+	search.Flag("count", "Only show the number of matching messages").UnNegatableBoolVar(&c.count)
+	search.Flag("translate", "Translate the message data by running it through the given command before output").StringVar(&c.translate)
+	search.Flag("json", "Produce JSON output, one matching message per line").Short('j').UnNegatableBoolVar(&c.json)
+}
+
+func (c *StreamSearchCmd) searchAction(_ *fisk.ParseContext) error {
+	var err error
+
+	filter := streamMessageFilter{subjects: c.subjects}
+	filter.startSeq, filter.endSeq, err = parseSeqRange(c.seqRange)
+	if err != nil {
+		return err
+	}
+
+	if c.since != "" {
+		filter.since, err = parseTimeOrAge(c.since)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.until != "" {
+		filter.until, err = parseTimeOrAge(c.until)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.headerMatch, err = parseHeaderMatches(c.headers)
+	if err != nil {
+		return err
+	}
+
+	if c.bodyRegex != "" {
+		c.bodyMatch, err = regexp.Compile(c.bodyRegex)
+		if err != nil {
+			return fmt.Errorf("invalid body regular expression: %w", err)
+		}
+	}
+
+	if c.jq != "" {
+		c.jqMatch, err = newJQExpression(c.jq, true)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, mgr, err := prepareHelper("", natsOpts()...)
+	fisk.FatalIfError(err, "setup failed")
+
+	_, js, err := prepareJSHelper()
+	fisk.FatalIfError(err, "setup failed")
+
+	stream, err := mgr.LoadStream(c.stream)
+	if err != nil {
+		return err
+	}
+
+	matched, err := c.search(js, stream, filter)
+	if err != nil {
+		return err
+	}
+
+	return c.showCount(matched)
+}
+
+// search scans the stream and returns the number of matching messages, with parallel set the sequences are split into ranges scanned concurrently
+func (c *StreamSearchCmd) search(js nats.JetStreamContext, stream *jsm.Stream, filter streamMessageFilter) (int64, error) {
+	state, err := stream.State()
+	if err != nil {
+		return 0, err
+	}
+
+	if state.Msgs == 0 {
+		return 0, nil
+	}
+
+	var matched atomic.Int64
+	scan := func(filter streamMessageFilter) error {
+		return eachStreamMessage(js, c.stream, filter, func(msg *nats.Msg, meta *nats.MsgMetadata) error {
+			if !c.matches(msg) {
+				return nil
+			}
+
+			matched.Add(1)
+
+			if !c.count {
+				return c.showMatch(msg, meta)
+			}
+
+			return nil
+		})
+	}
+
+	if c.parallel <= 1 {
+		err = scan(filter)
+		return matched.Load(), err
+	}
+
+	first := state.FirstSeq
+	if filter.startSeq > first {
+		first = filter.startSeq
+	}
+	last := state.LastSeq
+	if filter.endSeq > 0 && filter.endSeq < last {
+		last = filter.endSeq
+	}
+	if first > last {
+		return 0, nil
+	}
+
+	ranges := splitSeqRange(first, last, c.parallel)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(ranges))
+
+	for i, r := range ranges {
+		rfilter := filter
+		rfilter.startSeq = r[0]
+		rfilter.endSeq = r[1]
+
+		// the last range is left open so messages added while searching are also scanned
+		if i == len(ranges)-1 {
+			rfilter.endSeq = filter.endSeq
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := scan(rfilter)
+			if err != nil {
+				errs <- err
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	var failed []error
+	for err := range errs {
+		failed = append(failed, err)
+	}
+	if len(failed) > 0 {
+		return matched.Load(), errors.Join(failed...)
+	}
+
+	return matched.Load(), nil
+}
+
+func (c *StreamSearchCmd) showCount(count int64) error {
+	switch {
+	case c.count && c.json:
+		return printJSON(map[string]int64{"matched": count})
+	case c.count:
+		fmt.Println(count)
+	case !c.json:
+		fmt.Printf("Found %s matching messages in Stream %s\n", f(count), c.stream)
+	}
+
+	return nil
+}
+
+func (c *StreamSearchCmd) matches(msg *nats.Msg) bool {
+	for k, v := range c.headerMatch {
+		found := false
+		for _, hv := range msg.Header.Values(k) {
+			if hv == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if c.bodyMatch != nil && !c.bodyMatch.Match(msg.Data) {
+		return false
+	}
+
+	if c.jqMatch != nil && !c.jqMatch.Matches(msg.Data) {
+		return false
+	}
+
+	return true
+}
+
+func (c *StreamSearchCmd) showMatch(msg *nats.Msg, meta *nats.MsgMetadata) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.json {
+		j, err := json.Marshal(streamExportRecord{
+			Stream:   c.stream,
+			Subject:  msg.Subject,
+			Sequence: meta.Sequence.Stream,
+			Time:     meta.Timestamp,
+			Headers:  msg.Header,
+			Data:     msg.Data,
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintln(os.Stdout, string(j))
+		return err
+	}
+
+	fmt.Printf("[%d] Subject: %s Received: %s\n", meta.Sequence.Stream, msg.Subject, f(meta.Timestamp))
+	if len(msg.Header) > 0 {
+		fmt.Println()
+		for k, vs := range msg.Header {
+			for _, v := range vs {
+				fmt.Printf("%s: %s\n", k, v)
+			}
+		}
+	}
+	fmt.Println()
+	outPutMSGBody(msg.Data, c.translate, msg.Subject, c.stream)
+
+	return nil
+}
+
+// parseHeaderMatches parses K=V or K:V header matches
+func parseHeaderMatches(hdrs []string) (map[string]string, error) {
+	res := map[string]string{}
+
+	for _, hdr := range hdrs {
+		sep := "="
+		if !strings.Contains(hdr, "=") {
+			sep = ":"
+		}
+
+		parts := strings.SplitN(hdr, sep, 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid header match %q, expected K=V", hdr)
+		}
+
+		res[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	return res, nil
+}
+
+// splitSeqRange splits the sequences from first to last into at most parts ranges of similar size
+func splitSeqRange(first uint64, last uint64, parts int) [][2]uint64 {
+	if last < first || parts < 1 {
+		return nil
+	}
+
+	total := last - first + 1
+	if uint64(parts) > total {
+		parts = int(total)
+	}
+
+	size := total / uint64(parts)
+	extra := total % uint64(parts)
+
+	var res [][2]uint64
+	start := first
+	for i := 0; i < parts; i++ {
+		n := size
+		if uint64(i) < extra {
+			n++
+		}
+
+		res = append(res, [2]uint64{start, start + n - 1})
+		start += n
+	}
+
+	return res
+}
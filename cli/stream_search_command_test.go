@@ -0,0 +1,85 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nats-io/jsm.go"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+func TestSplitSeqRange(t *testing.T) {
+	ranges := splitSeqRange(1, 10, 3)
+	if !cmp.Equal(ranges, [][2]uint64{{1, 4}, {5, 7}, {8, 10}}) {
+		t.Fatalf("invalid ranges %v", ranges)
+	}
+
+	ranges = splitSeqRange(5, 6, 4)
+	if !cmp.Equal(ranges, [][2]uint64{{5, 5}, {6, 6}}) {
+		t.Fatalf("invalid ranges %v", ranges)
+	}
+
+	if ranges = splitSeqRange(10, 5, 2); len(ranges) != 0 {
+		t.Fatalf("expected no ranges got %v", ranges)
+	}
+}
+
+func TestStreamSearch(t *testing.T) {
+	withJetStream(t, func(_ *server.Server, nc *nats.Conn, mgr *jsm.Manager) {
+		js, err := nc.JetStream()
+		assertNoError(t, err)
+
+		orders, err := mgr.NewStreamFromDefault("ORDERS", applyStreamDefaults, jsm.Subjects("ORDERS.*"), jsm.MemoryStorage())
+		assertNoError(t, err)
+
+		for i := 1; i <= 20; i++ {
+			msg := nats.NewMsg(fmt.Sprintf("ORDERS.%d", i%2))
+			msg.Header.Add("X-Region", []string{"east", "west"}[i%2])
+			msg.Data = []byte(fmt.Sprintf(`{"id":%d,"total":%d}`, i, i*10))
+			_, err = js.PublishMsg(msg)
+			assertNoError(t, err)
+		}
+
+		headers, err := parseHeaderMatches([]string{"X-Region=west"})
+		assertNoError(t, err)
+		expr, err := newJQExpression(".total >= 100", true)
+		assertNoError(t, err)
+
+		search := &StreamSearchCmd{stream: "ORDERS", count: true, parallel: 3, headerMatch: headers, jqMatch: expr}
+		matched, err := search.search(js, orders, streamMessageFilter{})
+		assertNoError(t, err)
+		if matched != 5 {
+			t.Fatalf("expected 5 matches got %d", matched)
+		}
+
+		search = &StreamSearchCmd{stream: "ORDERS", count: true, parallel: 2, bodyMatch: regexp.MustCompile(`"id":1\d,`)}
+		matched, err = search.search(js, orders, streamMessageFilter{subjects: []string{"ORDERS.0"}, startSeq: 12})
+		assertNoError(t, err)
+		if matched != 4 {
+			t.Fatalf("expected 4 matches got %d", matched)
+		}
+
+		search = &StreamSearchCmd{stream: "ORDERS", count: true, headerMatch: headers, jqMatch: expr}
+		matched, err = search.search(js, orders, streamMessageFilter{endSeq: 15})
+		assertNoError(t, err)
+		if matched != 3 {
+			t.Fatalf("expected 3 matches got %d", matched)
+		}
+	})
+}
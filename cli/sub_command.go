@@ -19,11 +19,13 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
 	"sort"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/choria-io/fisk"
@@ -39,6 +41,8 @@ type subCmd struct {
 	durable               string
 	raw                   bool
 	translate             string
+	decode                string
+	decoder               msgDecoder
 	jsAck                 bool
 	inbox                 bool
 	match                 bool
@@ -57,6 +61,7 @@ type subCmd struct {
 	jetStream             bool
 	ignoreSubjects        []string
 	wait                  time.Duration
+	record                string
 }
 
 func configureSubCommand(app commandHost) {
@@ -69,11 +74,13 @@ func configureSubCommand(app commandHost) {
 	act.Flag("durable", "Use a durable consumer (requires JetStream)").StringVar(&c.durable)
 	act.Flag("raw", "Show the raw data received").Short('r').UnNegatableBoolVar(&c.raw)
 	act.Flag("translate", "Translate the message data by running it through the given command before output").StringVar(&c.translate)
+	act.Flag("decode", msgDecoderHelp).PlaceHolder("DECODER").StringVar(&c.decode)
 	act.Flag("ack", "Acknowledge JetStream message that have the correct metadata").BoolVar(&c.jsAck)
 	act.Flag("match-replies", "Match replies to requests").UnNegatableBoolVar(&c.match)
 	act.Flag("inbox", "Subscribes to a generate inbox").Short('i').UnNegatableBoolVar(&c.inbox)
 	act.Flag("count", "Quit after receiving this many messages").UintVar(&c.limit)
 	act.Flag("dump", "Dump received messages to files, 1 file per message. Specify - for null terminated STDOUT for use with xargs -0").PlaceHolder("DIRECTORY").StringVar(&c.dump)
+	act.Flag("record", "Records received messages including their headers and receive time to a capture file for use with 'nats pub --replay'").PlaceHolder("FILE").StringVar(&c.record)
 	act.Flag("headers-only", "Do not render any data, shows only headers").UnNegatableBoolVar(&c.headersOnly)
 	act.Flag("start-sequence", "Starts at a specific Stream sequence (requires JetStream)").PlaceHolder("SEQUENCE").Uint64Var(&c.sseq)
 	act.Flag("all", "Delivers all messages found in the Stream (requires JetStream").UnNegatableBoolVar(&c.deliverAll)
@@ -183,6 +190,14 @@ func (c *subCmd) subscribe(p *fisk.ParseContext) error {
 	if c.reportSubjects && c.reportSubjectsCount == 0 {
 		return fmt.Errorf("subject count must be at least one")
 	}
+	if c.record != "" && (c.dump != "" || c.match || c.reportSubjects) {
+		return fmt.Errorf("recording is not compatible with dumping, matching replies or reporting subjects")
+	}
+
+	c.decoder, err = newMsgDecoder(c.decode)
+	if err != nil {
+		return err
+	}
 
 	if c.dump != "" && c.dump != "-" {
 		err = os.MkdirAll(c.dump, 0700)
@@ -202,12 +217,31 @@ func (c *subCmd) subscribe(p *fisk.ParseContext) error {
 
 		replySub *nats.Subscription
 		matchMap map[string]*nats.Msg
+		recorder *ncapWriter
 
 		subjectReportMap      map[string]int64
 		subjectBytesReportMap map[string]int64
 	)
 	defer cancel()
 
+	if c.record != "" {
+		recorder, err = newNcapWriter(c.record)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			err := recorder.Close()
+			if err != nil {
+				log.Printf("Could not close capture file %s: %s", c.record, err)
+			}
+		}()
+
+		// stop on interrupt so that buffered messages are written
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+	}
+
 	// If the wait timeout is set, then we will cancel after the timer fires.
 	var t *time.Timer
 	if c.wait > 0 {
@@ -261,8 +295,15 @@ func (c *subCmd) subscribe(p *fisk.ParseContext) error {
 			subjMu.Unlock()
 		}
 
-		// if we're not reporting on subjects, then print the message
-		if !c.reportSubjects {
+		if recorder != nil {
+			err := recorder.Write(m, time.Now())
+			if err != nil {
+				log.Printf("Could not record message on subject %s: %s", m.Subject, err)
+			}
+		}
+
+		// if we're not reporting on subjects or recording, then print the message
+		if !c.reportSubjects && recorder == nil {
 			if c.match && m.Reply != "" {
 				matchMap[m.Reply] = m
 			} else {
@@ -337,6 +378,8 @@ func (c *subCmd) subscribe(p *fisk.ParseContext) error {
 
 	if (!c.raw && c.dump == "") || c.inbox {
 		switch {
+		case c.record != "":
+			log.Printf("Recording messages on %s to %s, press ^C to stop %s", strings.Join(c.subjects, ", "), c.record, ignoredSubjInfo)
 		case c.jetStream:
 			// logs later depending on settings
 		case c.jsAck:
@@ -478,6 +521,12 @@ func (c *subCmd) subscribe(p *fisk.ParseContext) error {
 
 	<-ctx.Done()
 
+	if recorder != nil {
+		mu.Lock()
+		log.Printf("Recorded %s messages to %s", f(ctr), c.record)
+		mu.Unlock()
+	}
+
 	return nil
 }
 
@@ -524,9 +573,9 @@ func (c *subCmd) printMsg(msg *nats.Msg, reply *nats.Msg, ctr uint) {
 
 	} else if c.raw {
 		// Output format 2/3: raw
-		outPutMSGBodyCompact(msg.Data, c.translate, "", "")
+		outPutMSGBodyCompact(decodeMsgBody(c.decoder, msg.Header, msg.Data), c.translate, "", "")
 		if reply != nil {
-			fmt.Println(string(reply.Data))
+			fmt.Println(string(decodeMsgBody(c.decoder, reply.Header, reply.Data)))
 		}
 
 	} else {
@@ -544,7 +593,7 @@ func (c *subCmd) printMsg(msg *nats.Msg, reply *nats.Msg, ctr uint) {
 			fmt.Printf("[#%d] Received JetStream message: consumer: %s > %s / subject: %s / delivered: %d / consumer seq: %d / stream seq: %d\n", ctr, info.Stream(), info.Consumer(), msg.Subject, info.Delivered(), info.ConsumerSequence(), info.StreamSequence())
 		}
 
-		prettyPrintMsg(msg, c.headersOnly, c.translate)
+		prettyPrintMsg(msg, c.headersOnly, c.translate, c.decoder)
 
 		if reply != nil {
 			if info == nil {
@@ -555,7 +604,7 @@ func (c *subCmd) printMsg(msg *nats.Msg, reply *nats.Msg, ctr uint) {
 				fmt.Printf("[#%d] Matched reply JetStream message: consumer: %s > %s / subject: %s / delivered: %d / consumer seq: %d / stream seq: %d\n", ctr, info.Stream(), info.Consumer(), reply.Subject, info.Delivered(), info.ConsumerSequence(), info.StreamSequence())
 			}
 
-			prettyPrintMsg(reply, c.headersOnly, c.translate)
+			prettyPrintMsg(reply, c.headersOnly, c.translate, c.decoder)
 
 		}
 	} // output format type dispatch
@@ -585,7 +634,7 @@ func dumpMsg(msg *nats.Msg, stdout bool, filepath string, ctr uint) {
 	}
 }
 
-func prettyPrintMsg(msg *nats.Msg, headersOnly bool, filter string) {
+func prettyPrintMsg(msg *nats.Msg, headersOnly bool, filter string, decoder msgDecoder) {
 	if len(msg.Header) > 0 {
 		for h, vals := range msg.Header {
 			for _, val := range vals {
@@ -597,6 +646,6 @@ func prettyPrintMsg(msg *nats.Msg, headersOnly bool, filter string) {
 	}
 
 	if !headersOnly {
-		outPutMSGBody(msg.Data, filter, msg.Subject, "")
+		outPutMSGBody(decodeMsgBody(decoder, msg.Header, msg.Data), filter, msg.Subject, "")
 	}
 }
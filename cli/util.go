@@ -42,6 +42,7 @@ import (
 	"github.com/AlecAivazis/survey/v2"
 	"github.com/choria-io/fisk"
 	"github.com/dustin/go-humanize"
+	"github.com/google/go-cmp/cmp"
 	"github.com/google/shlex"
 	"github.com/gosuri/uiprogress"
 	"github.com/jedib0t/go-pretty/v6/table"
@@ -484,6 +485,65 @@ func prepareHelper(servers string, copts ...nats.Option) (*nats.Conn, *jsm.Manag
 	return prepareHelperUnlocked(servers, copts...)
 }
 
+// prepareContextHelper connects to the named context, the connection from the command line options is used when name is empty.
+// The returned function closes connections made to named contexts and should be called once they are no longer needed
+func prepareContextHelper(name string) (*jsm.Manager, nats.JetStreamContext, func(), error) {
+	if name == "" {
+		_, mgr, err := prepareHelper("", natsOpts()...)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		_, js, err := prepareJSHelper()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		return mgr, js, func() {}, nil
+	}
+
+	cfg, err := natscontext.New(name, true)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	copts, err := cfg.NATSOptions()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	nc, err := nats.Connect(cfg.ServerURL(), append(copts, nats.Name("NATS CLI Version "+Version))...)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("could not connect to context %s: %w", name, err)
+	}
+
+	jsopts := []jsm.Option{
+		jsm.WithAPIPrefix(cfg.JSAPIPrefix()),
+		jsm.WithEventPrefix(cfg.JSEventPrefix()),
+		jsm.WithDomain(cfg.JSDomain()),
+	}
+	if opts.Timeout != 0 {
+		jsopts = append(jsopts, jsm.WithTimeout(opts.Timeout))
+	}
+	if opts.Trace {
+		jsopts = append(jsopts, jsm.WithTrace())
+	}
+
+	mgr, err := jsm.New(nc, jsopts...)
+	if err != nil {
+		nc.Close()
+		return nil, nil, nil, err
+	}
+
+	js, err := nc.JetStream(nats.Domain(cfg.JSDomain()), nats.APIPrefix(cfg.JSAPIPrefix()), nats.MaxWait(opts.Timeout))
+	if err != nil {
+		nc.Close()
+		return nil, nil, nil, err
+	}
+
+	return mgr, js, nc.Close, nil
+}
+
 func validator() *SchemaValidator {
 	if os.Getenv("NOVALIDATE") == "" {
 		return new(SchemaValidator)
@@ -627,6 +687,11 @@ func (p *pubData) ID() string {
 }
 
 func pubReplyBodyTemplate(body string, request string, ctr int) ([]byte, error) {
+	return pubReplyBodyTemplateWithFuncs(body, request, ctr, nil)
+}
+
+// pubReplyBodyTemplateWithFuncs renders body like pubReplyBodyTemplate with additional template functions
+func pubReplyBodyTemplateWithFuncs(body string, request string, ctr int, funcs template.FuncMap) ([]byte, error) {
 	now := time.Now()
 	funcMap := template.FuncMap{
 		"Random":    randomString,
@@ -643,6 +708,10 @@ func pubReplyBodyTemplate(body string, request string, ctr int) ([]byte, error)
 		funcMap["Request"] = func() string { return request }
 	}
 
+	for k, v := range funcs {
+		funcMap[k] = v
+	}
+
 	templ, err := template.New("body").Funcs(funcMap).Parse(body)
 	if err != nil {
 		return []byte(body), err
@@ -1545,6 +1614,64 @@ func sortMultiSort[V constraints.Ordered, S string | constraints.Ordered](i1 V,
 	return i1 > j1
 }
 
+// parseSeqRange parses ranges like 10-20, 10- or 10 into a start and end sequence, 0 indicates no bound
+func parseSeqRange(r string) (start uint64, end uint64, err error) {
+	if r == "" {
+		return 0, 0, nil
+	}
+
+	parts := strings.SplitN(r, "-", 2)
+
+	if parts[0] != "" {
+		start, err = strconv.ParseUint(strings.TrimSpace(parts[0]), 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid sequence range %q: %w", r, err)
+		}
+	}
+
+	switch {
+	case len(parts) == 1:
+		end = start
+	case parts[1] != "":
+		end, err = strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid sequence range %q: %w", r, err)
+		}
+	}
+
+	if end > 0 && end < start {
+		return 0, 0, fmt.Errorf("invalid sequence range %q: end is before start", r)
+	}
+
+	return start, end, nil
+}
+
+// parseTimeOrAge parses a RFC3339 timestamp or a duration like 1h that indicates a time in the past
+func parseTimeOrAge(t string) (time.Time, error) {
+	ts, err := time.Parse(time.RFC3339, t)
+	if err == nil {
+		return ts, nil
+	}
+
+	age, err := parseDurationString(t)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected a RFC3339 timestamp or a duration", t)
+	}
+
+	return time.Now().Add(-age), nil
+}
+
+// configDiff renders the differences between two configurations, string lists that only differ in ordering are considered equal
+func configDiff(current any, desired any) string {
+	sorter := cmp.Transformer("Sort", func(in []string) []string {
+		out := append([]string(nil), in...)
+		sort.Strings(out)
+		return out
+	})
+
+	return cmp.Diff(current, desired, sorter)
+}
+
 func mapKeys[M ~map[K]V, K comparable, V any](m M) []K {
 	r := make([]K, 0, len(m))
 	for k := range m {
@@ -262,3 +262,35 @@ func TestMultipleSort(t *testing.T) {
 		t.Fatalf("expected true")
 	}
 }
+
+func TestParseSeqRange(t *testing.T) {
+	cases := []struct {
+		input string
+		start uint64
+		end   uint64
+		error bool
+	}{
+		{input: ""},
+		{input: "10", start: 10, end: 10},
+		{input: "10-20", start: 10, end: 20},
+		{input: "10-", start: 10},
+		{input: "-20", end: 20},
+		{input: "20-10", error: true},
+		{input: "x-10", error: true},
+	}
+
+	for _, c := range cases {
+		start, end, err := parseSeqRange(c.input)
+		if c.error {
+			if err == nil {
+				t.Fatalf("expected an error parsing %q", c.input)
+			}
+			continue
+		}
+
+		assertNoError(t, err)
+		if start != c.start || end != c.end {
+			t.Fatalf("expected %q to parse as %d-%d got %d-%d", c.input, c.start, c.end, start, end)
+		}
+	}
+}